@@ -1,5 +1,10 @@
 module github.com/baidu/go-lib
 
-go 1.12
+go 1.22
 
-require github.com/jehiah/go-strftime v0.0.0-20171201141054-1d33003b3869
+require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/jehiah/go-strftime v0.0.0-20171201141054-1d33003b3869
+	github.com/klauspost/compress v1.18.0
+	gopkg.in/yaml.v3 v3.0.1
+)
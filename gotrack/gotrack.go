@@ -61,6 +61,11 @@ func (g GoroutineLock) CheckNotOn() {
 
 var goroutineSpace = []byte("goroutine ")
 
+// CurGoroutineID returns id of the current goroutine
+func CurGoroutineID() uint64 {
+	return curGoroutineID()
+}
+
 func curGoroutineID() uint64 {
 	bp := littleBuf.Get().(*[]byte)
 	defer littleBuf.Put(bp)
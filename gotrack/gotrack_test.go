@@ -45,3 +45,16 @@ func TestGoroutineLock(t *testing.T) {
 		t.Errorf("expected on see panic about running on the wrong goroutine; got %v", e)
 	}
 }
+
+func TestCurGoroutineID(t *testing.T) {
+	id := CurGoroutineID()
+	if id == 0 || id != CurGoroutineID() {
+		t.Fatalf("unexpected goroutine id %d", id)
+	}
+
+	other := make(chan uint64)
+	go func() { other <- CurGoroutineID() }()
+	if got := <-other; got == id {
+		t.Errorf("goroutine id %d should differ from %d", got, id)
+	}
+}
@@ -0,0 +1,321 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package access_log writes access log of http server, by log4go writers
+/*
+Usage:
+    import "github.com/baidu/go-lib/log/access_log"
+
+    // access log in ./log/access.log, rotated hourly, 24 backups are kept
+    logger, err := access_log.NewFileAccessLogger("./log/access.log", "H", 24,
+        `$remote_addr [$time_local] "$request" $status $body_bytes_sent $request_time $upstream`)
+    if err != nil {
+        return err
+    }
+    defer logger.Close()
+
+    // requests handled by mux are logged
+    http.ListenAndServe(":8080", logger.Handler(mux))
+
+    // in handler of request, add custom field, written by $upstream
+    access_log.SetField(r, "upstream", "10.0.0.2:8080")
+
+See template.go for variables in template. With FORMAT_JSON, records are
+written as JSON objects, with custom fields.
+*/
+package access_log
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/baidu/go-lib/log/log4go"
+)
+
+// Field is a custom field of access log record
+type Field struct {
+	Key   string
+	Value string
+}
+
+// Record is an access log record of a request
+type Record struct {
+	Time       time.Time     // time when request is received
+	Method     string        // method of request
+	Path       string        // path of request
+	Query      string        // raw query of request
+	Proto      string        // protocol of request, e.g., HTTP/1.1
+	Host       string        // host of request
+	RemoteAddr string        // ip address of client
+	RemotePort string        // port of client
+	Header     http.Header   // header of request
+	RequestID  string        // request id in ctx (see log4go.ContextRequestID), or X-Request-Id
+	Status     int           // status code of response
+	Bytes      int64         // bytes of response body
+	Latency    time.Duration // time of handling request
+
+	lock   sync.Mutex
+	Fields []Field // custom fields, see SetField
+}
+
+// NewRecord creates record for request, received at start
+func NewRecord(r *http.Request, start time.Time) *Record {
+	rec := &Record{
+		Time:       start,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Query:      r.URL.RawQuery,
+		Proto:      r.Proto,
+		Host:       r.Host,
+		RemoteAddr: r.RemoteAddr,
+		Header:     r.Header,
+		RequestID:  log4go.ContextRequestID(r.Context()),
+	}
+	if len(rec.RequestID) == 0 {
+		rec.RequestID = r.Header.Get("X-Request-Id")
+	}
+	if host, port, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		rec.RemoteAddr, rec.RemotePort = host, port
+	}
+	return rec
+}
+
+// SetField sets custom field of record, it is safe for concurrent use.
+// Keys of JSON record (e.g., "status") are rejected.
+func (rec *Record) SetField(key string, value string) error {
+	if len(key) == 0 || jsonKeys[key] {
+		return fmt.Errorf("invalid key of field: %q", key)
+	}
+
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+
+	for i := range rec.Fields {
+		if rec.Fields[i].Key == key {
+			rec.Fields[i].Value = value
+			return nil
+		}
+	}
+	rec.Fields = append(rec.Fields, Field{Key: key, Value: value})
+	return nil
+}
+
+// Field gets value of custom field, or "" if not found
+func (rec *Record) Field(key string) string {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+
+	for _, f := range rec.Fields {
+		if f.Key == key {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// recordKey is key of record in context of request
+type recordKey struct{}
+
+// RecordFromContext gets access log record in ctx of request handled by
+// AccessLogger.Handler, or nil if not found
+func RecordFromContext(ctx context.Context) *Record {
+	rec, _ := ctx.Value(recordKey{}).(*Record)
+	return rec
+}
+
+// SetField sets custom field of access log for request handled by
+// AccessLogger.Handler. It does nothing for other requests.
+func SetField(r *http.Request, key string, value string) error {
+	if rec := RecordFromContext(r.Context()); rec != nil {
+		return rec.SetField(key, value)
+	}
+	return nil
+}
+
+// AccessLogger writes access log records to log writer
+type AccessLogger struct {
+	writer   log4go.LogWriter
+	template *Template // nil for FORMAT_JSON
+	bufPool  sync.Pool
+}
+
+// NewAccessLogger creates access logger writing records to w. Records are
+// written as messages of log records, so format of w should be "%M".
+//
+// PARAMS:
+//   - w: log writer, e.g., log4go.TimeFileLogWriter
+//   - format: template of record (e.g., FORMAT_COMBINED), or FORMAT_JSON
+func NewAccessLogger(w log4go.LogWriter, format string) (*AccessLogger, error) {
+	if w == nil {
+		return nil, errors.New("log writer is nil")
+	}
+
+	l := &AccessLogger{writer: w}
+	if format != FORMAT_JSON {
+		t, err := ParseTemplate(format)
+		if err != nil {
+			return nil, err
+		}
+		l.template = t
+	}
+	l.bufPool.New = func() interface{} {
+		return new(bytes.Buffer)
+	}
+	return l, nil
+}
+
+// NewFileAccessLogger creates access logger writing records to file, which
+// rolls over by time (see log4go.NewTimeFileLogWriter)
+//
+// PARAMS:
+//   - filename: name of log file, e.g., "./log/access.log"
+//   - when: "M", "H", "D" or "MIDNIGHT"
+//   - backupCount: if backupCount > 0, no more than backupCount backups are kept
+//   - format: template of record (e.g., FORMAT_COMBINED), or FORMAT_JSON
+func NewFileAccessLogger(filename string, when string, backupCount int,
+	format string) (*AccessLogger, error) {
+	if !log4go.WhenIsValid(when) {
+		return nil, fmt.Errorf("invalid value of when: %s", when)
+	}
+	if format != FORMAT_JSON {
+		if _, err := ParseTemplate(format); err != nil {
+			return nil, err
+		}
+	}
+
+	w := log4go.NewTimeFileLogWriter(filename, when, backupCount, false)
+	if w == nil {
+		return nil, fmt.Errorf("error in log4go.NewTimeFileLogWriter(%s)", filename)
+	}
+	w.SetFormat("%M")
+	return NewAccessLogger(w, format)
+}
+
+// Writer returns log writer of the logger
+func (l *AccessLogger) Writer() log4go.LogWriter {
+	return l.writer
+}
+
+// Format formats record, without newline
+func (l *AccessLogger) Format(rec *Record) string {
+	buf := l.bufPool.Get().(*bytes.Buffer)
+	defer l.bufPool.Put(buf)
+
+	buf.Reset()
+	if l.template != nil {
+		l.template.Render(buf, rec)
+	} else {
+		rec.lock.Lock()
+		renderJSON(buf, rec)
+		rec.lock.Unlock()
+	}
+	return buf.String()
+}
+
+// Log writes record to log writer
+func (l *AccessLogger) Log(rec *Record) {
+	l.writer.LogWrite(&log4go.LogRecord{
+		Level:     log4go.INFO,
+		Created:   rec.Time,
+		Message:   l.Format(rec),
+		RequestID: rec.RequestID,
+	})
+}
+
+// Close closes log writer
+func (l *AccessLogger) Close() {
+	l.writer.Close()
+}
+
+// Handler returns http handler which logs requests handled by next. If next
+// panics, the request is logged with status 500, and the panic is propagated.
+func (l *AccessLogger) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := NewRecord(r, time.Now())
+		rw := &responseWriter{ResponseWriter: w}
+
+		defer func() {
+			p := recover()
+			rec.Latency = time.Since(rec.Time)
+			rec.Status = rw.status
+			if p != nil {
+				// response is aborted by server
+				rec.Status = http.StatusInternalServerError
+			} else if rec.Status == 0 {
+				rec.Status = http.StatusOK
+			}
+			rec.Bytes = rw.bytes
+			l.Log(rec)
+			if p != nil {
+				panic(p)
+			}
+		}()
+
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), recordKey{}, rec)))
+	})
+}
+
+// responseWriter records status and bytes of response
+type responseWriter struct {
+	http.ResponseWriter
+	status int   // status code, 0 if header is not written
+	bytes  int64 // bytes of body written
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher, for streaming response
+func (w *responseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, e.g., for websocket
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("http.Hijacker is not implemented")
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the original writer, for http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package access_log
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baidu/go-lib/log/log4go"
+)
+
+func testRecord() *Record {
+	header := make(http.Header)
+	header.Set("User-Agent", "curl/7.0")
+	header.Set("X-Forwarded-For", "10.0.0.1")
+	rec := &Record{
+		Time:       time.Date(2019, 5, 1, 10, 0, 0, 0, time.FixedZone("", 8*3600)),
+		Method:     "GET",
+		Path:       "/index.html",
+		Query:      "a=1",
+		Proto:      "HTTP/1.1",
+		Host:       "example.com",
+		RemoteAddr: "127.0.0.1",
+		RemotePort: "5678",
+		Header:     header,
+		Status:     404,
+		Bytes:      123,
+		Latency:    12345 * time.Microsecond,
+	}
+	rec.SetField("upstream", "10.0.0.2:8080")
+	return rec
+}
+
+func TestTemplate(t *testing.T) {
+	cases := map[string]string{
+		FORMAT_COMBINED: `127.0.0.1 - - [01/May/2019:10:00:00 +0800] "GET /index.html?a=1 HTTP/1.1" 404 123 "-" "curl/7.0"`,
+		FORMAT_COMMON:   `127.0.0.1 - - [01/May/2019:10:00:00 +0800] "GET /index.html?a=1 HTTP/1.1" 404 123`,
+		"$remote_addr:$remote_port $request_time $upstream $unknown":  "127.0.0.1:5678 0.012 10.0.0.2:8080 -",
+		"${uri}_${args} $$status $http_x_forwarded_for $time_iso8601": "/index.html_a=1 $status 10.0.0.1 2019-05-01T10:00:00+08:00",
+		"$request_method $request_uri $host $server_protocol $msec":   "GET /index.html?a=1 example.com HTTP/1.1 1556676000.000",
+		"$status$body_bytes_sent ${request_id}":                       "404123 -",
+		"no variable":                                                 "no variable",
+	}
+	for format, want := range cases {
+		tmpl, err := ParseTemplate(format)
+		if err != nil {
+			t.Fatalf("ParseTemplate(%q): %s", format, err)
+		}
+		var buf bytes.Buffer
+		tmpl.Render(&buf, testRecord())
+		if got := buf.String(); got != want {
+			t.Errorf("%q: got %q, want %q", format, got, want)
+		}
+	}
+
+	// values are escaped, so that they could not forge records or quotes
+	rec := testRecord()
+	rec.Path = "/a\n127.0.0.1 - - \"GET /b\\"
+	rec.Header.Set("User-Agent", `x" "y`)
+	tmpl, _ := ParseTemplate(FORMAT_COMBINED)
+	var buf bytes.Buffer
+	tmpl.Render(&buf, rec)
+	want := `127.0.0.1 - - [01/May/2019:10:00:00 +0800] "GET /a\x0A127.0.0.1 - - \x22GET /b\x5C?a=1 HTTP/1.1" 404 123 "-" "x\x22 \x22y"`
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	for _, format := range []string{"${status", "$ x", "${}"} {
+		if _, err := ParseTemplate(format); err == nil {
+			t.Errorf("ParseTemplate(%q) should fail", format)
+		}
+	}
+}
+
+func TestAccessLoggerJSON(t *testing.T) {
+	w := log4go.NewMemoryLogWriter(10)
+	l, err := NewAccessLogger(w, FORMAT_JSON)
+	if err != nil {
+		t.Fatalf("NewAccessLogger: %s", err)
+	}
+	rec := testRecord()
+	rec.RequestID = "req-1"
+	l.Log(rec)
+
+	recs := w.Tail(0, nil)
+	if len(recs) != 1 {
+		t.Fatalf("got %d records, want 1", len(recs))
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(recs[0].Message), &obj); err != nil {
+		t.Fatalf("invalid JSON %q: %s", recs[0].Message, err)
+	}
+	want := map[string]interface{}{
+		"path":       "/index.html",
+		"status":     float64(404),
+		"bytes":      float64(123),
+		"latency":    0.012,
+		"user_agent": "curl/7.0",
+		"request_id": "req-1",
+		"upstream":   "10.0.0.2:8080",
+	}
+	for key, value := range want {
+		if obj[key] != value {
+			t.Errorf("%s: got %v, want %v", key, obj[key], value)
+		}
+	}
+
+	// keys of JSON record could not be used by custom fields
+	if err := rec.SetField("status", "200"); err == nil {
+		t.Errorf("SetField() should fail for reserved key")
+	}
+	rec.Fields = append(rec.Fields, Field{Key: "status", Value: "200"})
+	l.Log(rec)
+	recs = w.Tail(0, nil)
+	if strings.Count(recs[len(recs)-1].Message, `"status"`) != 1 {
+		t.Errorf("got %q", recs[len(recs)-1].Message)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	dir, err := os.MkdirTemp("", "access_log")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "access.log")
+	l, err := NewFileAccessLogger(filename, "H", 2, "$request_method $uri $status $body_bytes_sent $request_id $user")
+	if err != nil {
+		t.Fatalf("NewFileAccessLogger: %s", err)
+	}
+
+	handler := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetField(r, "user", "alice")
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Path == "/panic" {
+			panic(http.ErrAbortHandler)
+		}
+		w.Write([]byte("hello"))
+	}))
+
+	for _, path := range []string{"/hello", "/missing"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Request-Id", "id"+path)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	// panic is logged with status 500, and propagated
+	func() {
+		defer func() {
+			if p := recover(); p != http.ErrAbortHandler {
+				t.Errorf("got panic %v, want %v", p, http.ErrAbortHandler)
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+	}()
+	l.Close()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+	want := "GET /hello 200 5 id/hello alice\nGET /missing 404 19 id/missing alice\nGET /panic 500 0 - alice\n"
+	if string(data) != want {
+		t.Errorf("got %q, want %q", data, want)
+	}
+
+	if _, err := NewFileAccessLogger(filename, "X", 2, FORMAT_COMBINED); err == nil {
+		t.Errorf("invalid when should fail")
+	}
+	if !strings.Contains(l.Format(testRecord()), "GET /index.html 404 123 - -") {
+		t.Errorf("got %q", l.Format(testRecord()))
+	}
+}
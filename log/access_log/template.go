@@ -0,0 +1,324 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// format templates of access log, like log_format of nginx
+/*
+Variables in template are written as $name or ${name}:
+    $remote_addr      ip address of client
+    $remote_port      port of client
+    $time_local       time in common log format, e.g., 01/May/2019:10:00:00 +0800
+    $time_iso8601     time in ISO 8601, e.g., 2019-05-01T10:00:00+08:00
+    $msec             time in seconds, with milliseconds
+    $request          request line, e.g., "GET /index.html?a=1 HTTP/1.1"
+    $request_method   method of request
+    $request_uri      path and query of request
+    $uri              path of request
+    $args             query of request
+    $server_protocol  protocol of request, e.g., HTTP/1.1
+    $host             host of request
+    $status           status code of response
+    $body_bytes_sent  bytes of response body
+    $request_time     latency in seconds, with milliseconds
+    $request_id       request id, see log4go.ContextRequestID
+    $http_<header>    header of request, e.g., $http_user_agent, $http_x_forwarded_for
+    $<field>          custom field of record, see SetField
+
+Empty values are written as "-". "$$" is written as "$". Control characters,
+'"' and '\\' in values are escaped as \xHH like nginx, e.g., newline in path
+is written as \x0A, so that values could not forge records or break quoted
+fields. Custom fields could not use keys of JSON records, e.g., "status".
+*/
+
+package access_log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// combined format of nginx
+	FORMAT_COMBINED = `$remote_addr - - [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`
+	// common log format
+	FORMAT_COMMON = `$remote_addr - - [$time_local] "$request" $status $body_bytes_sent`
+	// one JSON object per line
+	FORMAT_JSON = "json"
+)
+
+// renderer writes value of variable in record
+type renderer func(buf *bytes.Buffer, rec *Record)
+
+// segment is literal text or variable in template
+type segment struct {
+	text   string   // literal text
+	render renderer // renderer of variable, nil for text
+}
+
+// Template is a compiled format template of access log
+type Template struct {
+	format   string
+	segments []segment
+}
+
+// variables of template, except $http_<header> and custom fields
+var variables = map[string]renderer{
+	"remote_addr": func(buf *bytes.Buffer, rec *Record) {
+		writeValue(buf, rec.RemoteAddr)
+	},
+	"remote_port": func(buf *bytes.Buffer, rec *Record) {
+		writeValue(buf, rec.RemotePort)
+	},
+	"time_local": func(buf *bytes.Buffer, rec *Record) {
+		buf.Write(rec.Time.AppendFormat(buf.AvailableBuffer(), "02/Jan/2006:15:04:05 -0700"))
+	},
+	"time_iso8601": func(buf *bytes.Buffer, rec *Record) {
+		buf.Write(rec.Time.AppendFormat(buf.AvailableBuffer(), time.RFC3339))
+	},
+	"msec": func(buf *bytes.Buffer, rec *Record) {
+		writeSeconds(buf, time.Duration(rec.Time.UnixNano()))
+	},
+	"request": func(buf *bytes.Buffer, rec *Record) {
+		writeEscaped(buf, rec.Method)
+		buf.WriteByte(' ')
+		writeRequestURI(buf, rec)
+		buf.WriteByte(' ')
+		writeEscaped(buf, rec.Proto)
+	},
+	"request_method": func(buf *bytes.Buffer, rec *Record) {
+		writeValue(buf, rec.Method)
+	},
+	"request_uri": writeRequestURI,
+	"uri": func(buf *bytes.Buffer, rec *Record) {
+		writeValue(buf, rec.Path)
+	},
+	"args": func(buf *bytes.Buffer, rec *Record) {
+		writeValue(buf, rec.Query)
+	},
+	"server_protocol": func(buf *bytes.Buffer, rec *Record) {
+		writeValue(buf, rec.Proto)
+	},
+	"host": func(buf *bytes.Buffer, rec *Record) {
+		writeValue(buf, rec.Host)
+	},
+	"status": func(buf *bytes.Buffer, rec *Record) {
+		buf.Write(strconv.AppendInt(buf.AvailableBuffer(), int64(rec.Status), 10))
+	},
+	"body_bytes_sent": func(buf *bytes.Buffer, rec *Record) {
+		buf.Write(strconv.AppendInt(buf.AvailableBuffer(), rec.Bytes, 10))
+	},
+	"request_time": func(buf *bytes.Buffer, rec *Record) {
+		writeSeconds(buf, rec.Latency)
+	},
+	"request_id": func(buf *bytes.Buffer, rec *Record) {
+		writeValue(buf, rec.RequestID)
+	},
+}
+
+// ParseTemplate compiles format template of access log
+//
+// PARAMS:
+//   - format: template, e.g., FORMAT_COMBINED
+func ParseTemplate(format string) (*Template, error) {
+	t := &Template{format: format}
+
+	var text strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '$' {
+			text.WriteByte(format[i])
+			continue
+		}
+		if i+1 < len(format) && format[i+1] == '$' {
+			text.WriteByte('$')
+			i++
+			continue
+		}
+
+		// get name of variable
+		var name string
+		if i+1 < len(format) && format[i+1] == '{' {
+			end := strings.IndexByte(format[i+2:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed variable at %d in %q", i, format)
+			}
+			name = format[i+2 : i+2+end]
+			i += 2 + end
+		} else {
+			end := i + 1
+			for end < len(format) && isNameChar(format[end]) {
+				end++
+			}
+			name = format[i+1 : end]
+			i = end - 1
+		}
+		if len(name) == 0 {
+			return nil, fmt.Errorf("empty variable in %q", format)
+		}
+
+		if text.Len() > 0 {
+			t.segments = append(t.segments, segment{text: text.String()})
+			text.Reset()
+		}
+		t.segments = append(t.segments, segment{render: variableRenderer(name)})
+	}
+	if text.Len() > 0 {
+		t.segments = append(t.segments, segment{text: text.String()})
+	}
+	return t, nil
+}
+
+// String returns format of template
+func (t *Template) String() string {
+	return t.format
+}
+
+// Render writes record formatted by template into buf, without newline
+func (t *Template) Render(buf *bytes.Buffer, rec *Record) {
+	for _, seg := range t.segments {
+		if seg.render != nil {
+			seg.render(buf, rec)
+		} else {
+			buf.WriteString(seg.text)
+		}
+	}
+}
+
+// variableRenderer gets renderer of variable with name
+func variableRenderer(name string) renderer {
+	if render, ok := variables[name]; ok {
+		return render
+	}
+
+	if strings.HasPrefix(name, "http_") {
+		// e.g., http_user_agent => User-Agent
+		header := textproto.CanonicalMIMEHeaderKey(strings.Replace(name[5:], "_", "-", -1))
+		return func(buf *bytes.Buffer, rec *Record) {
+			writeValue(buf, rec.Header.Get(header))
+		}
+	}
+
+	return func(buf *bytes.Buffer, rec *Record) {
+		writeValue(buf, rec.Field(name))
+	}
+}
+
+// isNameChar checks whether c could be in name of variable
+func isNameChar(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// writeValue writes escaped value, or "-" if it is empty
+func writeValue(buf *bytes.Buffer, value string) {
+	if len(value) == 0 {
+		buf.WriteByte('-')
+	} else {
+		writeEscaped(buf, value)
+	}
+}
+
+// writeEscaped writes str, with control characters, '"' and '\\' escaped as
+// \xHH, like nginx
+func writeEscaped(buf *bytes.Buffer, str string) {
+	const hex = "0123456789ABCDEF"
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+		if c < 0x20 || c == 0x7f || c == '"' || c == '\\' {
+			buf.WriteString(`\x`)
+			buf.WriteByte(hex[c>>4])
+			buf.WriteByte(hex[c&0xf])
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+}
+
+// writeRequestURI writes path and query of request
+func writeRequestURI(buf *bytes.Buffer, rec *Record) {
+	writeValue(buf, rec.Path)
+	if len(rec.Query) > 0 {
+		buf.WriteByte('?')
+		writeEscaped(buf, rec.Query)
+	}
+}
+
+// writeSeconds writes d in seconds, with milliseconds, e.g., 0.012
+func writeSeconds(buf *bytes.Buffer, d time.Duration) {
+	ms := d.Milliseconds()
+	buf.Write(strconv.AppendInt(buf.AvailableBuffer(), ms/1000, 10))
+	buf.WriteByte('.')
+	frac := ms % 1000
+	buf.WriteByte(byte('0' + frac/100))
+	buf.WriteByte(byte('0' + frac/10%10))
+	buf.WriteByte(byte('0' + frac%10))
+}
+
+// keys of JSON record, which could not be used by custom fields
+var jsonKeys = map[string]bool{
+	"time": true, "remote_addr": true, "method": true, "path": true, "query": true,
+	"proto": true, "host": true, "status": true, "bytes": true, "latency": true,
+	"referer": true, "user_agent": true, "request_id": true,
+}
+
+// renderJSON writes record as JSON object into buf, without newline. Custom
+// fields with keys of JSON record are skipped.
+func renderJSON(buf *bytes.Buffer, rec *Record) {
+	buf.WriteString(`{"time":`)
+	writeJSONString(buf, rec.Time.Format(time.RFC3339Nano))
+	buf.WriteString(`,"remote_addr":`)
+	writeJSONString(buf, rec.RemoteAddr)
+	buf.WriteString(`,"method":`)
+	writeJSONString(buf, rec.Method)
+	buf.WriteString(`,"path":`)
+	writeJSONString(buf, rec.Path)
+	buf.WriteString(`,"query":`)
+	writeJSONString(buf, rec.Query)
+	buf.WriteString(`,"proto":`)
+	writeJSONString(buf, rec.Proto)
+	buf.WriteString(`,"host":`)
+	writeJSONString(buf, rec.Host)
+	buf.WriteString(`,"status":`)
+	buf.Write(strconv.AppendInt(buf.AvailableBuffer(), int64(rec.Status), 10))
+	buf.WriteString(`,"bytes":`)
+	buf.Write(strconv.AppendInt(buf.AvailableBuffer(), rec.Bytes, 10))
+	buf.WriteString(`,"latency":`)
+	writeSeconds(buf, rec.Latency)
+	buf.WriteString(`,"referer":`)
+	writeJSONString(buf, rec.Header.Get("Referer"))
+	buf.WriteString(`,"user_agent":`)
+	writeJSONString(buf, rec.Header.Get("User-Agent"))
+	if len(rec.RequestID) > 0 {
+		buf.WriteString(`,"request_id":`)
+		writeJSONString(buf, rec.RequestID)
+	}
+	for _, f := range rec.Fields {
+		if jsonKeys[f.Key] {
+			continue
+		}
+		buf.WriteByte(',')
+		writeJSONString(buf, f.Key)
+		buf.WriteByte(':')
+		writeJSONString(buf, f.Value)
+	}
+	buf.WriteByte('}')
+}
+
+// writeJSONString writes str as JSON string
+func writeJSONString(buf *bytes.Buffer, str string) {
+	data, _ := json.Marshal(str)
+	buf.Write(data)
+}
@@ -26,8 +26,11 @@ Usage:
     log.Logger.Warn("warn msg")
     log.Logger.Info("info msg")
 
-    // it is required, to work around bug of log4go
-    time.Sleep(100 * time.Millisecond)
+    // if the logger may be replaced by log.Reload(), use log.Current()
+    log.Current().Info("info msg")
+
+    // flush and close log before exit, wait for 1 second at most
+    log.CloseWithTimeout(time.Second)
 */
 package log
 
@@ -38,15 +41,38 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/baidu/go-lib/log/log4go"
 )
 
 // Logger is global logger
+//
+// Logger is replaced by Reload() and EnableTail(). If they are used, Logger
+// must not be read directly while they may be called; use Current() instead.
 var Logger log4go.Logger
 var initialized bool = false
 var mutex sync.Mutex
 
+// current is the global logger, replaced atomically, see Current()
+var current atomic.Pointer[log4go.Logger]
+
+// Current returns the global logger. It is safe to call while Logger is
+// being replaced by Reload() or EnableTail().
+func Current() log4go.Logger {
+	if logger := current.Load(); logger != nil {
+		return *logger
+	}
+	return Logger
+}
+
+// setLogger replaces the global logger. It should be called with mutex held.
+func setLogger(logger log4go.Logger) {
+	Logger = logger
+	current.Store(&logger)
+}
+
 // logDirCreate checks and creates dir if nonexist
 func logDirCreate(logDir string) error {
 	if _, err := os.Stat(logDir); os.IsNotExist(err) {
@@ -101,6 +127,24 @@ func stringToLevel(str string) log4go.LevelType {
 	return level
 }
 
+// newSvrWriter creates writer for remote log server
+func newSvrWriter(name string, network string, svrAddr string, format string) (log4go.LogWriter, error) {
+	switch strings.ToLower(network) {
+	case "tcp", "tcp4", "tcp6", "tls":
+		logWriter := log4go.NewStreamWriter(name, network, svrAddr, format)
+		if logWriter == nil {
+			return nil, fmt.Errorf("error in log4go.NewStreamWriter(%s, %s)", name, svrAddr)
+		}
+		return logWriter, nil
+	default:
+		logWriter := log4go.NewPacketWriter(name, network, svrAddr, format)
+		if logWriter == nil {
+			return nil, fmt.Errorf("error in log4go.NewPacketWriter(%s, %s)", name, svrAddr)
+		}
+		return logWriter, nil
+	}
+}
+
 // Init initializes log lib
 //
 // PARAMS:
@@ -124,11 +168,11 @@ func Init(progName string, levelStr string, logDir string,
 		return errors.New("Initialized Already")
 	}
 
-	var err error
-	Logger, err = Create(progName, levelStr, logDir, hasStdOut, when, backupCount)
+	logger, err := Create(progName, levelStr, logDir, hasStdOut, when, backupCount)
 	if err != nil {
 		return err
 	}
+	setLogger(logger)
 
 	initialized = true
 	return nil
@@ -150,7 +194,7 @@ func Init(progName string, levelStr string, logDir string,
 //       backupCount files are kept - the oldest ones are deleted.
 func Create(progName string, levelStr string, logDir string,
 	hasStdOut bool, when string, backupCount int) (log4go.Logger, error) {
-	return create(progName, levelStr, logDir, hasStdOut, when, backupCount, false)
+	return create(progName, levelStr, logDir, hasStdOut, when, backupCount, false, 0, 0)
 }
 
 // InitWithLogSvr initializes log lib with remote log server
@@ -159,7 +203,8 @@ func Create(progName string, levelStr string, logDir string,
 //   - progName: program name.
 //   - levelStr: "DEBUG", "TRACE", "INFO", "WARNING", "ERROR", "CRITICAL"
 //   - loggerName: logger name
-//   - network: using "udp" or "unixgram"
+//   - network: using "udp" or "unixgram", or "tcp" or "tls" for stream
+//       connection, which reconnects and buffers log while disconnected
 //   - svrAddr: remote unix sock address for all logger
 //   - svrAddrWf: remote unix sock address for warn/fatal logger
 //                If svrAddrWf is empty string, no warn/fatal logger will be created.
@@ -167,6 +212,9 @@ func Create(progName string, levelStr string, logDir string,
 func InitWithLogSvr(progName string, levelStr string, loggerName string,
 	network string, svrAddr string, svrAddrWf string,
 	hasStdOut bool) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
 	if initialized {
 		return errors.New("Initialized Already")
 	}
@@ -185,22 +233,22 @@ func InitWithLogSvr(progName string, levelStr string, loggerName string,
 	/* create file writer for all log   */
 	name := fmt.Sprintf("%s_%s", progName, loggerName)
 
-	logWriter := log4go.NewPacketWriter(name, network, svrAddr, log4go.LogFormat)
-	if logWriter == nil {
-		return fmt.Errorf("error in log4go.NewPacketWriter(%s)", name)
+	logWriter, err := newSvrWriter(name, network, svrAddr, log4go.LogFormat)
+	if err != nil {
+		return err
 	}
 	Logger.AddFilter("log", level, logWriter)
 
 	if len(svrAddrWf) > 0 {
 		/* create file writer for warning and fatal log */
-		logWriterWf := log4go.NewPacketWriter(name+".wf", network, svrAddrWf, log4go.LogFormat)
-		if logWriterWf == nil {
-			return fmt.Errorf("error in log4go.NewPacketWriter(%s, %s)",
-				name, svrAddr)
+		logWriterWf, err := newSvrWriter(name+".wf", network, svrAddrWf, log4go.LogFormat)
+		if err != nil {
+			return err
 		}
 		Logger.AddFilter("log_wf", log4go.WARNING, logWriterWf)
 	}
 
+	setLogger(Logger)
 	initialized = true
 	return nil
 }
@@ -229,57 +277,217 @@ func InitWithCompress(progName string, levelStr string, logDir string,
 		return errors.New("Initialized Already")
 	}
 
-	var err error
-	Logger, err = create(progName, levelStr, logDir, hasStdOut, when, backupCount, enableCompress)
+	logger, err := create(progName, levelStr, logDir, hasStdOut, when, backupCount, enableCompress, 0, 0)
 	if err != nil {
 		return err
 	}
+	setLogger(logger)
+
+	initialized = true
+	return nil
+}
+
+// InitWithRetention initializes log lib, with retention policies for backups
+//
+// PARAMS:
+//   - progName: program name. Name of log file will be progName.log
+//   - levelStr: "DEBUG", "TRACE", "INFO", "WARNING", "ERROR", "CRITICAL"
+//   - logDir: directory for log. It will be created if noexist
+//   - hasStdOut: whether to have stdout output
+//   - when:
+//       "M", minute
+//       "H", hour
+//       "D", day
+//       "MIDNIGHT", roll over at midnight
+//   - backupCount: If backupCount is > 0, when rollover is done, no more than
+//       backupCount files are kept - the oldest ones are deleted.
+//   - enableCompress: whether to compress the roll over log file
+//   - maxBackupSize: If maxBackupSize is > 0, when rollover is done, the oldest
+//       backups are deleted until total bytes of backups is no more than maxBackupSize.
+//   - maxBackupAge: If maxBackupAge is > 0, when rollover is done, backups
+//       older than maxBackupAge are deleted.
+func InitWithRetention(progName string, levelStr string, logDir string,
+	hasStdOut bool, when string, backupCount int, enableCompress bool,
+	maxBackupSize int64, maxBackupAge time.Duration) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if initialized {
+		return errors.New("Initialized Already")
+	}
+
+	logger, err := create(progName, levelStr, logDir, hasStdOut, when, backupCount, enableCompress,
+		maxBackupSize, maxBackupAge)
+	if err != nil {
+		return err
+	}
+	setLogger(logger)
 
 	initialized = true
 	return nil
 }
 
 func create(progName string, levelStr string, logDir string,
-	hasStdOut bool, when string, backupCount int, enableCompress bool) (log4go.Logger, error) {
+	hasStdOut bool, when string, backupCount int, enableCompress bool,
+	maxBackupSize int64, maxBackupAge time.Duration) (log4go.Logger, error) {
+	opts := Options{
+		Level:          levelStr,
+		LogDir:         logDir,
+		HasStdOut:      hasStdOut,
+		When:           when,
+		BackupCount:    backupCount,
+		EnableCompress: enableCompress,
+		MaxBackupSize:  maxBackupSize,
+		MaxBackupAge:   maxBackupAge,
+		WithWf:         true,
+	}
+	return newLogger(progName, opts)
+}
+
+// newLogger creates logger by options. Names of log files are progName.log
+// and progName.wf.log
+func newLogger(progName string, opts Options) (log4go.Logger, error) {
+	format := opts.Format
+	if len(format) == 0 {
+		format = log4go.LogFormat
+	}
+
 	/* check when   */
-	if !log4go.WhenIsValid(when) {
-		return nil, fmt.Errorf("invalid value of when: %s", when)
+	if len(opts.LogDir) > 0 && !log4go.WhenIsValid(opts.When) {
+		return nil, fmt.Errorf("invalid value of when: %s", opts.When)
 	}
 
 	/* check, and create dir if nonexist    */
-	if err := logDirCreate(logDir); err != nil {
-		log4go.Error("Init(), in logDirCreate(%s)", logDir)
-		return nil, err
+	if len(opts.LogDir) > 0 {
+		if err := logDirCreate(opts.LogDir); err != nil {
+			log4go.Error("Init(), in logDirCreate(%s)", opts.LogDir)
+			return nil, err
+		}
 	}
 
 	/* convert level from string to log4go level    */
-	level := stringToLevel(levelStr)
+	level := stringToLevel(opts.Level)
 
 	/* create logger    */
 	logger := make(log4go.Logger)
+	fileOpts := log4go.TimeFileOptions{
+		MaxBackupSize: opts.MaxBackupSize,
+		MaxBackupAge:  opts.MaxBackupAge,
+	}
 
 	/* create writer for stdout */
-	if hasStdOut {
+	if opts.HasStdOut {
 		logger.AddFilter("stdout", level, log4go.NewConsoleLogWriter())
 	}
 
-	/* create file writer for all log   */
-	fileName := filenameGen(progName, logDir, false)
-	logWriter := log4go.NewTimeFileLogWriter(fileName, when, backupCount, enableCompress)
-	if logWriter == nil {
-		return nil, fmt.Errorf("error in log4go.NewTimeFileLogWriter(%s)", fileName)
+	if len(opts.LogDir) > 0 {
+		/* create file writer for all log   */
+		fileName := filenameGen(progName, opts.LogDir, false)
+		logWriter := log4go.NewTimeFileLogWriterWithOptions(fileName, opts.When, opts.BackupCount, opts.EnableCompress,
+			fileOpts)
+		if logWriter == nil {
+			logger.Close()
+			return nil, fmt.Errorf("error in log4go.NewTimeFileLogWriter(%s)", fileName)
+		}
+		logWriter.SetFormat(format)
+		logger.AddFilter("log", level, logWriter)
 	}
-	logWriter.SetFormat(log4go.LogFormat)
-	logger.AddFilter("log", level, logWriter)
-
-	/* create file writer for warning and fatal log */
-	fileNameWf := filenameGen(progName, logDir, true)
-	logWriter = log4go.NewTimeFileLogWriter(fileNameWf, when, backupCount, enableCompress)
-	if logWriter == nil {
-		return nil, fmt.Errorf("error in log4go.NewTimeFileLogWriter(%s)", fileNameWf)
+
+	if len(opts.LogDir) > 0 && opts.WithWf {
+		/* create file writer for warning and fatal log */
+		fileNameWf := filenameGen(progName, opts.LogDir, true)
+		logWriter := log4go.NewTimeFileLogWriterWithOptions(fileNameWf, opts.When, opts.BackupCount, opts.EnableCompress,
+			fileOpts)
+		if logWriter == nil {
+			logger.Close()
+			return nil, fmt.Errorf("error in log4go.NewTimeFileLogWriter(%s)", fileNameWf)
+		}
+		logWriter.SetFormat(format)
+		logger.AddFilter("log_wf", log4go.WARNING, logWriter)
+	}
+
+	/* create writer for remote log server  */
+	if len(opts.SvrAddr) > 0 {
+		svrWriter, err := newSvrWriter(progName, opts.Network, opts.SvrAddr, format)
+		if err != nil {
+			logger.Close()
+			return nil, err
+		}
+		logger.AddFilter("svr", level, svrWriter)
 	}
-	logWriter.SetFormat(log4go.LogFormat)
-	logger.AddFilter("log_wf", log4go.WARNING, logWriter)
 
 	return logger, nil
 }
+
+// SetLevel changes level of filter in Logger at runtime
+//
+// PARAMS:
+//   - filterName: name of filter, e.g., "stdout", "log", "log_wf"
+//   - levelStr: "DEBUG", "TRACE", "INFO", "WARNING", "ERROR", "CRITICAL"
+func SetLevel(filterName string, levelStr string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	logger := Current()
+	if logger == nil {
+		return errors.New("log is not initialized")
+	}
+
+	level, err := log4go.ParseLevel(levelStr)
+	if err != nil {
+		return err
+	}
+	return logger.SetLevel(filterName, level)
+}
+
+// SetModuleLevel changes level of named module (see log4go.Logger.Named)
+//
+// PARAMS:
+//   - name: name of module, e.g., "bfe.route"
+//   - levelStr: "DEBUG", "TRACE", "INFO", "WARNING", "ERROR", "CRITICAL"
+func SetModuleLevel(name string, levelStr string) error {
+	level, err := log4go.ParseLevel(levelStr)
+	if err != nil {
+		return err
+	}
+	log4go.SetModuleLevel(name, level)
+	return nil
+}
+
+// GetLevels gets level of each filter in Logger, e.g., {"log": "INFO"}
+func GetLevels() map[string]string {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	levels := make(map[string]string)
+	for name, level := range Current().Levels() {
+		levels[name] = level.Name()
+	}
+	return levels
+}
+
+// CloseWithTimeout flushes and closes Logger within the given time
+//
+// Records which could not be written in time are reported in the returned
+// error (see log4go.FlushError).
+//
+// Old loggers replaced by Reload(), and named loggers registered by
+// Register() are also closed within the time.
+func CloseWithTimeout(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	var err error
+	if logger := Current(); logger != nil {
+		err = logger.Shutdown(timeout)
+	}
+	if werr := waitForClosing(time.Until(deadline)); err == nil {
+		err = werr
+	}
+	if rerr := closeRegistry(time.Until(deadline)); err == nil {
+		err = rerr
+	}
+	return err
+}
@@ -0,0 +1,530 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// audit implements tamper-evident log files, by hash chain of records
+/*
+Usage:
+    // each record is followed by chain value, HMAC-SHA256 with key
+    w := log4go.NewTimeFileLogWriterWithOptions("./log/audit.log", "D", 30, true,
+        log4go.TimeFileOptions{Audit: true, AuditKey: key})
+    if w == nil {
+        return errors.New("could not create audit log")
+    }
+    logger.AddFilter("audit", log4go.INFO, w)
+
+    // verify the log file and its backups (plain or compressed)
+    report, err := log4go.VerifyAuditLog("./log/audit.log", key)
+    if err != nil {
+        return err
+    }
+    for _, issue := range report.Issues {
+        fmt.Println(issue)
+    }
+
+Each record is written as:
+    <record> #chain=<hex of chain value>
+
+Chain value of a record is HMAC-SHA256 (with key) or SHA-256 (without key)
+of the chain value of the previous record and the record itself, without
+the trailing newline. The chain of each file starts from a seed, which is
+the final chain value of the previous file, or random for the first file.
+
+Seed and final chain value of each file are recorded in a sidecar manifest
+in JSON, e.g., audit.log.2019-05-01.manifest for backup audit.log.2019-05-01
+(and audit.log.2019-05-01.tar.gz after compressed), audit.log.manifest for
+the current file. With key, manifests are signed by HMAC.
+
+The verifier detects modified, deleted or reordered records within a file,
+and deleted or reordered files. Without key, anyone could rewrite the chain,
+so only use SHA-256 for detecting accidental changes.
+
+Audit chain could not be used with binary frames (see SetBinaryFrame), since
+chain value appended to a frame breaks both formats.
+*/
+
+package log4go
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	AUDIT_CHAIN_MARK      = " #chain="    // separator between record and chain value
+	AUDIT_MANIFEST_SUFFIX = ".manifest"   // suffix of manifest of log file
+	AUDIT_SHA256          = "sha256"      // algorithm of chain without key
+	AUDIT_HMAC_SHA256     = "hmac-sha256" // algorithm of chain with key
+)
+
+// length of chain value in hex
+const auditValueLen = 2 * sha256.Size
+
+// AuditManifest is the manifest of a log file with hash chain
+type AuditManifest struct {
+	File      string    `json:"file"`      // base name of log file
+	Algorithm string    `json:"algorithm"` // AUDIT_SHA256 or AUDIT_HMAC_SHA256
+	Seed      string    `json:"seed"`      // chain value before the first record, in hex
+	Final     string    `json:"final"`     // chain value of the last record, in hex
+	Records   int64     `json:"records"`   // number of records in chain
+	Offset    int64     `json:"offset"`    // size of data before the chain, which is not verified
+	Rotated   bool      `json:"rotated"`   // whether the file is rotated, no more record is written
+	Start     time.Time `json:"start"`     // time when the chain starts
+	End       time.Time `json:"end"`       // time when the manifest is written
+	MAC       string    `json:"mac,omitempty"`
+}
+
+// AuditManifestName gets name of manifest for log file (plain or compressed)
+func AuditManifestName(filename string) string {
+	for _, suffix := range compressSuffixes() {
+		if strings.HasSuffix(filename, suffix) {
+			filename = strings.TrimSuffix(filename, suffix)
+			break
+		}
+	}
+	return filename + AUDIT_MANIFEST_SUFFIX
+}
+
+// newAuditHash creates hash of chain for algorithm
+func newAuditHash(algorithm string, key []byte) (hash.Hash, error) {
+	switch algorithm {
+	case AUDIT_SHA256:
+		return sha256.New(), nil
+	case AUDIT_HMAC_SHA256:
+		if len(key) == 0 {
+			return nil, errors.New("key is required for " + AUDIT_HMAC_SHA256)
+		}
+		return hmac.New(sha256.New, key), nil
+	default:
+		return nil, fmt.Errorf("unknown algorithm of audit chain: %s", algorithm)
+	}
+}
+
+// chainValue computes chain value of record, by chain value of the previous
+// record. The result is appended to dst.
+func chainValue(h hash.Hash, dst []byte, prev []byte, record []byte) []byte {
+	h.Reset()
+	h.Write(prev)
+	h.Write(record)
+	return h.Sum(dst)
+}
+
+// sign computes MAC of manifest with key
+func (m *AuditManifest) sign(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s|%s|%s|%d|%d|%t", m.Algorithm, m.Seed, m.Final, m.Records, m.Offset, m.Rotated)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// writeAuditManifest writes manifest to file, signed with key if not empty
+func writeAuditManifest(name string, m *AuditManifest, key []byte) error {
+	m.MAC = ""
+	if len(key) > 0 {
+		m.MAC = m.sign(key)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to temporary file and rename, so the manifest is never partial
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// ReadAuditManifest reads manifest from file
+func ReadAuditManifest(name string) (*AuditManifest, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	m := new(AuditManifest)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("parse %s: %s", name, err)
+	}
+	return m, nil
+}
+
+/****** writer ******/
+
+// auditChain is the hash chain of TimeFileLogWriter
+type auditChain struct {
+	key      []byte
+	hash     hash.Hash
+	value    []byte        // chain value of the last record written
+	manifest AuditManifest // manifest of current file
+
+	// records chained in buffer, not written yet (see commit)
+	next     []byte // chain value of the last record in buffer
+	buffered int64  // number of records in buffer
+}
+
+// initAuditChain enables hash chain of records, before the writer starts.
+// Chain value is HMAC-SHA256 with key, or SHA-256 if key is empty.
+//
+// If the current file has a manifest, the chain is resumed after verifying
+// the file; issues found are printed to stderr.
+func (w *TimeFileLogWriter) initAuditChain(key []byte) error {
+	algorithm := AUDIT_SHA256
+	if len(key) > 0 {
+		algorithm = AUDIT_HMAC_SHA256
+	}
+	h, _ := newAuditHash(algorithm, key)
+	c := &auditChain{key: key, hash: h}
+	c.manifest.Algorithm = algorithm
+
+	if err := w.resumeAuditChain(c); err != nil {
+		return err
+	}
+	w.audit = c
+	return w.syncAudit()
+}
+
+// resumeAuditChain resumes chain of current file if it has manifest, or
+// starts chain from final chain value of the last backup
+func (w *TimeFileLogWriter) resumeAuditChain(c *auditChain) error {
+	name := AuditManifestName(w.baseFilename)
+	m, err := ReadAuditManifest(name)
+	if err == nil && m.Algorithm == c.manifest.Algorithm && !m.Rotated {
+		report := &AuditReport{}
+		if len(c.key) > 0 && !hmac.Equal([]byte(m.MAC), []byte(m.sign(c.key))) {
+			report.addIssue(w.baseFilename, 0, "invalid MAC of manifest")
+		}
+		value, records, err := verifyAuditFile(w.baseFilename, m, c.key, nil, report)
+		if err == nil && value != nil {
+			for _, issue := range report.Issues {
+				fmt.Fprintf(os.Stderr, "TimeFileLogWriter(%q): %s\n", w.filename, issue)
+			}
+			c.value = value
+			c.manifest = *m
+			c.manifest.Records = records
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "TimeFileLogWriter(%q): %s\n", w.filename, err)
+		}
+	}
+
+	// seed of chain
+	seed := make([]byte, sha256.Size)
+	if m != nil && len(m.Final) == auditValueLen {
+		hex.Decode(seed, []byte(m.Final))
+	} else if last := w.lastAuditManifest(); last != nil && len(last.Final) == auditValueLen {
+		hex.Decode(seed, []byte(last.Final))
+	} else if _, err := rand.Read(seed); err != nil {
+		return err
+	}
+
+	c.startFile(seed, w.curSize)
+	return nil
+}
+
+// lastAuditManifest gets manifest of the newest backup, or nil
+func (w *TimeFileLogWriter) lastAuditManifest() *AuditManifest {
+	files, _ := logFiles(w.baseFilename)
+	for i := len(files) - 1; i >= 0; i-- {
+		if files[i] == w.baseFilename {
+			continue
+		}
+		m, _ := ReadAuditManifest(AuditManifestName(files[i]))
+		return m
+	}
+	return nil
+}
+
+// startFile starts chain of a new file from seed, offset is size of data
+// in the file before the chain
+func (c *auditChain) startFile(seed []byte, offset int64) {
+	c.value = append(c.value[:0], seed...)
+	c.manifest = AuditManifest{
+		Algorithm: c.manifest.Algorithm,
+		Seed:      hex.EncodeToString(seed),
+		Offset:    offset,
+		Start:     time.Now(),
+	}
+}
+
+// chainRecord appends chain value to the record formatted in buf from off.
+// The chain moves only after buf is written, see commit and rollback.
+func (c *auditChain) chainRecord(buf *batchBuffer, off int) {
+	record := buf.Bytes()[off:]
+	if n := len(record); n > 0 && record[n-1] == '\n' {
+		record = record[:n-1]
+		buf.Truncate(buf.Len() - 1)
+	}
+
+	prev := c.value
+	if c.buffered > 0 {
+		prev = c.next
+	}
+	c.next = chainValue(c.hash, c.next[:0], prev, record)
+	c.buffered++
+
+	buf.WriteString(AUDIT_CHAIN_MARK)
+	buf.Write(hex.AppendEncode(buf.AvailableBuffer(), c.next))
+	buf.WriteByte('\n')
+}
+
+// commit moves the chain to the last record in buffer, after it is written
+func (c *auditChain) commit() {
+	if c.buffered == 0 {
+		return
+	}
+	c.value = append(c.value[:0], c.next...)
+	c.manifest.Records += c.buffered
+	c.buffered = 0
+}
+
+// rollback discards records in buffer which fail to be written, the chain
+// continues from the last record written
+func (c *auditChain) rollback() {
+	c.buffered = 0
+}
+
+// syncAudit writes manifest of current file
+func (w *TimeFileLogWriter) syncAudit() error {
+	m := &w.audit.manifest
+	m.File = filepath.Base(w.baseFilename)
+	m.Final = hex.EncodeToString(w.audit.value)
+	m.End = time.Now()
+	return writeAuditManifest(AuditManifestName(w.baseFilename), m, w.audit.key)
+}
+
+// rotateAudit writes manifest of backup (if not empty), and starts chain
+// of current file from final chain value of the backup
+func (w *TimeFileLogWriter) rotateAudit(backup string) {
+	if len(backup) > 0 {
+		m := w.audit.manifest
+		m.File = filepath.Base(backup)
+		m.Final = hex.EncodeToString(w.audit.value)
+		m.Rotated = true
+		m.End = time.Now()
+		if err := writeAuditManifest(AuditManifestName(backup), &m, w.audit.key); err != nil {
+			fmt.Fprintf(os.Stderr, "TimeFileLogWriter(%q): %s\n", w.filename, err)
+		}
+	}
+
+	w.audit.startFile(w.audit.value, w.curSize)
+	if err := w.syncAudit(); err != nil {
+		fmt.Fprintf(os.Stderr, "TimeFileLogWriter(%q): %s\n", w.filename, err)
+	}
+}
+
+/****** verifier ******/
+
+// AuditIssue is an issue found in audit log
+type AuditIssue struct {
+	File   string // log file
+	Record int64  // index of record in chain of the file, from 1; 0 for issue of the file
+	Reason string
+}
+
+func (i AuditIssue) String() string {
+	if i.Record == 0 {
+		return fmt.Sprintf("%s: %s", i.File, i.Reason)
+	}
+	return fmt.Sprintf("%s: record %d: %s", i.File, i.Record, i.Reason)
+}
+
+// AuditReport is result of verifying audit log
+type AuditReport struct {
+	Files   int          // number of files verified
+	Records int64        // number of records verified
+	Issues  []AuditIssue // issues found
+}
+
+// OK checks whether no issue is found
+func (r *AuditReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// Err returns issues as error, or nil if no issue is found
+func (r *AuditReport) Err() error {
+	if r.OK() {
+		return nil
+	}
+	errs := make([]error, 0, len(r.Issues))
+	for _, issue := range r.Issues {
+		errs = append(errs, errors.New(issue.String()))
+	}
+	return errors.Join(errs...)
+}
+
+func (r *AuditReport) addIssue(file string, record int64, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, AuditIssue{File: file, Record: record, Reason: fmt.Sprintf(format, args...)})
+}
+
+// VerifyAuditLog verifies log file written with hash chain (see
+// TimeFileOptions.Audit), and its backups (plain or compressed)
+//
+// PARAMS:
+//   - filename: name of log file, e.g., "./log/audit.log"
+//   - key: key of HMAC, nil for SHA-256
+func VerifyAuditLog(filename string, key []byte) (*AuditReport, error) {
+	files, err := logFiles(filename)
+	if err != nil {
+		return nil, err
+	}
+	return VerifyAuditFiles(key, files...)
+}
+
+// VerifyAuditFiles verifies log files written with hash chain, in order of
+// rotation. Error is returned if any file could not be read; issues of
+// records, files and manifests are in the report.
+//
+// PARAMS:
+//   - key: key of HMAC, nil for SHA-256
+//   - files: log files, from the oldest to the newest
+func VerifyAuditFiles(key []byte, files ...string) (*AuditReport, error) {
+	report := &AuditReport{}
+	var prev []byte // final chain value of the previous file
+	for _, file := range files {
+		report.Files++
+
+		m, err := ReadAuditManifest(AuditManifestName(file))
+		if err != nil {
+			report.addIssue(file, 0, "invalid manifest: %s", err)
+			prev = nil
+			continue
+		}
+		if len(key) > 0 && !hmac.Equal([]byte(m.MAC), []byte(m.sign(key))) {
+			report.addIssue(file, 0, "invalid MAC of manifest")
+		}
+
+		if _, _, err := verifyAuditFile(file, m, key, prev, report); err != nil {
+			return report, err
+		}
+		prev, _ = hex.DecodeString(m.Final)
+	}
+	return report, nil
+}
+
+// verifyAuditFile verifies records of file by its manifest m. If prev is not
+// nil, seed of the file should be prev. Issues are added to report. It
+// returns chain value of the last record, and number of records.
+func verifyAuditFile(file string, m *AuditManifest, key []byte, prev []byte,
+	report *AuditReport) ([]byte, int64, error) {
+	h, err := newAuditHash(m.Algorithm, key)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %s", file, err)
+	}
+	seed, err := hex.DecodeString(m.Seed)
+	if err != nil || len(seed) != sha256.Size {
+		report.addIssue(file, 0, "invalid seed in manifest: %q", m.Seed)
+		return nil, 0, nil
+	}
+	final, err := hex.DecodeString(m.Final)
+	if err != nil {
+		report.addIssue(file, 0, "invalid final chain value in manifest: %q", m.Final)
+	}
+	if prev != nil && !bytes.Equal(seed, prev) {
+		report.addIssue(file, 0, "seed does not match the previous file, files are missing or reordered")
+	}
+
+	reader, closeFn, err := openLogFile(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer closeFn()
+
+	// data before the chain
+	br := bufio.NewReader(reader)
+	if n, err := io.CopyN(ioutil.Discard, br, m.Offset); err != nil {
+		if err != io.EOF && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, 0, fmt.Errorf("read %s: %s", file, err)
+		}
+		report.addIssue(file, 0, "file is shorter than offset %d of chain: %d", m.Offset, n)
+	}
+
+	value := append([]byte(nil), seed...)
+	if m.Records == 0 && final != nil && !bytes.Equal(value, final) {
+		report.addIssue(file, 0, "final chain value does not match manifest")
+	}
+
+	var records int64
+	var pending []byte // data of record not ended by chain value
+	want := make([]byte, 0, sha256.Size)
+	stored := make([]byte, sha256.Size)
+	for {
+		line, err := br.ReadSlice('\n')
+		pending = append(pending, line...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && err != io.EOF && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, 0, fmt.Errorf("read %s: %s", file, err)
+		}
+
+		if record, ok := splitAuditRecord(pending, stored); ok {
+			records++
+			want = chainValue(h, want[:0], value, record)
+			if !bytes.Equal(want, stored) {
+				report.addIssue(file, records, "chain value mismatch, record is modified, or records before it are deleted or reordered")
+			}
+			// continue from the stored value, so only changed records are reported
+			value = append(value[:0], stored...)
+
+			if records == m.Records && final != nil && !bytes.Equal(value, final) {
+				report.addIssue(file, records, "final chain value does not match manifest")
+			}
+			pending = pending[:0]
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	report.Records += records
+	if len(pending) > 0 {
+		report.addIssue(file, records+1, "data without chain value at end of file")
+	}
+	if records < m.Records {
+		report.addIssue(file, 0, "%d records in manifest, but %d found", m.Records, records)
+	} else if records > m.Records && m.Rotated {
+		report.addIssue(file, m.Records+1, "records are appended after the file is rotated")
+	}
+	return value, records, nil
+}
+
+// splitAuditRecord splits data ended with chain value to record and chain
+// value, which is decoded into value
+func splitAuditRecord(data []byte, value []byte) ([]byte, bool) {
+	// record, mark, chain value and newline
+	n := len(data) - auditValueLen - 1
+	if n < len(AUDIT_CHAIN_MARK) || data[len(data)-1] != '\n' ||
+		string(data[n-len(AUDIT_CHAIN_MARK):n]) != AUDIT_CHAIN_MARK {
+		return nil, false
+	}
+	if _, err := hex.Decode(value, data[n:n+auditValueLen]); err != nil {
+		return nil, false
+	}
+	return data[:n-len(AUDIT_CHAIN_MARK)], true
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log4go
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeAuditLog writes records to audit log, with backups rotated by size
+func writeAuditLog(t *testing.T, fname string, key []byte, from int, to int) {
+	w := NewTimeFileLogWriterWithOptions(fname, "D", 0, false, TimeFileOptions{Audit: true, AuditKey: key})
+	if w == nil {
+		t.Fatalf("NewTimeFileLogWriterWithOptions() failed")
+	}
+	w.SetFormat("%L %M").SetRotateSize(300)
+
+	l := make(Logger)
+	l.AddFilter("audit", INFO, w)
+	for i := from; i < to; i++ {
+		l.Info("user %d logged in\nfrom 10.0.0.%d", i, i)
+	}
+	l.Close()
+}
+
+// verifyAuditLog verifies audit log, and returns issues
+func verifyAuditLog(t *testing.T, fname string, key []byte) []string {
+	report, err := VerifyAuditLog(fname, key)
+	if err != nil {
+		t.Fatalf("VerifyAuditLog(): %s", err)
+	}
+	issues := make([]string, 0, len(report.Issues))
+	for _, issue := range report.Issues {
+		issues = append(issues, issue.String())
+	}
+	return issues
+}
+
+// editFile changes content of file by edit, and returns function restoring it
+func editFile(t *testing.T, fname string, edit func(lines []string) []string) func() {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatalf("ReadFile(): %s", err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if err := ioutil.WriteFile(fname, []byte(strings.Join(edit(lines), "")), 0644); err != nil {
+		t.Fatalf("WriteFile(): %s", err)
+	}
+	return func() {
+		ioutil.WriteFile(fname, data, 0644)
+	}
+}
+
+func TestAuditChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	key := []byte("secret key")
+	fname := filepath.Join(dir, "audit.log")
+	writeAuditLog(t, fname, key, 0, 10)
+	// chain is resumed after restart
+	writeAuditLog(t, fname, key, 10, 20)
+
+	files, err := logFiles(fname)
+	if err != nil || len(files) < 4 {
+		t.Fatalf("got files %v, error %v", files, err)
+	}
+	if err := compressArchiveFile(files[0], tarGzipCodec{}); err != nil {
+		t.Fatalf("compressArchiveFile(): %s", err)
+	}
+	files[0] += COMPRESS_SUFFIX
+
+	report, err := VerifyAuditLog(fname, key)
+	if err != nil || !report.OK() || report.Records != 20 || report.Files != len(files) {
+		t.Fatalf("got report %+v, error %v", report, err)
+	}
+	data, _ := ioutil.ReadFile(files[1])
+	if !bytes.HasPrefix(data, []byte("INFO user ")) || !bytes.Contains(data, []byte("\nfrom 10.0.0.")) {
+		t.Errorf("unexpected content %q", data)
+	}
+
+	// records modified, deleted and reordered
+	edits := map[string]func(lines []string) []string{
+		"modified": func(lines []string) []string {
+			lines[0] = strings.Replace(lines[0], "user", "root", 1)
+			return lines
+		},
+		"deleted": func(lines []string) []string {
+			return append(lines[:0], lines[2:]...)
+		},
+		"reordered": func(lines []string) []string {
+			lines[0], lines[1], lines[2], lines[3] = lines[2], lines[3], lines[0], lines[1]
+			return lines
+		},
+		"truncated": func(lines []string) []string {
+			return lines[:len(lines)-3]
+		},
+		"appended": func(lines []string) []string {
+			return append(lines, lines[len(lines)-3:]...)
+		},
+	}
+	for name, edit := range edits {
+		restore := editFile(t, files[1], edit)
+		issues := verifyAuditLog(t, fname, key)
+		if len(issues) == 0 || !strings.HasPrefix(issues[0], files[1]) {
+			t.Errorf("%s: got issues %v", name, issues)
+		}
+		restore()
+	}
+
+	// records in the current file is modified
+	restore := editFile(t, fname, func(lines []string) []string {
+		lines[1] = "from 10.0.0.100" + lines[1][len("from 10.0.0.1x"):]
+		return lines
+	})
+	if issues := verifyAuditLog(t, fname, key); len(issues) != 1 || !strings.Contains(issues[0], "record 1") {
+		t.Errorf("got issues %v", issues)
+	}
+	restore()
+
+	// file deleted
+	os.Rename(files[2], files[2]+".bak")
+	if issues := verifyAuditLog(t, fname, key); len(issues) != 1 || !strings.Contains(issues[0], "seed does not match") {
+		t.Errorf("got issues %v", issues)
+	}
+	os.Rename(files[2]+".bak", files[2])
+
+	// manifest is forged, or key is wrong
+	m, _ := ReadAuditManifest(AuditManifestName(files[0]))
+	m.Records--
+	writeAuditManifest(AuditManifestName(files[0]), m, nil)
+	if issues := verifyAuditLog(t, fname, key); len(issues) == 0 || !strings.Contains(issues[0], "invalid MAC") {
+		t.Errorf("got issues %v", issues)
+	}
+	if issues := verifyAuditLog(t, fname, []byte("wrong key")); len(issues) < 20 {
+		t.Errorf("got issues %v", issues)
+	}
+	if _, err := VerifyAuditLog(fname, nil); err == nil {
+		t.Errorf("key should be required")
+	}
+}
+
+func TestAuditChainConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fname := filepath.Join(dir, "audit.log")
+	config := fmt.Sprintf(`{"filters": [{"tag": "audit", "type": "timefile", "level": "INFO",
+		"properties": {"filename": %q, "format": "%%M", "audit": true}}]}`, fname)
+	cfg, err := ParseConfig([]byte(config), CONFIG_JSON)
+	if err != nil {
+		t.Fatalf("ParseConfig(): %s", err)
+	}
+	l, err := cfg.Build()
+	if err != nil {
+		t.Fatalf("Build(): %s", err)
+	}
+	l.Info("hello")
+	l.Info("world")
+	l.Close()
+
+	report, err := VerifyAuditLog(fname, nil)
+	if err != nil || !report.OK() || report.Records != 2 {
+		t.Errorf("got report %+v, error %v", report, err)
+	}
+
+	config = `{"filters": [{"tag": "audit", "type": "timefile", "level": "INFO",
+		"properties": {"filename": "a.log", "auditkeyfile": "key"}}]}`
+	if _, err := ParseConfig([]byte(config), CONFIG_JSON); err == nil {
+		t.Errorf("auditkeyfile without audit should fail")
+	}
+
+	// audit chain could not be used with binary frame
+	config = `{"filters": [{"tag": "audit", "type": "timefile", "level": "INFO",
+		"properties": {"filename": "a.log", "audit": true, "binaryframe": true}}]}`
+	if _, err := ParseConfig([]byte(config), CONFIG_JSON); err == nil {
+		t.Errorf("audit with binaryframe should fail")
+	}
+	opts := TimeFileOptions{Audit: true, BinaryFrame: true}
+	if w := NewTimeFileLogWriterWithOptions(fname, "D", 0, false, opts); w != nil {
+		t.Errorf("audit with binary frame should fail")
+	}
+	w := NewTimeFileLogWriterWithOptions(fname, "D", 0, false, TimeFileOptions{Audit: true})
+	if w.SetBinaryFrame(true); w.binaryFrame {
+		t.Errorf("binary frame should not be enabled with audit chain")
+	}
+	w.Close()
+}
+
+// chain moves only after records are written
+func TestAuditChainRollback(t *testing.T) {
+	seed := bytes.Repeat([]byte{1}, sha256.Size)
+	c := &auditChain{hash: sha256.New()}
+	c.startFile(seed, 0)
+
+	// records failed to be written
+	var buf batchBuffer
+	for _, record := range []string{"a\n", "b\n"} {
+		n := buf.Len()
+		buf.WriteString(record)
+		c.chainRecord(&buf, n)
+	}
+	c.rollback()
+	if !bytes.Equal(c.value, seed) || c.manifest.Records != 0 {
+		t.Fatalf("chain should not move: %x, %d records", c.value, c.manifest.Records)
+	}
+
+	// the next record is chained from the last record written
+	buf.Reset()
+	buf.WriteString("c\n")
+	c.chainRecord(&buf, 0)
+	c.commit()
+	want := chainValue(sha256.New(), nil, seed, []byte("c"))
+	if !bytes.Equal(c.value, want) || c.manifest.Records != 1 {
+		t.Errorf("chain value %x, %d records, want %x, 1 record", c.value, c.manifest.Records, want)
+	}
+	if line := fmt.Sprintf("c%s%x\n", AUDIT_CHAIN_MARK, want); buf.String() != line {
+		t.Errorf("got %q, want %q", buf.String(), line)
+	}
+}
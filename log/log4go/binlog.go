@@ -0,0 +1,430 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// framing of binary log records, and reader of binary log files
+/*
+Usage:
+    // write binary records in frames
+    w := log4go.NewTimeFileLogWriter("./log/bin.log", "H", 24, true)
+    w.SetBinaryFrame(true)
+    logger.AddFilter("bin", log4go.INFO, w)
+    logger.Info(data) // data is []byte
+
+    // read records from backups (plain or compressed) and the current file,
+    // from the oldest to the newest
+    r, err := log4go.OpenBinaryLog("./log/bin.log")
+    if err != nil {
+        return err
+    }
+    defer r.Close()
+    for r.Next() {
+        rec := r.Record()
+        ...
+    }
+    if err := r.Err(); err != nil {
+        return err
+    }
+
+Format of frame (integers in big endian):
+    +-------+---------+-------+---------+--------+-------+---------+
+    | magic | version | level | created | length | crc32 | payload |
+    |   2   |    1    |   1   |    8    |   4    |   4   | length  |
+    +-------+---------+-------+---------+--------+-------+---------+
+    - magic: BINARY_FRAME_MAGIC
+    - version: BINARY_FRAME_VERSION
+    - created: unix time in nanoseconds
+    - crc32: CRC-32C of version, level, created, length and payload
+
+Payload is no more than BINARY_FRAME_MAX_SIZE. Larger binary records are
+dropped by the writer, and counted as dropped (see WriterStat).
+
+Corrupted frames (e.g., bad checksum, truncated) are skipped by the reader,
+which resumes from the next magic.
+*/
+
+package log4go
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	BINARY_FRAME_MAGIC    = 0xB10C           // magic of frame
+	BINARY_FRAME_VERSION  = 1                // version of frame format
+	BINARY_FRAME_HEADER   = 20               // size of frame header
+	BINARY_FRAME_MAX_SIZE = 16 * 1024 * 1024 // max size of payload
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+var ErrBinaryFrameTooLarge = fmt.Errorf("payload of binary frame is larger than %d", BINARY_FRAME_MAX_SIZE)
+
+// AppendBinaryFrame appends a frame of binary record to dst. If data is
+// larger than BINARY_FRAME_MAX_SIZE, dst is returned unchanged with
+// ErrBinaryFrameTooLarge.
+//
+// PARAMS:
+//   - dst: buffer to append
+//   - level: level of record
+//   - created: time of record
+//   - data: payload of record, no more than BINARY_FRAME_MAX_SIZE
+func AppendBinaryFrame(dst []byte, level LevelType, created time.Time, data []byte) ([]byte, error) {
+	if len(data) > BINARY_FRAME_MAX_SIZE {
+		return dst, ErrBinaryFrameTooLarge
+	}
+
+	var hdr [BINARY_FRAME_HEADER]byte
+	binary.BigEndian.PutUint16(hdr[0:2], BINARY_FRAME_MAGIC)
+	hdr[2] = BINARY_FRAME_VERSION
+	hdr[3] = byte(level)
+	binary.BigEndian.PutUint64(hdr[4:12], uint64(created.UnixNano()))
+	binary.BigEndian.PutUint32(hdr[12:16], uint32(len(data)))
+
+	crc := crc32.Update(crc32.Checksum(hdr[2:16], crc32c), crc32c, data)
+	binary.BigEndian.PutUint32(hdr[16:20], crc)
+
+	dst = append(dst, hdr[:]...)
+	return append(dst, data...), nil
+}
+
+// writeBinaryFrame writes a frame of binary record rec into out. Records
+// larger than BINARY_FRAME_MAX_SIZE are dropped before, see LogWrite.
+func writeBinaryFrame(out *bytes.Buffer, rec *LogRecord) {
+	if frame, err := AppendBinaryFrame(out.AvailableBuffer(), rec.Level, rec.Created, rec.Binary); err == nil {
+		out.Write(frame)
+	}
+}
+
+// BinaryRecord is a binary record read from log file
+type BinaryRecord struct {
+	Level   LevelType // level of record
+	Created time.Time // time of record
+	Data    []byte    // payload of record
+	File    string    // file of record
+}
+
+// BinaryLogReader reads binary records from log files, in order of files
+type BinaryLogReader struct {
+	files []string // files to read
+	index int      // index of the next file
+
+	reader  io.Reader // reader of current file (maybe decompressed)
+	closeFn func()    // closes current file
+
+	buf  []byte // data read from current file
+	pos  int    // position of the next frame in buf
+	eof  bool   // whether current file is read to end
+	name string // name of current file
+
+	rec     BinaryRecord
+	skipped int64 // bytes of corrupted frames skipped
+	err     error
+}
+
+// NewBinaryLogReader creates reader of binary records in given files. Files
+// compressed by built-in codecs (see CompressCodec) are decompressed.
+//
+// PARAMS:
+//   - files: log files, records are read in order of files
+func NewBinaryLogReader(files ...string) *BinaryLogReader {
+	return &BinaryLogReader{files: files}
+}
+
+// OpenBinaryLog creates reader of binary records in log file written by
+// TimeFileLogWriter, and its backups. Records are read from the oldest
+// backup to the current file.
+//
+// PARAMS:
+//   - filename: name of log file, e.g., "./log/bin.log"
+func OpenBinaryLog(filename string) (*BinaryLogReader, error) {
+	files, err := BinaryLogFiles(filename)
+	if err != nil {
+		return nil, err
+	}
+	return NewBinaryLogReader(files...), nil
+}
+
+// BinaryLogFiles gets log file and its backups (plain or compressed), from
+// the oldest to the newest. The log file is the last one, if exists.
+func BinaryLogFiles(filename string) ([]string, error) {
+	return logFiles(filename)
+}
+
+// logFiles gets log file written by TimeFileLogWriter and its backups, from
+// the oldest to the newest
+func logFiles(filename string) ([]string, error) {
+	dirName := filepath.Dir(filename)
+	baseName := filepath.Base(filename)
+
+	fileInfos, err := ioutil.ReadDir(dirName)
+	if err != nil {
+		return nil, err
+	}
+
+	// backups with suffix of any period, see TimeFileLogWriter.prepare()
+	fileFilter := regexp.MustCompile(`^` + regexp.QuoteMeta(baseName) +
+		`\.\d{4}-\d{2}-\d{2}(_\d{2}(-\d{2})?)?` + REGEX_SIZE_SUFFIX +
+		regexCompressSuffix() + `$`)
+
+	files := make([]string, 0)
+	for _, fileInfo := range fileInfos {
+		if fileFilter.MatchString(fileInfo.Name()) {
+			files = append(files, filepath.Join(dirName, fileInfo.Name()))
+		}
+	}
+	sort.Strings(files)
+
+	if _, err := os.Stat(filename); err == nil {
+		files = append(files, filename)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no log file found for %s", filename)
+	}
+	return files, nil
+}
+
+// Next reads the next record. It returns false if no more record, or error
+// occurs (see Err).
+func (r *BinaryLogReader) Next() bool {
+	for r.err == nil {
+		if r.reader == nil {
+			if r.index == len(r.files) {
+				return false
+			}
+			r.err = r.openNext()
+			continue
+		}
+
+		ok, err := r.readFrame()
+		if err != nil {
+			r.err = fmt.Errorf("read %s: %s", r.name, err)
+			return false
+		}
+		if ok {
+			return true
+		}
+
+		// end of current file
+		r.closeFile()
+	}
+	return false
+}
+
+// Record returns the record read by Next. Data of the record is valid
+// until the next call of Next.
+func (r *BinaryLogReader) Record() *BinaryRecord {
+	return &r.rec
+}
+
+// Err returns the error occurred while reading, if any
+func (r *BinaryLogReader) Err() error {
+	return r.err
+}
+
+// Skipped returns number of bytes skipped for corrupted frames
+func (r *BinaryLogReader) Skipped() int64 {
+	return r.skipped
+}
+
+// Close closes the reader
+func (r *BinaryLogReader) Close() error {
+	r.closeFile()
+	r.index = len(r.files)
+	return nil
+}
+
+// openNext opens the next file
+func (r *BinaryLogReader) openNext() error {
+	name := r.files[r.index]
+	r.index++
+
+	reader, closeFn, err := openLogFile(name)
+	if err != nil {
+		return err
+	}
+	r.reader, r.closeFn = reader, closeFn
+	r.name = name
+	r.buf, r.pos, r.eof = r.buf[:0], 0, false
+	return nil
+}
+
+// closeFile closes current file
+func (r *BinaryLogReader) closeFile() {
+	if r.closeFn != nil {
+		r.closeFn()
+		r.closeFn = nil
+	}
+	r.reader = nil
+}
+
+// openLogFile opens log file, which is decompressed if it is compressed by
+// built-in codecs. closeFn closes the file and the decompressor.
+func openLogFile(name string) (reader io.Reader, closeFn func(), err error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var closer io.Closer
+	reader = file
+	switch {
+	case strings.HasSuffix(name, COMPRESS_SUFFIX):
+		var gr *gzip.Reader
+		if gr, err = gzip.NewReader(file); err == nil {
+			tr := tar.NewReader(gr)
+			if _, err = tr.Next(); err == nil {
+				reader, closer = tr, gr
+			}
+		}
+	case strings.HasSuffix(name, ".gz"):
+		var gr *gzip.Reader
+		if gr, err = gzip.NewReader(file); err == nil {
+			reader, closer = gr, gr
+		}
+	case strings.HasSuffix(name, ".zst"):
+		if zstdNewReader == nil {
+			err = errors.New("zstd is not supported, build with tag \"zstd\"")
+			break
+		}
+		var zr io.ReadCloser
+		if zr, err = zstdNewReader(file); err == nil {
+			reader, closer = zr, zr
+		}
+	}
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("open %s: %s", name, err)
+	}
+
+	return reader, func() {
+		if closer != nil {
+			closer.Close()
+		}
+		file.Close()
+	}, nil
+}
+
+// fill makes sure at least n bytes are buffered after pos. It returns false
+// if current file ends before.
+func (r *BinaryLogReader) fill(n int) (bool, error) {
+	for len(r.buf)-r.pos < n {
+		if r.eof {
+			return false, nil
+		}
+
+		// drop data consumed, and read more
+		if r.pos > 0 {
+			r.buf = r.buf[:copy(r.buf, r.buf[r.pos:])]
+			r.pos = 0
+		}
+		if cap(r.buf)-len(r.buf) < 4096 || cap(r.buf) < n {
+			buf := make([]byte, len(r.buf), 2*cap(r.buf)+n+4096)
+			copy(buf, r.buf)
+			r.buf = buf
+		}
+		m, err := r.reader.Read(r.buf[len(r.buf):cap(r.buf)])
+		r.buf = r.buf[:len(r.buf)+m]
+		switch {
+		case err == io.EOF, errors.Is(err, io.ErrUnexpectedEOF):
+			// data of truncated archive is read as far as possible
+			r.eof = true
+		case err != nil:
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// skip skips n bytes of corrupted data
+func (r *BinaryLogReader) skip(n int) {
+	r.pos += n
+	r.skipped += int64(n)
+}
+
+// readFrame reads the next valid frame in current file. It returns false
+// at the end of file.
+func (r *BinaryLogReader) readFrame() (bool, error) {
+	magic := []byte{BINARY_FRAME_MAGIC >> 8, BINARY_FRAME_MAGIC & 0xff}
+
+	for {
+		ok, err := r.fill(BINARY_FRAME_HEADER)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			// truncated frame at the end of file
+			r.skip(len(r.buf) - r.pos)
+			return false, nil
+		}
+
+		// find magic
+		hdr := r.buf[r.pos:]
+		if !bytes.HasPrefix(hdr, magic) {
+			i := bytes.Index(hdr[1:], magic)
+			if i < 0 {
+				// the last byte may be start of magic
+				i = len(hdr) - 2
+			}
+			r.skip(i + 1)
+			continue
+		}
+
+		length := int(binary.BigEndian.Uint32(hdr[12:16]))
+		if hdr[2] != BINARY_FRAME_VERSION || length > BINARY_FRAME_MAX_SIZE {
+			r.skip(1)
+			continue
+		}
+
+		ok, err = r.fill(BINARY_FRAME_HEADER + length)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			// frame is truncated, or length is corrupted
+			r.skip(1)
+			continue
+		}
+
+		hdr = r.buf[r.pos : r.pos+BINARY_FRAME_HEADER]
+		data := r.buf[r.pos+BINARY_FRAME_HEADER : r.pos+BINARY_FRAME_HEADER+length]
+		crc := crc32.Update(crc32.Checksum(hdr[2:16], crc32c), crc32c, data)
+		if crc != binary.BigEndian.Uint32(hdr[16:20]) {
+			r.skip(1)
+			continue
+		}
+
+		r.rec = BinaryRecord{
+			Level:   LevelType(hdr[3]),
+			Created: time.Unix(0, int64(binary.BigEndian.Uint64(hdr[4:12]))),
+			Data:    data,
+			File:    r.name,
+		}
+		r.pos += BINARY_FRAME_HEADER + length
+		return true, nil
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log4go
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readBinaryLog reads payload of all records in files
+func readBinaryLog(t *testing.T, r *BinaryLogReader) []string {
+	var recs []string
+	for r.Next() {
+		recs = append(recs, string(r.Record().Data))
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("BinaryLogReader: %s", err)
+	}
+	r.Close()
+	return recs
+}
+
+func TestBinaryFrameWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "binlog")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fname := filepath.Join(dir, "bin.log")
+	w := NewTimeFileLogWriter(fname, "D", 7, false).SetBinaryFrame(true)
+	l := make(Logger)
+	l.AddFilter("bin", INFO, w)
+
+	start := time.Now()
+	l.Info([]byte("first"))
+	l.Debug([]byte("filtered"))
+	l.Info([]byte{})
+	// too large, dropped
+	l.Info(make([]byte, BINARY_FRAME_MAX_SIZE+1))
+	l.Info([]byte("second"))
+	l.Close()
+
+	if stat := w.Stat(); stat.Dropped != 1 || stat.Written != 2 {
+		t.Errorf("got stat %+v, want 1 dropped and 2 written", stat)
+	}
+	if _, err := AppendBinaryFrame(nil, INFO, time.Now(), make([]byte, BINARY_FRAME_MAX_SIZE+1)); err != ErrBinaryFrameTooLarge {
+		t.Errorf("got error %v, want ErrBinaryFrameTooLarge", err)
+	}
+
+	r, err := OpenBinaryLog(fname)
+	if err != nil {
+		t.Fatalf("OpenBinaryLog(): %s", err)
+	}
+	if !r.Next() {
+		t.Fatalf("record expected, err %v", r.Err())
+	}
+	rec := r.Record()
+	if string(rec.Data) != "first" || rec.Level != INFO || rec.File != fname ||
+		rec.Created.Before(start) || time.Since(rec.Created) > time.Minute {
+		t.Errorf("unexpected record %+v", rec)
+	}
+	if got := fmt.Sprint(readBinaryLog(t, r)); got != "[second]" {
+		t.Errorf("got %s, want [second]", got)
+	}
+}
+
+func TestBinaryLogReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "binlog")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fname := filepath.Join(dir, "bin.log")
+	frame := func(data string) []byte {
+		frame, _ := AppendBinaryFrame(nil, INFO, time.Now(), []byte(data))
+		return frame
+	}
+	writeFile := func(name string, data []byte) {
+		if err := ioutil.WriteFile(name, data, 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile(): %s", err)
+		}
+	}
+
+	// the oldest backup, compressed
+	writeFile(fname+".2019-01-01", append(frame("a"), frame("b")...))
+	if err := compressArchiveFile(fname+".2019-01-01", tarGzipCodec{}); err != nil {
+		t.Fatalf("compressArchiveFile(): %s", err)
+	}
+
+	// backup with corrupted frames
+	var buf bytes.Buffer
+	buf.Write(frame("c"))
+	buf.WriteString("garbage\xb1")
+	bad := frame("bad checksum")
+	bad[len(bad)-1] ^= 0xff
+	buf.Write(bad)
+	buf.Write(frame("d"))
+	buf.Write(frame("truncated")[:25])
+	writeFile(fname+".2019-01-02.001", buf.Bytes())
+
+	// the current file
+	writeFile(fname, frame("e"))
+
+	// other files are ignored
+	writeFile(fname+".bak", frame("x"))
+	writeFile(filepath.Join(dir, "other.log.2019-01-01"), frame("x"))
+
+	files, err := BinaryLogFiles(fname)
+	if err != nil {
+		t.Fatalf("BinaryLogFiles(): %s", err)
+	}
+	want := []string{fname + ".2019-01-01" + COMPRESS_SUFFIX, fname + ".2019-01-02.001", fname}
+	if fmt.Sprint(files) != fmt.Sprint(want) {
+		t.Errorf("got files %v, want %v", files, want)
+	}
+
+	r := NewBinaryLogReader(files...)
+	if got := fmt.Sprint(readBinaryLog(t, r)); got != "[a b c d e]" {
+		t.Errorf("got %s, want [a b c d e]", got)
+	}
+	if want := int64(len("garbage\xb1") + len(bad) + 25); r.Skipped() != want {
+		t.Errorf("got %d bytes skipped, want %d", r.Skipped(), want)
+	}
+
+	if _, err := OpenBinaryLog(filepath.Join(dir, "none.log")); err == nil {
+		t.Errorf("error expected for missing file")
+	}
+	r = NewBinaryLogReader(filepath.Join(dir, "none.log"))
+	if r.Next() || r.Err() == nil {
+		t.Errorf("error expected for missing file")
+	}
+}
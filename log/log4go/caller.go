@@ -0,0 +1,183 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// caller implements caller (source) of log records
+/*
+Usage:
+    // helper which wraps the logger
+    func logError(err error) {
+        // skip logError, caller of logError is recorded
+        logger.WithCallerSkip(1).Error("request failed: %s", err)
+    }
+
+    // caller is rendered by %S (func:line), %s (file.go:line),
+    // %p (/path/to/file.go:line) and %c (function)
+    w.SetFormat("[%D %T] [%L] (%s %c) %M")
+
+Callers are cached by program counter, so the cost of getting caller is
+small after the first record of each call site.
+*/
+
+package log4go
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// max number of callers cached, see callerAt()
+const SRC_CACHE_SIZE = 4096
+
+var (
+	srcCacheLock sync.RWMutex
+	srcCache     = make(map[uintptr]*Caller) // pc of caller => caller
+)
+
+// Caller is location of the code which logs the record.
+// Callers are shared by records, and should not be modified.
+type Caller struct {
+	Function string // full name of function, e.g. "github.com/baidu/go-lib/log.Init"
+	File     string // full path of file
+	Line     int    // line number
+
+	source    string // "func:line", see LogRecord.Source
+	shortFile string // "file.go:line"
+	fullFile  string // "/path/to/file.go:line"
+}
+
+// newCaller creates caller from function, file and line
+func newCaller(function string, file string, line int) *Caller {
+	if function == "" {
+		function = "???"
+	}
+	lineno := strconv.Itoa(line)
+
+	return &Caller{
+		Function:  function,
+		File:      file,
+		Line:      line,
+		source:    fmt.Sprintf("%s:%d", function, line),
+		shortFile: filepath.Base(file) + ":" + lineno,
+		fullFile:  file + ":" + lineno,
+	}
+}
+
+// Source returns source of caller ("func:line"), or "" if c is nil
+func (c *Caller) Source() string {
+	if c == nil {
+		return ""
+	}
+	return c.source
+}
+
+// ShortFile returns "file.go:line" of caller, or "" if c is nil
+func (c *Caller) ShortFile() string {
+	if c == nil {
+		return ""
+	}
+	return c.shortFile
+}
+
+// FullFile returns "/path/to/file.go:line" of caller, or "" if c is nil
+func (c *Caller) FullFile() string {
+	if c == nil {
+		return ""
+	}
+	return c.fullFile
+}
+
+// FunctionName returns full name of function, or "" if c is nil
+func (c *Caller) FunctionName() string {
+	if c == nil {
+		return ""
+	}
+	return c.Function
+}
+
+// callerAt returns caller at given depth (relative to the caller of
+// callerAt), or nil if it is unknown
+func callerAt(depth int) *Caller {
+	pc, file, line, ok := runtime.Caller(depth + 1)
+	if !ok {
+		return nil
+	}
+
+	srcCacheLock.RLock()
+	c, ok := srcCache[pc]
+	srcCacheLock.RUnlock()
+	if ok {
+		return c
+	}
+
+	function := ""
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		function = fn.Name()
+	}
+	return cacheCaller(pc, newCaller(function, file, line))
+}
+
+// callerForPC returns caller of program counter returned by runtime.Callers
+// (e.g., slog.Record.PC), or nil if it is unknown
+func callerForPC(pc uintptr) *Caller {
+	if pc == 0 {
+		return nil
+	}
+
+	srcCacheLock.RLock()
+	c, ok := srcCache[pc]
+	srcCacheLock.RUnlock()
+	if ok {
+		return c
+	}
+
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	if frame.File == "" {
+		return nil
+	}
+	return cacheCaller(pc, newCaller(frame.Function, frame.File, frame.Line))
+}
+
+// cacheCaller adds caller of pc to cache, if cache is not full
+func cacheCaller(pc uintptr, c *Caller) *Caller {
+	srcCacheLock.Lock()
+	if len(srcCache) < SRC_CACHE_SIZE {
+		srcCache[pc] = c
+	}
+	srcCacheLock.Unlock()
+	return c
+}
+
+// WithCallerSkip creates an entry which skips n more stack frames when
+// determining caller of records. It is used by helpers wrapping the logger,
+// so that caller of the helper is recorded instead of the helper itself.
+func (log Logger) WithCallerSkip(n int) *Entry {
+	return &Entry{
+		logger: log,
+		skip:   n,
+	}
+}
+
+// WithCallerSkip creates a new entry with fields of e, which skips n more
+// stack frames than e when determining caller of records.
+func (e *Entry) WithCallerSkip(n int) *Entry {
+	return &Entry{
+		logger: e.logger,
+		name:   e.name,
+		fields: e.fields,
+		skip:   e.skip + n,
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log4go
+
+import (
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// logHelper wraps the logger, as helpers in applications do
+func logHelper(l Logger, msg string) {
+	l.WithCallerSkip(1).Info(msg)
+}
+
+// binHelper wraps the logger for binary log
+func binHelper(l Logger, data []byte) {
+	l.WithCallerSkip(1).Info(data)
+}
+
+// currentLine returns file and line of its caller
+func currentLine() (string, int) {
+	_, file, line, _ := runtime.Caller(1)
+	return file, line
+}
+
+func TestWithCallerSkip(t *testing.T) {
+	var recs []*LogRecord
+	l := make(Logger)
+	l.AddFilter("test", INFO, testWriter(func(rec *LogRecord) {
+		recs = append(recs, rec)
+	}))
+
+	file, line := currentLine()
+	logHelper(l, "helper")
+	l.WithCallerSkip(0).Info("direct")
+	l.Named("rpc").WithCallerSkip(1).WithCallerSkip(-1).Info("named")
+
+	if len(recs) != 3 {
+		t.Fatalf("got %d records, want 3", len(recs))
+	}
+	for i, rec := range recs {
+		if rec.Caller == nil {
+			t.Fatalf("record %d: caller not recorded", i)
+		}
+		if want := line + 1 + i; rec.Caller.Line != want || rec.Caller.File != file {
+			t.Errorf("record %d: got %s, want %s:%d", i, rec.Caller.FullFile(), file, want)
+		}
+		if !strings.HasSuffix(rec.Caller.Function, ".TestWithCallerSkip") {
+			t.Errorf("record %d: unexpected function %s", i, rec.Caller.Function)
+		}
+		if rec.Source != rec.Caller.Source() {
+			t.Errorf("record %d: got source %s, want %s", i, rec.Source, rec.Caller.Source())
+		}
+	}
+	if recs[2].Name != "rpc" {
+		t.Errorf("got name %q, want rpc", recs[2].Name)
+	}
+
+	lineno := strconv.Itoa(line + 1)
+	got := FormatLogRecord("%s|%p|%c|%M", recs[0])
+	want := filepath.Base(file) + ":" + lineno + "|" + file + ":" + lineno + "|" +
+		recs[0].Caller.Function + "|helper\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// verbs of caller are empty if caller is unknown
+	if got := FormatLogRecord("[%s%p%c] %M", &LogRecord{Message: "m"}); got != "[] m\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestWithCallerSkipBinary(t *testing.T) {
+	defer SetSrcLineForBinLog(EnableSrcForBinLog)
+
+	var recs []*LogRecord
+	l := make(Logger)
+	l.AddFilter("test", INFO, testWriter(func(rec *LogRecord) {
+		recs = append(recs, rec)
+	}))
+
+	SetSrcLineForBinLog(true)
+	_, line := currentLine()
+	binHelper(l, []byte("bin"))
+	SetSrcLineForBinLog(false)
+	binHelper(l, []byte("nosrc"))
+
+	if len(recs) != 2 {
+		t.Fatalf("got %d records, want 2", len(recs))
+	}
+	if string(recs[0].Binary) != "bin" || recs[0].Caller == nil || recs[0].Caller.Line != line+1 {
+		t.Errorf("unexpected binary record %+v", recs[0])
+	}
+	if string(recs[1].Binary) != "nosrc" || recs[1].Caller != nil || recs[1].Source != "" {
+		t.Errorf("source should not be recorded, got %+v", recs[1])
+	}
+}
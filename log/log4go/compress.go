@@ -0,0 +1,265 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// compress implements compression codecs for archived log files
+/*
+Built-in codecs:
+- "tar.gz": single-file tar archive compressed by gzip (.tar.gz), the default
+- "gzip": plain gzip (.gz), readable with zcat
+- "zstd": plain zstd (.zst), readable with zstdcat; only built with tag "zstd",
+  e.g., go build -tags zstd, as it depends on github.com/klauspost/compress
+
+Compression is done by a background worker, with a bounded queue. If the
+queue is full, the backup is left uncompressed. Writer waits for its backups
+queued to be compressed when it is closed, and backups queued are not
+removed by retention. Temporary files left by compression interrupted (e.g.,
+by exit) are removed when writer is created.
+*/
+package log4go
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	COMPRESS_TARGZ = "tar.gz" // tar archive compressed by gzip
+	COMPRESS_GZIP  = "gzip"   // plain gzip
+	COMPRESS_ZSTD  = "zstd"   // plain zstd, only built with tag "zstd"
+
+	COMPRESS_QUEUE_SIZE = 64 // max number of files waiting for compression
+)
+
+// CompressCodec compresses an archived log file
+type CompressCodec interface {
+	// Suffix returns suffix of compressed file, e.g., ".tar.gz"
+	Suffix() string
+
+	// Compress compresses src, whose file info is fi, to dst
+	Compress(dst io.Writer, src io.Reader, fi os.FileInfo) error
+}
+
+var (
+	codecs     = make(map[string]CompressCodec)
+	codecsLock sync.RWMutex
+
+	// zstdNewReader creates reader of zstd, nil if not built with tag "zstd"
+	zstdNewReader func(r io.Reader) (io.ReadCloser, error)
+)
+
+func init() {
+	RegisterCompressCodec(COMPRESS_TARGZ, tarGzipCodec{})
+	RegisterCompressCodec(COMPRESS_GZIP, gzipCodec{})
+}
+
+// RegisterCompressCodec registers codec with name. Codec registered with
+// the same name is replaced.
+//
+// This should be invoked before create logWriter, so that backups with suffix
+// of the codec could be found for removing.
+func RegisterCompressCodec(name string, codec CompressCodec) {
+	codecsLock.Lock()
+	codecs[name] = codec
+	codecsLock.Unlock()
+}
+
+// GetCompressCodec gets codec by name
+func GetCompressCodec(name string) (CompressCodec, error) {
+	codecsLock.RLock()
+	codec, ok := codecs[name]
+	codecsLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown compress codec: %s", name)
+	}
+	return codec, nil
+}
+
+// compressSuffixes gets suffixes of all registered codecs, the longest first
+func compressSuffixes() []string {
+	codecsLock.RLock()
+	suffixes := make([]string, 0, len(codecs))
+	for _, codec := range codecs {
+		suffixes = append(suffixes, codec.Suffix())
+	}
+	codecsLock.RUnlock()
+
+	sort.Slice(suffixes, func(i, j int) bool {
+		if len(suffixes[i]) != len(suffixes[j]) {
+			return len(suffixes[i]) > len(suffixes[j])
+		}
+		return suffixes[i] < suffixes[j]
+	})
+	return suffixes
+}
+
+// regexCompressSuffix gets regular expression matching suffix of all codecs
+func regexCompressSuffix() string {
+	suffixes := compressSuffixes()
+	for i, suffix := range suffixes {
+		suffixes[i] = regexp.QuoteMeta(suffix)
+	}
+	return "(" + strings.Join(suffixes, "|") + ")?"
+}
+
+/****** built-in codecs ******/
+
+// tarGzipCodec packages file with tar, and compresses with gzip
+type tarGzipCodec struct{}
+
+func (c tarGzipCodec) Suffix() string {
+	return COMPRESS_SUFFIX
+}
+
+func (c tarGzipCodec) Compress(dst io.Writer, src io.Reader, fi os.FileInfo) error {
+	// create Gzip writer
+	gw := gzip.NewWriter(dst)
+	// create Tar writer
+	tw := tar.NewWriter(gw)
+
+	// write archive file header
+	hdr, err := tar.FileInfoHeader(fi, "")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	// write compressed file
+	if _, err := io.Copy(tw, src); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// gzipCodec compresses file with gzip
+type gzipCodec struct{}
+
+func (c gzipCodec) Suffix() string {
+	return ".gz"
+}
+
+func (c gzipCodec) Compress(dst io.Writer, src io.Reader, fi os.FileInfo) error {
+	gw := gzip.NewWriter(dst)
+	gw.Name = fi.Name()
+	gw.ModTime = fi.ModTime()
+
+	if _, err := io.Copy(gw, src); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+/****** compress worker ******/
+
+// compressTask is a file waiting for compression
+type compressTask struct {
+	fname string
+	codec CompressCodec
+	done  func(fname string) // called after compressed (or failed)
+}
+
+var (
+	compressQueue     chan compressTask
+	compressQueueOnce sync.Once
+)
+
+// compressAsync adds file to the queue of background compress worker, done
+// is called after the file is compressed (or failed), not if error returned
+func compressAsync(fname string, codec CompressCodec, done func(fname string)) error {
+	compressQueueOnce.Do(func() {
+		compressQueue = make(chan compressTask, COMPRESS_QUEUE_SIZE)
+		go compressWorker()
+	})
+
+	select {
+	case compressQueue <- compressTask{fname, codec, done}:
+		return nil
+	default:
+		return fmt.Errorf("Compress file: queue is full, %s is left uncompressed\n", fname)
+	}
+}
+
+func compressWorker() {
+	for task := range compressQueue {
+		if err := compressArchiveFile(task.fname, task.codec); err != nil {
+			fmt.Fprintf(os.Stderr, "compressWorker(%q): %s", task.fname, err)
+		}
+		if task.done != nil {
+			task.done(task.fname)
+		}
+	}
+}
+
+// compressArchiveFile compresses file by the name with codec
+//
+// Compressed data is written to a temporary file first, which is renamed to
+// the target name on success. Then the raw file is removed.
+func compressArchiveFile(fname string, codec CompressCodec) error {
+	var errMsg = "Compress file: %s\n"
+
+	target := fname + codec.Suffix()
+	tmpName := target + ".tmp"
+
+	// obtain file info
+	fi, err := os.Stat(fname)
+	if err != nil {
+		return fmt.Errorf(errMsg, err)
+	}
+
+	fr, err := os.Open(fname)
+	if err != nil {
+		return fmt.Errorf(errMsg, err)
+	}
+	defer fr.Close()
+
+	// generate temporary file which is compressed archived
+	fw, err := os.Create(tmpName)
+	if err != nil {
+		return fmt.Errorf(errMsg, err)
+	}
+
+	err = codec.Compress(fw, fr, fi)
+	if closeErr := fw.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf(errMsg, err)
+	}
+
+	if err := os.Rename(tmpName, target); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf(errMsg, err)
+	}
+
+	// remove raw file
+	if err := os.Remove(fname); err != nil {
+		return fmt.Errorf(errMsg, err)
+	}
+
+	return nil
+}
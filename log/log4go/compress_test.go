@@ -0,0 +1,207 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log4go
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	strftime "github.com/jehiah/go-strftime"
+)
+
+// decompress reads content of compressed file
+func decompress(t *testing.T, name string, fname string) []byte {
+	f, err := os.Open(fname)
+	if err != nil {
+		t.Fatalf("os.Open(%s): %s", fname, err)
+	}
+	defer f.Close()
+
+	var r io.Reader
+	switch name {
+	case COMPRESS_TARGZ:
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("gzip.NewReader(): %s", err)
+		}
+		tr := tar.NewReader(gr)
+		if _, err := tr.Next(); err != nil {
+			t.Fatalf("tar.Reader.Next(): %s", err)
+		}
+		r = tr
+	case COMPRESS_GZIP:
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("gzip.NewReader(): %s", err)
+		}
+		r = gr
+	case COMPRESS_ZSTD:
+		zr, err := zstdNewReader(f)
+		if err != nil {
+			t.Fatalf("zstdNewReader(): %s", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("decompress %s: %s", fname, err)
+	}
+	return data
+}
+
+func TestCompressArchiveFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compress")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := []byte("[2019/01/01 00:00:00 CST] [INFO] (source) message\n")
+
+	names := []string{COMPRESS_TARGZ, COMPRESS_GZIP}
+	if zstdNewReader != nil {
+		names = append(names, COMPRESS_ZSTD)
+	}
+	for _, name := range names {
+		codec, err := GetCompressCodec(name)
+		if err != nil {
+			t.Fatalf("GetCompressCodec(%s): %s", name, err)
+		}
+
+		fname := filepath.Join(dir, "test.log.2019-01-01")
+		if err := ioutil.WriteFile(fname, content, 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile(): %s", err)
+		}
+
+		if err := compressArchiveFile(fname, codec); err != nil {
+			t.Fatalf("compressArchiveFile(%s): %s", name, err)
+		}
+
+		if _, err := os.Stat(fname); !os.IsNotExist(err) {
+			t.Errorf("%s: raw file should be removed", name)
+		}
+		if got := decompress(t, name, fname+codec.Suffix()); string(got) != string(content) {
+			t.Errorf("%s: got %q, want %q", name, got, content)
+		}
+		os.Remove(fname + codec.Suffix())
+	}
+
+	if _, err := GetCompressCodec("rar"); err == nil {
+		t.Errorf("GetCompressCodec(rar) should fail")
+	}
+}
+
+// test backups of all codecs are found
+func TestTimeFileLogWriterCodecFilter(t *testing.T) {
+	w := &TimeFileLogWriter{when: "D", filename: testLogFile}
+	w.prepare()
+
+	suffixes := []string{"", ".tar.gz", ".gz", ".001.gz"}
+	if zstdNewReader != nil {
+		suffixes = append(suffixes, ".zst")
+	}
+	for _, suffix := range suffixes {
+		if !w.fileFilter.MatchString("2019-01-01" + suffix) {
+			t.Errorf("backup with suffix %q should be matched", suffix)
+		}
+	}
+	for _, suffix := range []string{".tmp", ".gz.tmp", ".tar.gz.tmp", ".bz2"} {
+		if w.fileFilter.MatchString("2019-01-01" + suffix) {
+			t.Errorf("backup with suffix %q should not be matched", suffix)
+		}
+	}
+}
+
+// test writer waits for compression of its backups when closed, and removes
+// temporary files left by compression interrupted
+func TestTimeFileLogWriterCompressClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compress")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	suffix := strftime.Format("%Y-%m-%d", time.Now())
+	stale := filepath.Join(dir, "test.log.2019-01-01.tar.gz.tmp")
+	other := filepath.Join(dir, "test.log.2019-01-01.manifest.tmp")
+	for _, name := range []string{stale, other} {
+		if err := ioutil.WriteFile(name, []byte("partial"), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile(): %s", err)
+		}
+	}
+
+	w := NewTimeFileLogWriter(filepath.Join(dir, "test.log"), "D", 0, true)
+	if w == nil {
+		t.Fatalf("Invalid return: w should not be nil")
+	}
+	w.SetRotateSize(60)
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("%s should be removed", stale)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("%s should be kept: %s", other, err)
+	}
+
+	// each record is 50 bytes, the third one triggers roll over
+	for i := 0; i < 3; i++ {
+		w.LogWrite(newLogRecord(CRITICAL, "source", "message", nil))
+	}
+	w.Close()
+
+	backup := filepath.Join(dir, "test.log."+suffix+".001")
+	if _, err := os.Stat(backup + COMPRESS_SUFFIX); err != nil {
+		t.Errorf("backup should be compressed before Close returns: %s", err)
+	}
+	if _, err := os.Stat(backup); !os.IsNotExist(err) {
+		t.Errorf("%s should be removed after compressed", backup)
+	}
+}
+
+// test backups queued for compression are not removed
+func TestTimeFileLogWriterCompressQueued(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compress")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := &TimeFileLogWriter{when: "H", baseFilename: filepath.Join(dir, "test.log")}
+	w.prepare()
+	for _, name := range []string{"test.log.2019-01-01_00", "test.log.2019-01-01_01", "test.log.2019-01-01_02"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile(): %s", err)
+		}
+	}
+
+	queued := filepath.Join(dir, "test.log.2019-01-01_00")
+	w.compressQueued(queued)
+	files := w.getFilesToDelete(retention{backupCount: 1})
+	if len(files) != 1 || files[0] != filepath.Join(dir, "test.log.2019-01-01_01") {
+		t.Errorf("got files to delete %v", files)
+	}
+
+	w.compressDone(queued)
+	if files := w.getFilesToDelete(retention{backupCount: 1}); len(files) != 2 {
+		t.Errorf("got files to delete %v", files)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build zstd
+
+package log4go
+
+import (
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func init() {
+	RegisterCompressCodec(COMPRESS_ZSTD, zstdCodec{})
+	zstdNewReader = func(r io.Reader) (io.ReadCloser, error) {
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+}
+
+// zstdCodec compresses file with zstd
+type zstdCodec struct{}
+
+func (c zstdCodec) Suffix() string {
+	return ".zst"
+}
+
+func (c zstdCodec) Compress(dst io.Writer, src io.Reader, fi os.FileInfo) error {
+	zw, err := zstd.NewWriter(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(zw, src); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
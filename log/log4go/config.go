@@ -17,12 +17,14 @@
 package log4go
 
 import (
+	"bytes"
 	"encoding/xml"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type xmlProperty struct {
@@ -38,11 +40,21 @@ type xmlFilter struct {
 	Property []xmlProperty `xml:"property"`
 }
 
+// level of named module, see SetModuleLevel()
+type xmlModule struct {
+	Name  string `xml:"name,attr"`
+	Level string `xml:"level,attr"`
+}
+
 type xmlLoggerConfig struct {
 	Filter []xmlFilter `xml:"filter"`
+	Module []xmlModule `xml:"logger"`
 }
 
 // Load XML configuration; see examples/example.xml for documentation
+//
+// Errors are printed to stderr and the program exits. Use LoadConfigFile
+// to get errors instead.
 func (log Logger) LoadConfiguration(filename string) {
 	log.Close()
 
@@ -66,9 +78,8 @@ func (log Logger) LoadConfiguration(filename string) {
 	}
 
 	for _, xmlfilt := range xc.Filter {
-		var filt LogWriter
 		var lvl LevelType
-		bad, good, enabled := false, true, false
+		bad, enabled := false, false
 
 		// Check required children
 		if len(xmlfilt.Enabled) == 0 {
@@ -90,24 +101,8 @@ func (log Logger) LoadConfiguration(filename string) {
 			bad = true
 		}
 
-		switch xmlfilt.Level {
-		case "FINEST":
-			lvl = FINEST
-		case "FINE":
-			lvl = FINE
-		case "DEBUG":
-			lvl = DEBUG
-		case "TRACE":
-			lvl = TRACE
-		case "INFO":
-			lvl = INFO
-		case "WARNING":
-			lvl = WARNING
-		case "ERROR":
-			lvl = ERROR
-		case "CRITICAL":
-			lvl = CRITICAL
-		default:
+		lvl, ok := filterLevels[xmlfilt.Level]
+		if !ok {
 			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required child <%s> for filter has unknown value in %s: %s\n", "level", filename, xmlfilt.Level)
 			bad = true
 		}
@@ -117,22 +112,23 @@ func (log Logger) LoadConfiguration(filename string) {
 			os.Exit(1)
 		}
 
-		switch xmlfilt.Type {
-		case "console":
-			filt, good = xmlToConsoleLogWriter(filename, xmlfilt.Property, enabled)
-		case "file":
-			filt, good = xmlToFileLogWriter(filename, xmlfilt.Property, enabled)
-		case "xml":
-			filt, good = xmlToXMLLogWriter(filename, xmlfilt.Property, enabled)
-		case "socket":
-			filt, good = xmlToSocketLogWriter(filename, xmlfilt.Property, enabled)
-		default:
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not load XML configuration in %s: unknown filter type \"%s\"\n", filename, xmlfilt.Type)
+		if _, ok := filterProperties[xmlfilt.Type]; ok {
+			for _, prop := range xmlfilt.Property {
+				if _, ok := filterProperty(xmlfilt.Type, prop.Name); !ok {
+					fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Unknown property \"%s\" for %s filter in %s\n", prop.Name, xmlfilt.Type, filename)
+				}
+			}
+		}
+
+		redactor, err := propsToRedactor(xmlfilt.Property)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not load XML configuration in %s: %s\n", filename, err)
 			os.Exit(1)
 		}
 
-		// Just so all of the required params are errored at the same time if wrong
-		if !good {
+		filt, err := newFilterWriter(xmlfilt.Type, xmlfilt.Property, enabled)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not load XML configuration in %s: %s\n", filename, err)
 			os.Exit(1)
 		}
 
@@ -141,25 +137,163 @@ func (log Logger) LoadConfiguration(filename string) {
 			continue
 		}
 
-		log[xmlfilt.Tag] = &Filter{lvl, filt}
+		log[xmlfilt.Tag] = &Filter{Level: lvl, LogWriter: filt}
+		log.SetRedactor(xmlfilt.Tag, redactor)
 	}
+
+	levels := make(map[string]LevelType, len(xc.Module))
+	for _, xmlmod := range xc.Module {
+		if len(xmlmod.Name) == 0 {
+			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required attribute %s for logger missing in %s\n", "name", filename)
+			os.Exit(1)
+		}
+		lvl, err := ParseLevel(xmlmod.Level)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Attribute %s for logger %q has unknown value in %s: %s\n", "level", xmlmod.Name, filename, xmlmod.Level)
+			os.Exit(1)
+		}
+		levels[xmlmod.Name] = lvl
+	}
+	SetModuleLevels(levels)
 }
 
-func xmlToConsoleLogWriter(filename string, props []xmlProperty, enabled bool) (ConsoleLogWriter, bool) {
+// levels of filter in configuration
+var filterLevels = map[string]LevelType{
+	"FINEST":   FINEST,
+	"FINE":     FINE,
+	"DEBUG":    DEBUG,
+	"TRACE":    TRACE,
+	"INFO":     INFO,
+	"WARNING":  WARNING,
+	"ERROR":    ERROR,
+	"CRITICAL": CRITICAL,
+}
+
+// kinds of property value, see filterProperties
+const (
+	propString   = iota // any string
+	propBool            // "true" or "false"
+	propInt             // integer
+	propSize            // integer with K/M/G suffix, see strToNumSuffix
+	propDuration        // duration with extra support of days, see strToDuration
+)
+
+// properties of each filter type, and kinds of their values
+var filterProperties = map[string]map[string]int{
+	"console": {
+		"format": propString,
+	},
+	"file": {
+		"filename": propString,
+		"format":   propString,
+		"maxlines": propSize,
+		"maxsize":  propSize,
+		"daily":    propBool,
+		"rotate":   propBool,
+	},
+	"timefile": {
+		"filename":      propString,
+		"format":        propString,
+		"when":          propString,
+		"backupcount":   propInt,
+		"compress":      propBool,
+		"codec":         propString,
+		"maxsize":       propSize,
+		"maxbackupsize": propSize,
+		"maxage":        propDuration,
+		"binaryframe":   propBool,
+		"audit":         propBool,
+		"auditkeyfile":  propString,
+	},
+	"xml": {
+		"filename":   propString,
+		"maxrecords": propSize,
+		"maxsize":    propSize,
+		"daily":      propBool,
+		"rotate":     propBool,
+	},
+	"socket": {
+		"endpoint":   propString,
+		"protocol":   propString,
+		"reconnect":  propBool,
+		"format":     propString,
+		"framing":    propString,
+		"buffersize": propSize,
+		"spillfile":  propString,
+		"spillsize":  propSize,
+	},
+	"packet": {
+		"name":     propString,
+		"endpoint": propString,
+		"protocol": propString,
+		"format":   propString,
+	},
+	"syslog": {
+		"network":  propString,
+		"address":  propString,
+		"rfc":      propString,
+		"facility": propString,
+		"tag":      propString,
+		"format":   propString,
+	},
+}
+
+// filterProperty gets kind of property for filter type. Properties of
+// redaction are accepted by all types, see propsToRedactor.
+func filterProperty(typ string, name string) (int, bool) {
+	if kind, ok := redactProperties[name]; ok {
+		return kind, true
+	}
+	kind, ok := filterProperties[typ][name]
+	return kind, ok
+}
+
+// newFilterWriter creates writer of given type with properties. If the
+// filter is not enabled, properties are checked and no writer is created.
+// Unknown properties are ignored.
+func newFilterWriter(typ string, props []xmlProperty, enabled bool) (LogWriter, error) {
+	switch typ {
+	case "console":
+		return propsToConsoleLogWriter(props, enabled)
+	case "file":
+		return propsToFileLogWriter(props, enabled)
+	case "timefile":
+		return propsToTimeFileLogWriter(props, enabled)
+	case "xml":
+		return propsToXMLLogWriter(props, enabled)
+	case "socket":
+		return propsToSocketLogWriter(props, enabled)
+	case "packet":
+		return propsToPacketWriter(props, enabled)
+	case "syslog":
+		return propsToSyslogWriter(props, enabled)
+	default:
+		return nil, fmt.Errorf("unknown filter type \"%s\"", typ)
+	}
+}
+
+func propsToConsoleLogWriter(props []xmlProperty, enabled bool) (LogWriter, error) {
+	format := ""
+
 	// Parse properties
 	for _, prop := range props {
 		switch prop.Name {
-		default:
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Unknown property \"%s\" for console filter in %s\n", prop.Name, filename)
+		case "format":
+			format = strings.Trim(prop.Value, " \r\n")
 		}
 	}
 
 	// If it's disabled, we're just checking syntax
 	if !enabled {
-		return nil, true
+		return nil, nil
+	}
+
+	// console with specified format, e.g., "json"
+	if len(format) > 0 {
+		return NewFormatLogWriter(stdout, format), nil
 	}
 
-	return NewConsoleLogWriter(), true
+	return NewConsoleLogWriter(), nil
 }
 
 // Parse a number with K/M/G suffixes based on thousands (1000) or 2^10 (1024)
@@ -181,7 +315,20 @@ func strToNumSuffix(str string, mult int) int {
 	parsed, _ := strconv.Atoi(str)
 	return parsed * num
 }
-func xmlToFileLogWriter(filename string, props []xmlProperty, enabled bool) (*FileLogWriter, bool) {
+
+// Parse a duration, with extra support of days (e.g., "7d")
+func strToDuration(str string) (time.Duration, error) {
+	if strings.HasSuffix(str, "d") {
+		days, err := strconv.Atoi(str[:len(str)-1])
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(str)
+}
+
+func propsToFileLogWriter(props []xmlProperty, enabled bool) (LogWriter, error) {
 	file := ""
 	format := "[%D %T] [%L] (%S) %M"
 	maxlines := 0
@@ -204,31 +351,132 @@ func xmlToFileLogWriter(filename string, props []xmlProperty, enabled bool) (*Fi
 			daily = strings.Trim(prop.Value, " \r\n") != "false"
 		case "rotate":
 			rotate = strings.Trim(prop.Value, " \r\n") != "false"
-		default:
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Unknown property \"%s\" for file filter in %s\n", prop.Name, filename)
 		}
 	}
 
 	// Check properties
 	if len(file) == 0 {
-		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required property \"%s\" for file filter missing in %s\n", "filename", filename)
-		return nil, false
+		return nil, fmt.Errorf("required property \"%s\" for file filter missing", "filename")
 	}
 
 	// If it's disabled, we're just checking syntax
 	if !enabled {
-		return nil, true
+		return nil, nil
 	}
 
 	flw := NewFileLogWriter(file, rotate)
+	if flw == nil {
+		return nil, fmt.Errorf("could not create file filter for %s", file)
+	}
 	flw.SetFormat(format)
 	flw.SetRotateLines(maxlines)
 	flw.SetRotateSize(maxsize)
 	flw.SetRotateDaily(daily)
-	return flw, true
+	return flw, nil
+}
+
+func propsToTimeFileLogWriter(props []xmlProperty, enabled bool) (LogWriter, error) {
+	file := ""
+	format := "[%D %T] [%L] (%S) %M"
+	when := "MIDNIGHT"
+	backupCount := 0
+	compress := false
+	codec := ""
+	maxsize := 0
+	maxbackupsize := 0
+	var maxage time.Duration
+	binaryframe := false
+	audit := false
+	auditkeyfile := ""
+
+	// Parse properties
+	for _, prop := range props {
+		value := strings.Trim(prop.Value, " \r\n")
+		switch prop.Name {
+		case "filename":
+			file = value
+		case "format":
+			format = value
+		case "when":
+			when = value
+		case "backupcount":
+			backupCount, _ = strconv.Atoi(value)
+		case "compress":
+			compress = value != "false"
+		case "codec":
+			codec = value
+		case "maxsize":
+			maxsize = strToNumSuffix(value, 1024)
+		case "maxbackupsize":
+			maxbackupsize = strToNumSuffix(value, 1024)
+		case "binaryframe":
+			binaryframe = value != "false"
+		case "audit":
+			audit = value != "false"
+		case "auditkeyfile":
+			auditkeyfile = value
+		case "maxage":
+			var err error
+			if maxage, err = strToDuration(value); err != nil {
+				return nil, fmt.Errorf("invalid property \"%s\" for timefile filter: %s", prop.Name, err)
+			}
+		}
+	}
+
+	// Check properties
+	if len(file) == 0 {
+		return nil, fmt.Errorf("required property \"%s\" for timefile filter missing", "filename")
+	}
+	if len(codec) > 0 {
+		if _, err := GetCompressCodec(codec); err != nil {
+			return nil, fmt.Errorf("invalid property \"%s\" for timefile filter: %s", "codec", err)
+		}
+	}
+	if !WhenIsValid(when) {
+		return nil, fmt.Errorf("invalid property \"%s\" for timefile filter: %s", "when", when)
+	}
+	if len(auditkeyfile) > 0 && !audit {
+		return nil, fmt.Errorf("property \"%s\" for timefile filter requires \"%s\"", "auditkeyfile", "audit")
+	}
+	if audit && binaryframe {
+		return nil, fmt.Errorf("property \"%s\" for timefile filter could not be used with \"%s\"", "audit", "binaryframe")
+	}
+
+	// If it's disabled, we're just checking syntax
+	if !enabled {
+		return nil, nil
+	}
+
+	// hash chain of records, HMAC with key in file
+	var auditkey []byte
+	if len(auditkeyfile) > 0 {
+		data, err := ioutil.ReadFile(auditkeyfile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid property \"%s\" for timefile filter: %s", "auditkeyfile", err)
+		}
+		auditkey = bytes.TrimSpace(data)
+	}
+
+	tlw := NewTimeFileLogWriterWithOptions(file, when, backupCount, compress, TimeFileOptions{
+		MaxBackupSize: int64(maxbackupsize),
+		MaxBackupAge:  maxage,
+		BinaryFrame:   binaryframe,
+		Audit:         audit,
+		AuditKey:      auditkey,
+	})
+	if tlw == nil {
+		return nil, fmt.Errorf("could not create timefile filter for %s", file)
+	}
+	// codec only takes effect if compress is true
+	if len(codec) > 0 {
+		tlw.SetCompressCodec(codec)
+	}
+	tlw.SetFormat(format)
+	tlw.SetRotateSize(maxsize)
+	return tlw, nil
 }
 
-func xmlToXMLLogWriter(filename string, props []xmlProperty, enabled bool) (*FileLogWriter, bool) {
+func propsToXMLLogWriter(props []xmlProperty, enabled bool) (LogWriter, error) {
 	file := ""
 	maxrecords := 0
 	maxsize := 0
@@ -248,32 +496,38 @@ func xmlToXMLLogWriter(filename string, props []xmlProperty, enabled bool) (*Fil
 			daily = strings.Trim(prop.Value, " \r\n") != "false"
 		case "rotate":
 			rotate = strings.Trim(prop.Value, " \r\n") != "false"
-		default:
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Unknown property \"%s\" for xml filter in %s\n", prop.Name, filename)
 		}
 	}
 
 	// Check properties
 	if len(file) == 0 {
-		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required property \"%s\" for xml filter missing in %s\n", "filename", filename)
-		return nil, false
+		return nil, fmt.Errorf("required property \"%s\" for xml filter missing", "filename")
 	}
 
 	// If it's disabled, we're just checking syntax
 	if !enabled {
-		return nil, true
+		return nil, nil
 	}
 
 	xlw := NewXMLLogWriter(file, rotate)
+	if xlw == nil {
+		return nil, fmt.Errorf("could not create xml filter for %s", file)
+	}
 	xlw.SetRotateLines(maxrecords)
 	xlw.SetRotateSize(maxsize)
 	xlw.SetRotateDaily(daily)
-	return xlw, true
+	return xlw, nil
 }
 
-func xmlToSocketLogWriter(filename string, props []xmlProperty, enabled bool) (SocketLogWriter, bool) {
+func propsToSocketLogWriter(props []xmlProperty, enabled bool) (LogWriter, error) {
 	endpoint := ""
 	protocol := "udp"
+	reconnect := false
+	format := LogFormat
+	framing := FRAME_NEWLINE
+	buffersize := STREAM_BUFFER_SIZE
+	spillfile := ""
+	spillsize := STREAM_SPILL_SIZE
 
 	// Parse properties
 	for _, prop := range props {
@@ -282,21 +536,147 @@ func xmlToSocketLogWriter(filename string, props []xmlProperty, enabled bool) (S
 			endpoint = strings.Trim(prop.Value, " \r\n")
 		case "protocol":
 			protocol = strings.Trim(prop.Value, " \r\n")
-		default:
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Unknown property \"%s\" for file filter in %s\n", prop.Name, filename)
+		case "reconnect":
+			reconnect = strings.Trim(prop.Value, " \r\n") != "false"
+		case "format":
+			format = strings.Trim(prop.Value, " \r\n")
+		case "framing":
+			switch strings.Trim(prop.Value, " \r\n") {
+			case "newline":
+				framing = FRAME_NEWLINE
+			case "length":
+				framing = FRAME_LENGTH
+			default:
+				return nil, fmt.Errorf("invalid property \"%s\" for socket filter: %s", prop.Name, prop.Value)
+			}
+		case "buffersize":
+			buffersize = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1024)
+		case "spillfile":
+			spillfile = strings.Trim(prop.Value, " \r\n")
+		case "spillsize":
+			spillsize = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1024)
+		}
+	}
+
+	// Check properties
+	if len(endpoint) == 0 {
+		return nil, fmt.Errorf("required property \"%s\" for socket filter missing", "endpoint")
+	}
+	if spillsize <= 0 {
+		return nil, fmt.Errorf("invalid property \"%s\" for socket filter: %d", "spillsize", spillsize)
+	}
+
+	// If it's disabled, we're just checking syntax
+	if !enabled {
+		return nil, nil
+	}
+
+	// stream writer reconnects and buffers records, see StreamWriter
+	if reconnect || protocol == "tls" {
+		w := NewStreamWriter(endpoint, protocol, endpoint, format)
+		if w == nil {
+			return nil, fmt.Errorf("could not create socket filter for %s", endpoint)
+		}
+		w.SetFraming(framing).SetBufferSize(buffersize)
+		if len(spillfile) > 0 {
+			w.SetSpillFile(spillfile, int64(spillsize))
+		}
+		return w, nil
+	}
+
+	w := NewSocketLogWriter(protocol, endpoint)
+	if w == nil {
+		return nil, fmt.Errorf("could not create socket filter for %s", endpoint)
+	}
+	return w, nil
+}
+
+func propsToPacketWriter(props []xmlProperty, enabled bool) (LogWriter, error) {
+	name := ""
+	endpoint := ""
+	protocol := "udp"
+	format := LogFormat
+
+	// Parse properties
+	for _, prop := range props {
+		value := strings.Trim(prop.Value, " \r\n")
+		switch prop.Name {
+		case "name":
+			name = value
+		case "endpoint":
+			endpoint = value
+		case "protocol":
+			protocol = value
+		case "format":
+			format = value
 		}
 	}
 
 	// Check properties
 	if len(endpoint) == 0 {
-		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required property \"%s\" for file filter missing in %s\n", "endpoint", filename)
-		return nil, false
+		return nil, fmt.Errorf("required property \"%s\" for packet filter missing", "endpoint")
+	}
+	if len(name) == 0 {
+		name = endpoint
 	}
 
 	// If it's disabled, we're just checking syntax
 	if !enabled {
-		return nil, true
+		return nil, nil
 	}
 
-	return NewSocketLogWriter(protocol, endpoint), true
+	w := NewPacketWriter(name, protocol, endpoint, format)
+	if w == nil {
+		return nil, fmt.Errorf("could not create packet filter for %s", endpoint)
+	}
+	return w, nil
+}
+
+func propsToSyslogWriter(props []xmlProperty, enabled bool) (LogWriter, error) {
+	network := "unixgram"
+	address := "/dev/log"
+	rfc := SYSLOG_RFC3164
+	facility := FACILITY_USER
+	tag := ""
+	format := FORMAT_SYSLOG
+
+	// Parse properties
+	for _, prop := range props {
+		value := strings.Trim(prop.Value, " \r\n")
+		switch prop.Name {
+		case "network":
+			network = value
+		case "address":
+			address = value
+		case "rfc":
+			switch value {
+			case "3164":
+				rfc = SYSLOG_RFC3164
+			case "5424":
+				rfc = SYSLOG_RFC5424
+			default:
+				return nil, fmt.Errorf("invalid property \"%s\" for syslog filter: %s", prop.Name, value)
+			}
+		case "facility":
+			var err error
+			if facility, err = ParseFacility(value); err != nil {
+				return nil, fmt.Errorf("invalid property \"%s\" for syslog filter: %s", prop.Name, err)
+			}
+		case "tag":
+			tag = value
+		case "format":
+			format = value
+		}
+	}
+
+	// If it's disabled, we're just checking syntax
+	if !enabled {
+		return nil, nil
+	}
+
+	w := NewSyslogWriter(address, network, address, rfc, facility, tag)
+	if w == nil {
+		return nil, fmt.Errorf("could not create syslog filter for %s", address)
+	}
+	return w.SetFormat(format), nil
 }
@@ -0,0 +1,561 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// configfile implements configuration of logger in JSON, YAML, TOML or XML
+/*
+Usage:
+    // load configuration, format is decided by extension of the file
+    // (.json, .yaml, .yml, .toml or .xml)
+    if err := logger.LoadConfigFile("conf/log.yaml"); err != nil {
+        return err
+    }
+
+    // or check the configuration before using it
+    cfg, err := log4go.ReadConfigFile("conf/log.toml")
+    if err != nil {
+        return err
+    }
+    newLogger, err := cfg.Build()
+    ...
+    // apply module levels after newLogger is installed
+    log4go.SetModuleLevels(cfg.ModuleLevels())
+
+Example of YAML configuration:
+    filters:
+      - tag: stdout
+        type: console
+        level: INFO
+      - tag: access
+        type: timefile
+        level: DEBUG
+        properties:
+          filename: log/access.log
+          when: H
+          backupcount: 24
+          maxage: 7d
+      - tag: remote
+        type: packet
+        level: INFO
+        enabled: false
+        properties:
+          endpoint: 127.0.0.1:514
+    loggers:
+      - name: bfe.route
+        level: DEBUG
+
+Filter types are console, file, timefile, xml, socket, packet and syslog, with
+the same properties as XML configuration (see LoadConfiguration). Properties
+redact, redactfields and redactmask are accepted by all types, see redact.go.
+Filters are enabled unless "enabled" is false; disabled filters are checked
+but not created.
+Unknown fields, unknown properties and invalid values are errors.
+*/
+
+package log4go
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// formats of configuration file
+const (
+	CONFIG_JSON = "json"
+	CONFIG_YAML = "yaml"
+	CONFIG_TOML = "toml"
+	CONFIG_XML  = "xml"
+)
+
+// LoggerConfig is configuration of logger
+type LoggerConfig struct {
+	Filters []FilterConfig `json:"filters" yaml:"filters" toml:"filters"`
+	Loggers []ModuleConfig `json:"loggers" yaml:"loggers" toml:"loggers"` // levels of named modules
+}
+
+// FilterConfig is configuration of a filter and its writer
+type FilterConfig struct {
+	Tag        string                 `json:"tag" yaml:"tag" toml:"tag"`
+	Type       string                 `json:"type" yaml:"type" toml:"type"`
+	Level      string                 `json:"level" yaml:"level" toml:"level"`
+	Enabled    *bool                  `json:"enabled" yaml:"enabled" toml:"enabled"` // true if not set
+	Properties map[string]interface{} `json:"properties" yaml:"properties" toml:"properties"`
+}
+
+// ModuleConfig is level of named module, see SetModuleLevel
+type ModuleConfig struct {
+	Name  string `json:"name" yaml:"name" toml:"name"`
+	Level string `json:"level" yaml:"level" toml:"level"`
+}
+
+// ReadConfigFile reads configuration from file, format of which is decided
+// by extension of the file. The configuration is validated.
+func ReadConfigFile(filename string) (*LoggerConfig, error) {
+	var format string
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		format = CONFIG_JSON
+	case ".yaml", ".yml":
+		format = CONFIG_YAML
+	case ".toml":
+		format = CONFIG_TOML
+	case ".xml":
+		format = CONFIG_XML
+	default:
+		return nil, fmt.Errorf("unknown format of configuration file %s", filename)
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := ParseConfig(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return cfg, nil
+}
+
+// ParseConfig parses configuration in given format (CONFIG_JSON,
+// CONFIG_YAML, CONFIG_TOML or CONFIG_XML). The configuration is validated.
+func ParseConfig(data []byte, format string) (*LoggerConfig, error) {
+	cfg := new(LoggerConfig)
+	switch format {
+	case CONFIG_JSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		decoder.UseNumber()
+		if err := decoder.Decode(cfg); err != nil {
+			return nil, err
+		}
+	case CONFIG_YAML:
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil {
+			return nil, err
+		}
+	case CONFIG_TOML:
+		meta, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return nil, err
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("unknown field %s", undecoded[0])
+		}
+	case CONFIG_XML:
+		var err error
+		if cfg, err = parseXMLConfig(data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown format of configuration: %s", format)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// parseXMLConfig converts XML configuration, see LoadConfiguration
+func parseXMLConfig(data []byte) (*LoggerConfig, error) {
+	xc := new(xmlLoggerConfig)
+	if err := xml.Unmarshal(data, xc); err != nil {
+		return nil, err
+	}
+
+	cfg := new(LoggerConfig)
+	for _, xmlfilt := range xc.Filter {
+		if len(xmlfilt.Enabled) == 0 {
+			return nil, fmt.Errorf("required attribute %s for filter %s missing", "enabled", xmlfilt.Tag)
+		}
+		enabled := xmlfilt.Enabled != "false"
+		props := make(map[string]interface{}, len(xmlfilt.Property))
+		for _, prop := range xmlfilt.Property {
+			props[prop.Name] = strings.Trim(prop.Value, " \r\n")
+		}
+		cfg.Filters = append(cfg.Filters, FilterConfig{
+			Tag:        xmlfilt.Tag,
+			Type:       xmlfilt.Type,
+			Level:      xmlfilt.Level,
+			Enabled:    &enabled,
+			Properties: props,
+		})
+	}
+	for _, xmlmod := range xc.Module {
+		cfg.Loggers = append(cfg.Loggers, ModuleConfig{Name: xmlmod.Name, Level: xmlmod.Level})
+	}
+	return cfg, nil
+}
+
+// IsEnabled checks whether the filter is enabled
+func (fc *FilterConfig) IsEnabled() bool {
+	return fc.Enabled == nil || *fc.Enabled
+}
+
+// sameWriter checks whether writer of the filter is configured the same as
+// writer of other filter. Level and redaction are not compared.
+func (fc *FilterConfig) sameWriter(other *FilterConfig) bool {
+	if fc.Type != other.Type {
+		return false
+	}
+	props, err := fc.properties()
+	if err != nil {
+		return false
+	}
+	otherProps, err := other.properties()
+	if err != nil {
+		return false
+	}
+
+	props = writerProperties(props)
+	otherProps = writerProperties(otherProps)
+	if len(props) != len(otherProps) {
+		return false
+	}
+	for i := range props {
+		if props[i] != otherProps[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// writerProperties returns properties except those for redaction
+func writerProperties(props []xmlProperty) []xmlProperty {
+	ret := make([]xmlProperty, 0, len(props))
+	for _, prop := range props {
+		if prop.Name != "redact" && prop.Name != "redactfields" && prop.Name != "redactmask" {
+			ret = append(ret, prop)
+		}
+	}
+	return ret
+}
+
+// filePath returns absolute path of file written by the filter, or "" if
+// it does not write to a file
+func (fc *FilterConfig) filePath() string {
+	switch fc.Type {
+	case "file", "timefile", "xml":
+	default:
+		return ""
+	}
+	props, _ := fc.properties()
+	for _, prop := range props {
+		if prop.Name == "filename" {
+			path, err := filepath.Abs(strings.Trim(prop.Value, " \r\n"))
+			if err != nil {
+				return ""
+			}
+			return path
+		}
+	}
+	return ""
+}
+
+// writerPath returns absolute path of file written by the writer, or "" if
+// it does not write to a file
+func writerPath(w LogWriter) string {
+	switch w := w.(type) {
+	case *FileLogWriter:
+		if path, err := filepath.Abs(w.filename); err == nil {
+			return path
+		}
+	case *TimeFileLogWriter:
+		return w.baseFilename
+	}
+	return ""
+}
+
+// properties converts properties to the form of XML configuration, sorted by name
+func (fc *FilterConfig) properties() ([]xmlProperty, error) {
+	props := make([]xmlProperty, 0, len(fc.Properties))
+	for name, value := range fc.Properties {
+		str, err := propertyString(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid property \"%s\" for %s filter: %s", name, fc.Type, err)
+		}
+		props = append(props, xmlProperty{Name: name, Value: str})
+	}
+	sort.Slice(props, func(i, j int) bool {
+		return props[i].Name < props[j].Name
+	})
+	return props, nil
+}
+
+// propertyString converts scalar value of property to string
+func propertyString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case json.Number:
+		return v.String(), nil
+	default:
+		return "", fmt.Errorf("value should be string, number or bool, got %T", value)
+	}
+}
+
+// validateProperty checks value of property by its kind
+func validateProperty(kind int, value string) error {
+	var err error
+	switch kind {
+	case propBool:
+		if value != "true" && value != "false" {
+			err = fmt.Errorf("invalid bool: %s", value)
+		}
+	case propInt:
+		_, err = strconv.Atoi(value)
+	case propSize:
+		if len(value) > 1 && strings.ContainsRune("KkMmGg", rune(value[len(value)-1])) {
+			value = value[:len(value)-1]
+		}
+		_, err = strconv.Atoi(value)
+	case propDuration:
+		_, err = strToDuration(value)
+	}
+	return err
+}
+
+// validate checks the filter, and returns its properties
+func (fc *FilterConfig) validate() ([]xmlProperty, error) {
+	if len(fc.Tag) == 0 {
+		return nil, fmt.Errorf("required field %s for filter missing", "tag")
+	}
+	if _, ok := filterLevels[fc.Level]; !ok {
+		return nil, fmt.Errorf("field %s for filter %s has unknown value: %q", "level", fc.Tag, fc.Level)
+	}
+	if _, ok := filterProperties[fc.Type]; !ok {
+		return nil, fmt.Errorf("field %s for filter %s has unknown value: %q", "type", fc.Tag, fc.Type)
+	}
+
+	props, err := fc.properties()
+	if err != nil {
+		return nil, fmt.Errorf("filter %s: %s", fc.Tag, err)
+	}
+	for _, prop := range props {
+		kind, ok := filterProperty(fc.Type, prop.Name)
+		if !ok {
+			return nil, fmt.Errorf("filter %s: unknown property \"%s\" for %s filter", fc.Tag, prop.Name, fc.Type)
+		}
+		if err := validateProperty(kind, prop.Value); err != nil {
+			return nil, fmt.Errorf("filter %s: invalid property \"%s\" for %s filter: %s", fc.Tag, prop.Name, fc.Type, prop.Value)
+		}
+	}
+
+	// check values of properties, no writer is created
+	if _, err := propsToRedactor(props); err != nil {
+		return nil, fmt.Errorf("filter %s: %s", fc.Tag, err)
+	}
+	if _, err := newFilterWriter(fc.Type, props, false); err != nil {
+		return nil, fmt.Errorf("filter %s: %s", fc.Tag, err)
+	}
+	return props, nil
+}
+
+// Validate checks the configuration, without creating any writer. All the
+// errors found are returned.
+func (cfg *LoggerConfig) Validate() error {
+	var errs []error
+	tags := make(map[string]bool, len(cfg.Filters))
+	for i := range cfg.Filters {
+		fc := &cfg.Filters[i]
+		if tags[fc.Tag] {
+			errs = append(errs, fmt.Errorf("duplicate filter %s", fc.Tag))
+		}
+		tags[fc.Tag] = true
+
+		if _, err := fc.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, mc := range cfg.Loggers {
+		if len(mc.Name) == 0 {
+			errs = append(errs, fmt.Errorf("required field %s for logger missing", "name"))
+			continue
+		}
+		if _, err := ParseLevel(mc.Level); err != nil {
+			errs = append(errs, fmt.Errorf("field %s for logger %s has unknown value: %q", "level", mc.Name, mc.Level))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ModuleLevels returns levels of named modules in the configuration. Invalid
+// levels are skipped, see Validate.
+func (cfg *LoggerConfig) ModuleLevels() map[string]LevelType {
+	levels := make(map[string]LevelType, len(cfg.Loggers))
+	for _, mc := range cfg.Loggers {
+		if lvl, err := ParseLevel(mc.Level); err == nil && len(mc.Name) > 0 {
+			levels[mc.Name] = lvl
+		}
+	}
+	return levels
+}
+
+// Build creates a logger with writers of enabled filters. If any writer fails
+// to be created, writers created are closed and error is returned.
+//
+// Levels of modules are not set by Build; they should be applied by
+// SetModuleLevels(cfg.ModuleLevels()) when the logger is installed.
+func (cfg *LoggerConfig) Build() (Logger, error) {
+	return cfg.BuildFrom(nil, nil, 0)
+}
+
+// BuildFrom creates a logger like Build, to replace the old logger which is
+// built from oldCfg. No file is written by two writers at the same time:
+//   - filters with the same tag, type and properties in both configurations
+//     are reused, with level and redactor of the new configuration applied
+//     after the logger is built
+//   - other old filters writing to the same file as a new filter are shut
+//     down (see Shutdown) before the new writer is created, and records
+//     logged to them afterwards are dropped
+//
+// Other old filters are kept, they should be shut down after the new logger
+// is installed. Filters shut down by BuildFrom are skipped by Shutdown. If
+// the configuration is invalid, the old logger is not changed.
+//
+// PARAMS:
+//   - old: the old logger, which may still be in use; nil if none
+//   - oldCfg: configuration of the old logger; nil if unknown, no filter
+//     is reused then
+//   - timeout: max time to shut down old filters
+func (cfg *LoggerConfig) BuildFrom(old Logger, oldCfg *LoggerConfig, timeout time.Duration) (Logger, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	oldFilters := make(map[string]*FilterConfig)
+	if oldCfg != nil {
+		for i := range oldCfg.Filters {
+			if fc := &oldCfg.Filters[i]; fc.IsEnabled() {
+				oldFilters[fc.Tag] = fc
+			}
+		}
+	}
+
+	// find filters to reuse, and files to be written by new writers
+	reused := make(map[string]bool)
+	paths := make(map[string]bool)
+	for i := range cfg.Filters {
+		fc := &cfg.Filters[i]
+		if !fc.IsEnabled() {
+			continue
+		}
+		if ofc, ok := oldFilters[fc.Tag]; ok && old[fc.Tag] != nil && fc.sameWriter(ofc) {
+			reused[fc.Tag] = true
+			continue
+		}
+		if path := fc.filePath(); len(path) > 0 {
+			paths[path] = true
+		}
+	}
+
+	// shut down old writers of the files before new writers are created
+	retired := make(Logger)
+	for tag, filt := range old {
+		if reused[tag] {
+			continue
+		}
+		if path := writerPath(filt.LogWriter); len(path) > 0 && paths[path] {
+			retired[tag] = filt
+		}
+	}
+	if len(retired) > 0 {
+		if err := retired.Shutdown(timeout); err != nil {
+			fmt.Fprintf(os.Stderr, "BuildFrom(): close old writers: %s\n", err)
+		}
+	}
+
+	log := make(Logger, len(cfg.Filters))
+	redactors := make(map[string]*Redactor, len(cfg.Filters))
+	for i := range cfg.Filters {
+		fc := &cfg.Filters[i]
+		if !fc.IsEnabled() {
+			continue
+		}
+
+		props, _ := fc.properties()
+		redactors[fc.Tag], _ = propsToRedactor(props)
+		if reused[fc.Tag] {
+			log[fc.Tag] = old[fc.Tag]
+			continue
+		}
+		w, err := newFilterWriter(fc.Type, props, true)
+		if err != nil {
+			for tag, filt := range log {
+				if !reused[tag] {
+					filt.Close()
+				}
+			}
+			return nil, fmt.Errorf("filter %s: %s", fc.Tag, err)
+		}
+		log[fc.Tag] = &Filter{Level: filterLevels[fc.Level], LogWriter: w}
+	}
+
+	for i := range cfg.Filters {
+		fc := &cfg.Filters[i]
+		if filt, ok := log[fc.Tag]; ok && fc.IsEnabled() {
+			if reused[fc.Tag] {
+				filt.setLevel(filterLevels[fc.Level])
+			}
+			log.SetRedactor(fc.Tag, redactors[fc.Tag])
+		}
+	}
+	return log, nil
+}
+
+// LoadConfigFile loads configuration from file (see ReadConfigFile), and
+// replaces filters of the logger and module levels. Filters of the logger and
+// module levels are kept if the configuration is invalid, or any writer fails
+// to be created.
+func (log Logger) LoadConfigFile(filename string) error {
+	cfg, err := ReadConfigFile(filename)
+	if err != nil {
+		return err
+	}
+	newLog, err := cfg.Build()
+	if err != nil {
+		return err
+	}
+
+	log.Close()
+	for tag, filt := range newLog {
+		log[tag] = filt
+	}
+	SetModuleLevels(cfg.ModuleLevels())
+	return nil
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log4go
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testJSONConfig = `{
+  "filters": [
+    {"tag": "stdout", "type": "console", "level": "INFO", "properties": {"format": "%L %M"}},
+    {"tag": "access", "type": "timefile", "level": "DEBUG",
+     "properties": {"filename": "{dir}/access.log", "when": "H", "backupcount": 24, "maxsize": "10M", "maxage": "7d", "compress": false}},
+    {"tag": "file", "type": "file", "level": "WARNING", "properties": {"filename": "{dir}/file.log", "rotate": true, "maxlines": 1000}},
+    {"tag": "remote", "type": "packet", "level": "INFO", "properties": {"endpoint": "127.0.0.1:514"}},
+    {"tag": "socket", "type": "socket", "level": "INFO", "enabled": false, "properties": {"endpoint": "127.0.0.1:515", "framing": "length"}}
+  ],
+  "loggers": [{"name": "test.config", "level": "DEBUG"}]
+}`
+
+const testYAMLConfig = `
+filters:
+  - tag: stdout
+    type: console
+    level: INFO
+    properties:
+      format: "%L %M"
+  - tag: access
+    type: timefile
+    level: DEBUG
+    properties:
+      filename: "{dir}/access.log"
+      when: H
+      backupcount: 24
+      maxsize: 10M
+      maxage: 7d
+      compress: false
+  - tag: file
+    type: file
+    level: WARNING
+    properties:
+      filename: "{dir}/file.log"
+      rotate: true
+      maxlines: 1000
+  - tag: remote
+    type: packet
+    level: INFO
+    properties:
+      endpoint: 127.0.0.1:514
+  - tag: socket
+    type: socket
+    level: INFO
+    enabled: false
+    properties:
+      endpoint: 127.0.0.1:515
+      framing: length
+loggers:
+  - name: test.config
+    level: DEBUG
+`
+
+const testTOMLConfig = `
+[[filters]]
+tag = "stdout"
+type = "console"
+level = "INFO"
+properties = { format = "%L %M" }
+
+[[filters]]
+tag = "access"
+type = "timefile"
+level = "DEBUG"
+[filters.properties]
+filename = "{dir}/access.log"
+when = "H"
+backupcount = 24
+maxsize = "10M"
+maxage = "7d"
+compress = false
+
+[[filters]]
+tag = "file"
+type = "file"
+level = "WARNING"
+properties = { filename = "{dir}/file.log", rotate = true, maxlines = 1000 }
+
+[[filters]]
+tag = "remote"
+type = "packet"
+level = "INFO"
+properties = { endpoint = "127.0.0.1:514" }
+
+[[filters]]
+tag = "socket"
+type = "socket"
+level = "INFO"
+enabled = false
+properties = { endpoint = "127.0.0.1:515", framing = "length" }
+
+[[loggers]]
+name = "test.config"
+level = "DEBUG"
+`
+
+// writeConfig writes configuration to file in dir
+func writeConfig(t *testing.T, dir string, name string, content string) string {
+	path := filepath.Join(dir, name)
+	content = strings.Replace(content, "{dir}", dir, -1)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile(): %s", err)
+	}
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	configs := map[string]string{
+		"log.json": testJSONConfig,
+		"log.yaml": testYAMLConfig,
+		"log.toml": testTOMLConfig,
+	}
+	for name, content := range configs {
+		path := writeConfig(t, dir, name, content)
+
+		// module levels are not set by Build
+		cfg, err := ReadConfigFile(path)
+		if err != nil {
+			t.Fatalf("%s: ReadConfigFile(): %s", name, err)
+		}
+		built, err := cfg.Build()
+		if err != nil {
+			t.Fatalf("%s: Build(): %s", name, err)
+		}
+		built.Close()
+		if _, ok := GetModuleLevels()["test.config"]; ok {
+			t.Errorf("%s: module level should not be set by Build", name)
+		}
+		if lvl := cfg.ModuleLevels()["test.config"]; lvl != DEBUG {
+			t.Errorf("%s: got module level %d, want DEBUG", name, lvl)
+		}
+
+		// module levels set before are replaced
+		SetModuleLevel("test.old", ERROR)
+		l := make(Logger)
+		if err := l.LoadConfigFile(path); err != nil {
+			t.Errorf("%s: LoadConfigFile(): %s", name, err)
+			continue
+		}
+		if len(l) != 4 {
+			t.Errorf("%s: got %d filters, want 4", name, len(l))
+		}
+		if _, ok := l["stdout"].LogWriter.(FormatLogWriter); !ok {
+			t.Errorf("%s: unexpected writer of stdout %T", name, l["stdout"].LogWriter)
+		}
+		if w, ok := l["access"].LogWriter.(*TimeFileLogWriter); !ok || l["access"].Level != DEBUG {
+			t.Errorf("%s: unexpected filter access %+v", name, l["access"])
+		} else if w.maxSize != 10*1024*1024 || w.backupCount != 24 {
+			t.Errorf("%s: unexpected properties of access %d %d", name, w.maxSize, w.backupCount)
+		}
+		if _, ok := l["file"].LogWriter.(*FileLogWriter); !ok || l["file"].Level != WARNING {
+			t.Errorf("%s: unexpected filter file %+v", name, l["file"])
+		}
+		if _, ok := l["remote"].LogWriter.(*PacketWriter); !ok {
+			t.Errorf("%s: unexpected writer of remote %T", name, l["remote"].LogWriter)
+		}
+		if _, ok := l["socket"]; ok {
+			t.Errorf("%s: disabled filter should not be created", name)
+		}
+		if lvl, ok := GetModuleLevels()["test.config"]; !ok || lvl != DEBUG {
+			t.Errorf("%s: got module level %d, want DEBUG", name, lvl)
+		}
+		if _, ok := GetModuleLevels()["test.old"]; ok {
+			t.Errorf("%s: module level set before should be removed", name)
+		}
+		RemoveModuleLevel("test.config")
+		l.Close()
+	}
+}
+
+func TestLoadConfigFileError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	errConfigs := map[string]string{
+		"unknown field":    `{"filters": [{"tag": "a", "type": "console", "level": "INFO", "color": true}]}`,
+		"unknown property": `{"filters": [{"tag": "a", "type": "console", "level": "INFO", "properties": {"color": true}}]}`,
+		"unknown type":     `{"filters": [{"tag": "a", "type": "kafka", "level": "INFO"}]}`,
+		"unknown level":    `{"filters": [{"tag": "a", "type": "console", "level": "VERBOSE"}]}`,
+		"duplicate tag":    `{"filters": [{"tag": "a", "type": "console", "level": "INFO"}, {"tag": "a", "type": "console", "level": "INFO"}]}`,
+		"missing property": `{"filters": [{"tag": "a", "type": "file", "level": "INFO"}]}`,
+		"invalid size":     `{"filters": [{"tag": "a", "type": "file", "level": "INFO", "properties": {"filename": "a.log", "maxsize": "10X"}}]}`,
+		"invalid bool":     `{"filters": [{"tag": "a", "type": "file", "level": "INFO", "properties": {"filename": "a.log", "rotate": "yes"}}]}`,
+		"invalid when":     `{"filters": [{"tag": "a", "type": "timefile", "level": "INFO", "properties": {"filename": "a.log", "when": "Y"}}]}`,
+		"invalid value":    `{"filters": [{"tag": "a", "type": "console", "level": "INFO", "properties": {"format": ["%M"]}}]}`,
+		"invalid logger":   `{"loggers": [{"name": "a", "level": "VERBOSE"}]}`,
+		"unknown redact":   `{"filters": [{"tag": "a", "type": "console", "level": "INFO", "properties": {"redact": "password,bonus"}}]}`,
+	}
+	for name, content := range errConfigs {
+		if _, err := ParseConfig([]byte(content), CONFIG_JSON); err == nil {
+			t.Errorf("%s: error expected", name)
+		}
+	}
+
+	// filters are kept if configuration is invalid
+	l := make(Logger)
+	l.AddFilter("test", INFO, testWriter(func(*LogRecord) {}))
+	path := writeConfig(t, dir, "log.yaml", "filters:\n  - tag: a\n    type: kafka\n    level: INFO\n")
+	if err := l.LoadConfigFile(path); err == nil || !strings.Contains(err.Error(), "kafka") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, ok := l["test"]; !ok {
+		t.Errorf("filters should be kept")
+	}
+	if _, err := ReadConfigFile(filepath.Join(dir, "log.ini")); err == nil {
+		t.Errorf("error expected for unknown format")
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// context implements logging with request id carried in context
+/*
+Usage:
+    // request id is put into context by the server
+    ctx = log4go.ContextWithRequestID(ctx, reqId)
+
+    // or extracted from context by registered extractor, e.g. trace id
+    log4go.RegisterContextExtractor(func(ctx context.Context) string {
+        span := trace.SpanFromContext(ctx)
+        if span == nil {
+            return ""
+        }
+        return span.TraceID() + "/" + span.SpanID()
+    })
+
+    // request id is rendered by %R
+    w.SetFormat("[%D %T] [%L] [%R] (%S) %M")
+    logger.InfoCtx(ctx, "start processing %s", uri)
+
+Extractors are called in the order of registration, the first non-empty
+result is used. Request id set by ContextWithRequestID is checked before
+all extractors.
+*/
+
+package log4go
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ContextExtractor extracts request id (or trace id, span id) from context
+type ContextExtractor func(ctx context.Context) string
+
+// key of request id in context
+type requestIDKey struct{}
+
+var (
+	extractorLock sync.Mutex
+	extractors    atomic.Value // []ContextExtractor
+)
+
+// RegisterContextExtractor registers extractor of request id
+func RegisterContextExtractor(extractor ContextExtractor) {
+	extractorLock.Lock()
+	defer extractorLock.Unlock()
+
+	old, _ := extractors.Load().([]ContextExtractor)
+	list := make([]ContextExtractor, len(old), len(old)+1)
+	copy(list, old)
+	extractors.Store(append(list, extractor))
+}
+
+// ContextWithRequestID returns a copy of ctx carrying the request id
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// ContextRequestID returns request id carried in ctx, or "" if not found
+func ContextRequestID(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok && len(id) > 0 {
+		return id
+	}
+
+	list, _ := extractors.Load().([]ContextExtractor)
+	for _, extract := range list {
+		if id := extract(ctx); len(id) > 0 {
+			return id
+		}
+	}
+	return ""
+}
+
+// FinestCtx logs a message at the finest log level, with request id in ctx.
+// See Logger.Debug for an explanation of the arguments.
+func (log Logger) FinestCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	log.intLogkv(ctx, FINEST, nil, nil, arg0, args...)
+}
+
+// FineCtx logs a message at the fine log level, with request id in ctx.
+// See Logger.Debug for an explanation of the arguments.
+func (log Logger) FineCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	log.intLogkv(ctx, FINE, nil, nil, arg0, args...)
+}
+
+// DebugCtx logs a message at the debug log level, with request id in ctx.
+// See Logger.Debug for an explanation of the arguments.
+func (log Logger) DebugCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	log.intLogkv(ctx, DEBUG, nil, nil, arg0, args...)
+}
+
+// TraceCtx logs a message at the trace log level, with request id in ctx.
+// See Logger.Debug for an explanation of the arguments.
+func (log Logger) TraceCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	log.intLogkv(ctx, TRACE, nil, nil, arg0, args...)
+}
+
+// InfoCtx logs a message at the info log level, with request id in ctx.
+// See Logger.Debug for an explanation of the arguments.
+func (log Logger) InfoCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	log.intLogkv(ctx, INFO, nil, nil, arg0, args...)
+}
+
+// WarnCtx logs a message at the warning log level, with request id in ctx,
+// and returns the formatted error. See Logger.Warn for an explanation of the
+// arguments.
+func (log Logger) WarnCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	f := newFormatted(arg0, args...)
+	log.intLogkv(ctx, WARNING, nil, nil, f)
+	return errors.New(f.msg)
+}
+
+// ErrorCtx logs a message at the error log level, with request id in ctx,
+// and returns the formatted error. See Logger.Warn for an explanation of the
+// arguments.
+func (log Logger) ErrorCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	f := newFormatted(arg0, args...)
+	log.intLogkv(ctx, ERROR, nil, nil, f)
+	return errors.New(f.msg)
+}
+
+// CriticalCtx logs a message at the critical log level, with request id in
+// ctx, and returns the formatted error. See Logger.Warn for an explanation of
+// the arguments.
+func (log Logger) CriticalCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	f := newFormatted(arg0, args...)
+	log.intLogkv(ctx, CRITICAL, nil, nil, f)
+	return errors.New(f.msg)
+}
+
+// FinestCtx logs a message at the finest log level, with request id in ctx.
+func (e *Entry) FinestCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	e.logger.intLogkv(ctx, FINEST, e, nil, arg0, args...)
+}
+
+// FineCtx logs a message at the fine log level, with request id in ctx.
+func (e *Entry) FineCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	e.logger.intLogkv(ctx, FINE, e, nil, arg0, args...)
+}
+
+// DebugCtx logs a message at the debug log level, with request id in ctx.
+func (e *Entry) DebugCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	e.logger.intLogkv(ctx, DEBUG, e, nil, arg0, args...)
+}
+
+// TraceCtx logs a message at the trace log level, with request id in ctx.
+func (e *Entry) TraceCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	e.logger.intLogkv(ctx, TRACE, e, nil, arg0, args...)
+}
+
+// InfoCtx logs a message at the info log level, with request id in ctx.
+func (e *Entry) InfoCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	e.logger.intLogkv(ctx, INFO, e, nil, arg0, args...)
+}
+
+// WarnCtx logs a message at the warning log level, with request id in ctx,
+// and returns the formatted error.
+func (e *Entry) WarnCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	f := newFormatted(arg0, args...)
+	e.logger.intLogkv(ctx, WARNING, e, nil, f)
+	return errors.New(f.msg)
+}
+
+// ErrorCtx logs a message at the error log level, with request id in ctx,
+// and returns the formatted error.
+func (e *Entry) ErrorCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	f := newFormatted(arg0, args...)
+	e.logger.intLogkv(ctx, ERROR, e, nil, f)
+	return errors.New(f.msg)
+}
+
+// CriticalCtx logs a message at the critical log level, with request id in
+// ctx, and returns the formatted error.
+func (e *Entry) CriticalCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	f := newFormatted(arg0, args...)
+	e.logger.intLogkv(ctx, CRITICAL, e, nil, f)
+	return errors.New(f.msg)
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log4go
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// key of trace id in context, for test
+type testTraceKey struct{}
+
+func TestContextRequestID(t *testing.T) {
+	ctx := context.Background()
+	if id := ContextRequestID(ctx); id != "" {
+		t.Errorf("got %q, want empty", id)
+	}
+
+	RegisterContextExtractor(func(ctx context.Context) string {
+		id, _ := ctx.Value(testTraceKey{}).(string)
+		return id
+	})
+	traceCtx := context.WithValue(ctx, testTraceKey{}, "trace-1")
+	if id := ContextRequestID(traceCtx); id != "trace-1" {
+		t.Errorf("got %q, want trace-1", id)
+	}
+
+	// request id set by ContextWithRequestID is preferred
+	reqCtx := ContextWithRequestID(traceCtx, "req-1")
+	if id := ContextRequestID(reqCtx); id != "req-1" {
+		t.Errorf("got %q, want req-1", id)
+	}
+}
+
+func TestInfoCtx(t *testing.T) {
+	var recs []*LogRecord
+	l := make(Logger)
+	l.AddFilter("test", INFO, testWriter(func(rec *LogRecord) {
+		recs = append(recs, rec)
+	}))
+
+	ctx := ContextWithRequestID(context.Background(), "abc")
+	l.InfoCtx(ctx, "hello %s", "world")
+	l.DebugCtx(ctx, "not logged")
+	err := l.Named("rpc").With("method", "get").WarnCtx(ctx, "slow")
+
+	if len(recs) != 2 {
+		t.Fatalf("got %d records, want 2", len(recs))
+	}
+	if got := FormatLogRecord("[%L] [%R] %M", recs[0]); got != "[INFO] [abc] hello world\n" {
+		t.Errorf("got %q", got)
+	}
+	if !strings.Contains(recs[0].Source, "TestInfoCtx") {
+		t.Errorf("unexpected source %q", recs[0].Source)
+	}
+	if got := FormatLogRecord("[%N] [%R] %M", recs[1]); got != "[rpc] [abc] slow method=get\n" {
+		t.Errorf("got %q", got)
+	}
+	if err == nil || err.Error() != "slow" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if got := FormatLogRecordJSON(recs[0]); !strings.Contains(got, `"request_id":"abc"`) {
+		t.Errorf("request_id not found in %s", got)
+	}
+}
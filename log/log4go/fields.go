@@ -0,0 +1,448 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// fields implements structured key/value logging
+/*
+Usage:
+    // log with key/value pairs
+    logger.InfoKV("request done", "request_id", reqId, "latency", latency)
+
+    // bind fields to all following records
+    reqLog := logger.With("request_id", reqId)
+    reqLog.Info("start processing %s", uri)
+    reqLog.WarnKV("slow backend", "backend", addr, "latency", latency)
+
+Fields are carried in LogRecord.Fields, and rendered by the %F verb of the
+pattern formatter (or appended to %M if the format has no %F), as
+" key=value". Keys and values with space, '=', '"' or control characters are
+quoted, e.g., "user name"="bob smith".
+
+Arguments of Entry methods are the same as those of Logger methods: []byte is
+logged as binary record by Info, and formatted as text by others.
+*/
+package log4go
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field is a typed key/value pair attached to a log record
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Fields converts alternating keys and values to fields
+//
+// Keys which are not string are converted with fmt.Sprint. Values which are
+// already of type Field are used as is. A key without value is given
+// the value "(MISSING)".
+func Fields(keyvals ...interface{}) []Field {
+	return appendFields(nil, keyvals)
+}
+
+// appendFields converts keyvals to fields and appends them to fields
+func appendFields(fields []Field, keyvals []interface{}) []Field {
+	for i := 0; i < len(keyvals); i++ {
+		if f, ok := keyvals[i].(Field); ok {
+			fields = append(fields, f)
+			continue
+		}
+
+		key, ok := keyvals[i].(string)
+		if !ok {
+			key = fmt.Sprint(keyvals[i])
+		}
+		if i+1 < len(keyvals) {
+			fields = append(fields, Field{key, keyvals[i+1]})
+			i++
+		} else {
+			fields = append(fields, Field{key, "(MISSING)"})
+		}
+	}
+	return fields
+}
+
+// fieldValueString converts value of field to string
+func fieldValueString(value interface{}) string {
+	var str string
+	switch v := value.(type) {
+	case nil:
+		return "<nil>"
+	case string:
+		str = v
+	case []byte:
+		str = string(v)
+	case error:
+		str = v.Error()
+	case time.Time:
+		return v.Format("2006-01-02T15:04:05.000000Z07:00")
+	case fmt.Stringer:
+		str = v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+
+	if needQuote(str) {
+		return strconv.Quote(str)
+	}
+	return str
+}
+
+// needQuote checks whether str should be quoted in key=value output
+func needQuote(str string) bool {
+	if len(str) == 0 {
+		return true
+	}
+	for _, r := range str {
+		if r <= ' ' || r == '=' || r == '"' || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// writeFields writes fields in format of " k1=v1 k2=v2", keys and values are
+// quoted if needed
+func writeFields(out *bytes.Buffer, fields []Field) {
+	for _, f := range fields {
+		out.WriteByte(' ')
+		if needQuote(f.Key) {
+			out.WriteString(strconv.Quote(f.Key))
+		} else {
+			out.WriteString(f.Key)
+		}
+		out.WriteByte('=')
+		out.WriteString(fieldValueString(f.Value))
+	}
+}
+
+/****** Entry ******/
+
+// An Entry is a Logger bound with a set of fields. All records logged
+// through the entry carry these fields.
+type Entry struct {
+	logger Logger
+	name   string // name of module, see Named()
+	fields []Field
+	skip   int // number of stack frames to skip, see WithCallerSkip()
+}
+
+// With creates an entry with the given key/value pairs bound
+func (log Logger) With(keyvals ...interface{}) *Entry {
+	return &Entry{
+		logger: log,
+		fields: appendFields(nil, keyvals),
+	}
+}
+
+// With creates a new entry with fields of e and the given key/value pairs
+func (e *Entry) With(keyvals ...interface{}) *Entry {
+	fields := make([]Field, len(e.fields), len(e.fields)+len(keyvals)/2)
+	copy(fields, e.fields)
+
+	return &Entry{
+		logger: e.logger,
+		name:   e.name,
+		fields: appendFields(fields, keyvals),
+		skip:   e.skip,
+	}
+}
+
+// Fields returns the fields bound to the entry
+func (e *Entry) Fields() []Field {
+	return e.fields
+}
+
+// Send a log message with structured fields internally
+//
+// Message is generated from arg0 and args by formatMessage. If arg0 is
+// []byte and lvl is INFO, a binary record is logged as Logger.Info does. Name,
+// fields and caller skip are taken from e if it is not nil. keyvals is
+// converted to fields and appended to fields of e. Level of module is
+// checked if entry is named (see SetModuleLevel). Request ID is extracted
+// from ctx if it is not nil (see RegisterContextExtractor).
+func (log Logger) intLogkv(ctx context.Context, lvl LevelType, e *Entry,
+	keyvals []interface{}, arg0 interface{}, args ...interface{}) {
+	var name string
+	var fields []Field
+	skip := 0
+	if e != nil {
+		name, fields, skip = e.name, e.fields, e.skip
+	}
+
+	mf := log.newModuleFilter(name)
+
+	// Determine if any logging will be done
+	accepted := false
+	for _, filt := range log {
+		if mf.accept(lvl, filt) {
+			accepted = true
+			break
+		}
+	}
+	if !accepted {
+		return
+	}
+
+	var c *Caller
+	data, binary := arg0.([]byte)
+	binary = binary && lvl == INFO
+	if binary {
+		if len(data) == 0 {
+			// no data
+			return
+		}
+		if EnableSrcForBinLog {
+			c = callerAt(2 + skip)
+		}
+	} else {
+		// Determine caller func
+		c = callerAt(2 + skip)
+
+		// Drop repeated records, see SetLogSampling
+		var format string
+		switch first := arg0.(type) {
+		case string:
+			format = first
+		case formatted:
+			format = first.format
+		default:
+			format = c.Source()
+		}
+		if format == "" {
+			format = c.Source()
+		}
+		if !sampleAllow(log, lvl, format, c.Source()) {
+			return
+		}
+	}
+
+	var msg string
+	if !binary {
+		msg = formatMessage(arg0, args...)
+	}
+
+	if len(keyvals) > 0 {
+		all := make([]Field, len(fields), len(fields)+len(keyvals)/2)
+		copy(all, fields)
+		fields = appendFields(all, keyvals)
+	}
+
+	// Make the log record
+	rec := getRecord()
+	rec.Level = lvl
+	rec.Created = time.Now()
+	rec.Source = c.Source()
+	rec.Caller = c
+	rec.Message = msg
+	if binary {
+		rec.Binary = data
+	}
+	rec.Fields = fields
+	rec.Name = name
+	if ctx != nil {
+		rec.RequestID = ContextRequestID(ctx)
+	}
+
+	// Dispatch the logs
+	log.dispatch(rec, mf)
+}
+
+// formatted is message formatted by caller (e.g., Entry.Warn, which returns
+// it as error), with format string for sampling
+type formatted struct {
+	format string // format string, empty if not formatted from a string
+	msg    string
+}
+
+// newFormatted formats message from arg0 and args, see formatMessage
+func newFormatted(arg0 interface{}, args ...interface{}) formatted {
+	format, _ := arg0.(string)
+	return formatted{format: format, msg: formatMessage(arg0, args...)}
+}
+
+// formatMessage generates message from arg0 and args, in the same way as
+// Debug(): string is used as format if there is any argument, closure is
+// called, and others (including []byte) are formatted like fmt.Sprint
+func formatMessage(arg0 interface{}, args ...interface{}) string {
+	switch first := arg0.(type) {
+	case formatted:
+		return first.msg
+	case string:
+		if len(args) == 0 {
+			return first
+		}
+		return fmt.Sprintf(first, args...)
+	case func() string:
+		return first()
+	default:
+		return fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
+	}
+}
+
+// FinestKV logs a message with key/value pairs at the finest log level.
+func (log Logger) FinestKV(msg string, keyvals ...interface{}) {
+	log.intLogkv(nil, FINEST, nil, keyvals, msg)
+}
+
+// FineKV logs a message with key/value pairs at the fine log level.
+func (log Logger) FineKV(msg string, keyvals ...interface{}) {
+	log.intLogkv(nil, FINE, nil, keyvals, msg)
+}
+
+// DebugKV logs a message with key/value pairs at the debug log level.
+// keyvals are alternating keys and values, e.g.
+//
+//	log.DebugKV("request done", "request_id", id, "latency", latency)
+func (log Logger) DebugKV(msg string, keyvals ...interface{}) {
+	log.intLogkv(nil, DEBUG, nil, keyvals, msg)
+}
+
+// TraceKV logs a message with key/value pairs at the trace log level.
+func (log Logger) TraceKV(msg string, keyvals ...interface{}) {
+	log.intLogkv(nil, TRACE, nil, keyvals, msg)
+}
+
+// InfoKV logs a message with key/value pairs at the info log level.
+func (log Logger) InfoKV(msg string, keyvals ...interface{}) {
+	log.intLogkv(nil, INFO, nil, keyvals, msg)
+}
+
+// WarnKV logs a message with key/value pairs at the warning log level,
+// and returns the message as error.
+func (log Logger) WarnKV(msg string, keyvals ...interface{}) error {
+	log.intLogkv(nil, WARNING, nil, keyvals, msg)
+	return errors.New(msg)
+}
+
+// ErrorKV logs a message with key/value pairs at the error log level,
+// and returns the message as error.
+func (log Logger) ErrorKV(msg string, keyvals ...interface{}) error {
+	log.intLogkv(nil, ERROR, nil, keyvals, msg)
+	return errors.New(msg)
+}
+
+// CriticalKV logs a message with key/value pairs at the critical log level,
+// and returns the message as error.
+func (log Logger) CriticalKV(msg string, keyvals ...interface{}) error {
+	log.intLogkv(nil, CRITICAL, nil, keyvals, msg)
+	return errors.New(msg)
+}
+
+// Finest logs a message at the finest log level.
+// See Logger.Debug for an explanation of the arguments.
+func (e *Entry) Finest(arg0 interface{}, args ...interface{}) {
+	e.logger.intLogkv(nil, FINEST, e, nil, arg0, args...)
+}
+
+// Fine logs a message at the fine log level.
+// See Logger.Debug for an explanation of the arguments.
+func (e *Entry) Fine(arg0 interface{}, args ...interface{}) {
+	e.logger.intLogkv(nil, FINE, e, nil, arg0, args...)
+}
+
+// Debug logs a message at the debug log level.
+// See Logger.Debug for an explanation of the arguments.
+func (e *Entry) Debug(arg0 interface{}, args ...interface{}) {
+	e.logger.intLogkv(nil, DEBUG, e, nil, arg0, args...)
+}
+
+// Trace logs a message at the trace log level.
+// See Logger.Debug for an explanation of the arguments.
+func (e *Entry) Trace(arg0 interface{}, args ...interface{}) {
+	e.logger.intLogkv(nil, TRACE, e, nil, arg0, args...)
+}
+
+// Info logs a message at the info log level.
+// See Logger.Debug for an explanation of the arguments.
+func (e *Entry) Info(arg0 interface{}, args ...interface{}) {
+	e.logger.intLogkv(nil, INFO, e, nil, arg0, args...)
+}
+
+// Warn logs a message at the warning log level and returns the formatted error.
+// See Logger.Warn for an explanation of the arguments.
+func (e *Entry) Warn(arg0 interface{}, args ...interface{}) error {
+	f := newFormatted(arg0, args...)
+	e.logger.intLogkv(nil, WARNING, e, nil, f)
+	return errors.New(f.msg)
+}
+
+// Error logs a message at the error log level and returns the formatted error.
+// See Logger.Warn for an explanation of the arguments.
+func (e *Entry) Error(arg0 interface{}, args ...interface{}) error {
+	f := newFormatted(arg0, args...)
+	e.logger.intLogkv(nil, ERROR, e, nil, f)
+	return errors.New(f.msg)
+}
+
+// Critical logs a message at the critical log level and returns the formatted error.
+// See Logger.Warn for an explanation of the arguments.
+func (e *Entry) Critical(arg0 interface{}, args ...interface{}) error {
+	f := newFormatted(arg0, args...)
+	e.logger.intLogkv(nil, CRITICAL, e, nil, f)
+	return errors.New(f.msg)
+}
+
+// FinestKV logs a message with key/value pairs at the finest log level.
+func (e *Entry) FinestKV(msg string, keyvals ...interface{}) {
+	e.logger.intLogkv(nil, FINEST, e, keyvals, msg)
+}
+
+// FineKV logs a message with key/value pairs at the fine log level.
+func (e *Entry) FineKV(msg string, keyvals ...interface{}) {
+	e.logger.intLogkv(nil, FINE, e, keyvals, msg)
+}
+
+// DebugKV logs a message with key/value pairs at the debug log level.
+func (e *Entry) DebugKV(msg string, keyvals ...interface{}) {
+	e.logger.intLogkv(nil, DEBUG, e, keyvals, msg)
+}
+
+// TraceKV logs a message with key/value pairs at the trace log level.
+func (e *Entry) TraceKV(msg string, keyvals ...interface{}) {
+	e.logger.intLogkv(nil, TRACE, e, keyvals, msg)
+}
+
+// InfoKV logs a message with key/value pairs at the info log level.
+func (e *Entry) InfoKV(msg string, keyvals ...interface{}) {
+	e.logger.intLogkv(nil, INFO, e, keyvals, msg)
+}
+
+// WarnKV logs a message with key/value pairs at the warning log level,
+// and returns the message as error.
+func (e *Entry) WarnKV(msg string, keyvals ...interface{}) error {
+	e.logger.intLogkv(nil, WARNING, e, keyvals, msg)
+	return errors.New(msg)
+}
+
+// ErrorKV logs a message with key/value pairs at the error log level,
+// and returns the message as error.
+func (e *Entry) ErrorKV(msg string, keyvals ...interface{}) error {
+	e.logger.intLogkv(nil, ERROR, e, keyvals, msg)
+	return errors.New(msg)
+}
+
+// CriticalKV logs a message with key/value pairs at the critical log level,
+// and returns the message as error.
+func (e *Entry) CriticalKV(msg string, keyvals ...interface{}) error {
+	e.logger.intLogkv(nil, CRITICAL, e, keyvals, msg)
+	return errors.New(msg)
+}
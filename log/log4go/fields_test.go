@@ -0,0 +1,118 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log4go
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// test Fields()
+func TestFields(t *testing.T) {
+	fields := Fields("request_id", "abc", 10, 1.5, Field{"f", true}, "odd")
+	if len(fields) != 4 {
+		t.Fatalf("Fields() return %d fields, want 4", len(fields))
+	}
+
+	if fields[0].Key != "request_id" || fields[0].Value != "abc" {
+		t.Errorf("err in fields[0]: %v", fields[0])
+	}
+	if fields[1].Key != "10" || fields[1].Value != 1.5 {
+		t.Errorf("err in fields[1]: %v", fields[1])
+	}
+	if fields[2].Key != "f" || fields[2].Value != true {
+		t.Errorf("err in fields[2]: %v", fields[2])
+	}
+	if fields[3].Key != "odd" || fields[3].Value != "(MISSING)" {
+		t.Errorf("err in fields[3]: %v", fields[3])
+	}
+}
+
+// test format of fields
+func TestFormatLogRecordFields(t *testing.T) {
+	rec := &LogRecord{
+		Level:   INFO,
+		Source:  "source",
+		Message: "message",
+		Created: now,
+		Fields:  Fields("id", "a b", "n", 3, "err", errors.New("failed"), "empty", "", "a=b c", 1),
+	}
+
+	tests := map[string]string{
+		"[%L] %M":        "[INFO] message id=\"a b\" n=3 err=failed empty=\"\" \"a=b c\"=1\n",
+		"[%L] %M |%F":    "[INFO] message | id=\"a b\" n=3 err=failed empty=\"\" \"a=b c\"=1\n",
+		"[%L] (%S) %M%%": "[INFO] (source) message id=\"a b\" n=3 err=failed empty=\"\" \"a=b c\"=1\n",
+	}
+	for format, want := range tests {
+		if got := FormatLogRecord(format, rec); got != want {
+			t.Errorf("%s:", format)
+			t.Errorf("   got %q", got)
+			t.Errorf("  want %q", want)
+		}
+	}
+}
+
+// test Logger.With() and KV functions
+func TestEntry(t *testing.T) {
+	defer func(buflen int) {
+		LogBufferLength = buflen
+	}(LogBufferLength)
+	LogBufferLength = 0
+
+	l := make(Logger)
+	l.AddFilter("file", DEBUG, NewFileLogWriter(testLogFile, false).SetFormat("[%L] %M"))
+	defer os.Remove(testLogFile)
+
+	l.InfoKV("request done", "status", 200)
+	reqLog := l.With("request_id", "r1")
+	reqLog.Info("start %s", "/index")
+	reqLog.With("backend", "10.0.0.1").WarnKV("slow", "latency_ms", 120)
+	reqLog.Fine("not logged")
+	if err := reqLog.Error("code %d", 500); err.Error() != "code 500" {
+		t.Errorf("Entry.Error returned invalid error: %s", err)
+	}
+	// []byte is formatted as text except by Info, as Logger does
+	reqLog.Debug([]byte("ab"))
+	if err := reqLog.Warn([]byte("ab")); err.Error() != "[97 98]" {
+		t.Errorf("Entry.Warn returned invalid error: %s", err)
+	}
+	l.Close()
+
+	want := "[INFO] request done status=200\n" +
+		"[INFO] start /index request_id=r1\n" +
+		"[WARN] slow request_id=r1 backend=10.0.0.1 latency_ms=120\n" +
+		"[EROR] code 500 request_id=r1\n" +
+		"[DEBG] [97 98] request_id=r1\n" +
+		"[WARN] [97 98] request_id=r1\n"
+	contents, err := ioutil.ReadFile(testLogFile)
+	if err != nil {
+		t.Fatalf("Could not read output log: %s", err)
+	}
+	if string(contents) != want {
+		t.Errorf("got %q, want %q", string(contents), want)
+	}
+
+	// binary record is logged by Info
+	var recs []*LogRecord
+	l = Logger{"test": &Filter{DEBUG, testWriter(func(rec *LogRecord) {
+		recs = append(recs, rec)
+	})}}
+	l.With("request_id", "r1").Info([]byte("ab"))
+	if len(recs) != 1 || string(recs[0].Binary) != "ab" {
+		t.Errorf("got records %v, want binary record", recs)
+	}
+}
@@ -17,8 +17,11 @@
 package log4go
 
 import (
+	"bytes"
+	"context"
 	"os"
 	"fmt"
+	"sync/atomic"
 	"time"
 )
 
@@ -26,8 +29,8 @@ import (
 type FileLogWriter struct {
 	LogCloser   //for Elegant exit
 
-	rec chan *LogRecord
-	rot chan bool
+	ring   *recordRing
+	rotReq int32 // 1 if Rotate() is requested
 
 	// The opened file
 	filename string
@@ -57,18 +60,42 @@ type FileLogWriter struct {
 
 // This is the FileLogWriter's output method
 func (w *FileLogWriter) LogWrite(rec *LogRecord) {
-    if !LogWithBlocking {
-        if len(w.rec) >= LogBufferLength {
-            return
-        }
-    }
-    
-	w.rec <- rec
+	w.ring.logWrite(rec)
+}
+
+// FileLogWriter consumes records from ring
+func (w *FileLogWriter) consumeRing() {}
+
+// Name gets writer name
+func (w *FileLogWriter) Name() string {
+	return w.filename
+}
+
+// QueueLen gets number of records in ring
+func (w *FileLogWriter) QueueLen() int {
+	return w.ring.Len()
+}
+
+// Stat gets counters of writer
+func (w *FileLogWriter) Stat() WriterStat {
+	return w.ring.stat()
+}
+
+// Flush writes records buffered before, and syncs the file
+func (w *FileLogWriter) Flush(ctx context.Context) (int, error) {
+	return w.ring.waitForFlush(ctx)
+}
+
+func (w *FileLogWriter) sync() (int, error) {
+	if w.file == nil {
+		return 0, nil
+	}
+	return 0, w.file.Sync()
 }
 
 func (w *FileLogWriter) Close() {
-	w.WaitForEnd(w.rec)
-	close(w.rec)
+	w.ring.waitForEnd(&w.LogCloser)
+	unregisterWriter(w)
 }
 
 // NewFileLogWriter creates a new LogWriter which writes to the given file and
@@ -82,13 +109,13 @@ func (w *FileLogWriter) Close() {
 //   [%D %T] [%L] (%S) %M
 func NewFileLogWriter(fname string, rotate bool) *FileLogWriter {
 	w := &FileLogWriter{
-		rec:      make(chan *LogRecord, LogBufferLength),
-		rot:      make(chan bool),
 		filename: fname,
 		format:   "[%D %T] [%L] (%S) %M",
 		rotate:   rotate,
 	}
 
+	w.ring = newRecordRing(LogBufferLength, fname, w.formatRecord)
+
     //init LogCloser
     w.LogCloserInit()
 
@@ -98,60 +125,97 @@ func NewFileLogWriter(fname string, rotate bool) *FileLogWriter {
 		return nil
 	}
 
-	go func() {
-		defer func() {
-			if w.file != nil {
-				fmt.Fprint(w.file, FormatLogRecord(w.trailer, &LogRecord{Created: time.Now()}))
-				w.file.Close()
+	// add w to collection of all writers' info
+	registerWriter(w)
+
+	go w.run()
+
+	return w
+}
+
+// run takes records from ring in batch, and writes them to file. Records in
+// a batch are written by one system call.
+func (w *FileLogWriter) run() {
+	defer func() {
+		if w.file != nil {
+			fmt.Fprint(w.file, FormatLogRecord(w.trailer, &LogRecord{Created: time.Now()}))
+			w.file.Close()
+		}
+	}()
+
+	var buf batchBuffer
+	batch := make([]*LogRecord, 0, LOG_BATCH_SIZE)
+
+	for {
+		batch = w.ring.getBatch(batch)
+
+		if atomic.CompareAndSwapInt32(&w.rotReq, 1, 0) {
+			if err := w.intRotate(); err != nil {
+				fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+				return
+			}
+		}
+
+		for _, rec := range batch {
+			if rec == nil {
+				w.writeBuf(&buf)
+				w.EndNotify(rec)
+				return
+			}
+			if rec.flushAck != nil {
+				w.writeBuf(&buf)
+				w.FlushNotify(rec, w.sync)
+				continue
 			}
-		}()
 
-		for {
-			select {
-			case <-w.rot:
+			now := time.Now()
+			if (w.maxlines > 0 && w.maxlines_curlines >= w.maxlines) ||
+				(w.maxsize > 0 && w.maxsize_cursize >= w.maxsize) ||
+				(w.daily && now.Day() != w.daily_opendate) {
+				w.writeBuf(&buf)
 				if err := w.intRotate(); err != nil {
 					fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
 					return
 				}
-			case rec, ok := <-w.rec:
-				if !ok {
-					return
-				}
-                
-                if w.EndNotify(rec) {
-                    return
-                }
-
-				now := time.Now()
-				if (w.maxlines > 0 && w.maxlines_curlines >= w.maxlines) ||
-					(w.maxsize > 0 && w.maxsize_cursize >= w.maxsize) ||
-					(w.daily && now.Day() != w.daily_opendate) {
-					if err := w.intRotate(); err != nil {
-						fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
-						return
-					}
-				}
+			}
 
-				// Perform the write
-				n, err := fmt.Fprint(w.file, FormatLogRecord(w.format, rec))
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
-					return
-				}
+			// Format the record into buffer
+			n := buf.Len()
+			w.ring.formatRecord(&buf, rec)
+			rec.release()
 
-				// Update the counts
-				w.maxlines_curlines++
-				w.maxsize_cursize += n
-			}
+			// Update the counts
+			w.maxlines_curlines++
+			w.maxsize_cursize += buf.Len() - n
 		}
-	}()
 
-	return w
+		w.writeBuf(&buf)
+	}
+}
+
+// writeBuf writes formatted records in buf to file
+func (w *FileLogWriter) writeBuf(buf *batchBuffer) {
+	if buf.Len() == 0 {
+		return
+	}
+	if _, err := w.file.Write(buf.Bytes()); err != nil {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+		w.ring.countDropped(buf.records)
+	} else {
+		w.ring.countWritten(buf.records, buf.Len())
+	}
+	buf.Reset()
+}
+
+// formatRecord formats rec into out
+func (w *FileLogWriter) formatRecord(out *bytes.Buffer, rec *LogRecord) {
+	writeLogRecord(out, w.format, rec)
 }
 
 // Request that the logs rotate
 func (w *FileLogWriter) Rotate() {
-	w.rot <- true
+	atomic.StoreInt32(&w.rotReq, 1)
+	w.ring.interrupt()
 }
 
 // If this is called in a threaded context, it MUST be synchronized
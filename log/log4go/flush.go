@@ -0,0 +1,323 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// flush implements deadline-bounded flush and close of Logger
+/*
+Usage:
+    // write all buffered records, wait for 1 second at most
+    ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+    defer cancel()
+    if err := logger.Flush(ctx); err != nil {
+        fmt.Fprintln(os.Stderr, err)
+    }
+
+    // flush and close all writers before exit
+    logger.CloseWithTimeout(time.Second)
+
+    // flush and close all writers of a logger which may still be in use by
+    // other goroutines (e.g., replaced by a new logger)
+    oldLogger.Shutdown(30 * time.Second)
+
+Flush sends a flush marker through the rec channel of each writer, and waits
+for the writer to reach it. Records before the marker are written, and the
+file is synced to storage. Writers which could not reach the marker before
+the deadline are reported in FlushError.
+
+Writers which do not implement Flusher are skipped by Flush.
+
+Shutdown disables filters of the logger, waits for records being dispatched
+to them (within the timeout, as writers may block), and then flushes and
+closes the writers. Filters are not removed, so
+goroutines still holding the logger could iterate it safely, and records
+logged by them afterwards are dropped.
+*/
+package log4go
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// timeout of flushing log before exit, see Exit() and Crash()
+const EXIT_FLUSH_TIMEOUT = 3 * time.Second
+
+// level of filters disabled by Shutdown, above all levels
+const levelClosed = CRITICAL + 1
+
+// interval of checking records being dispatched, see waitDispatched
+const DISPATCH_WAIT_INTERVAL = time.Millisecond
+
+// number of records being dispatched to filters, *Filter => *int64. Shutdown
+// waits for them after disabling filters. They are kept aside, so that Filter
+// could still be created by unkeyed literal.
+var inflights sync.Map
+
+// inflight gets number of records being dispatched to the filter
+func (filt *Filter) inflight() *int64 {
+	if n, ok := inflights.Load(filt); ok {
+		return n.(*int64)
+	}
+	n, _ := inflights.LoadOrStore(filt, new(int64))
+	return n.(*int64)
+}
+
+// waitDispatched waits until no record is being dispatched to the filter, or
+// ctx is done
+func (filt *Filter) waitDispatched(ctx context.Context) error {
+	n, ok := inflights.Load(filt)
+	if !ok {
+		return nil
+	}
+	for atomic.LoadInt64(n.(*int64)) > 0 {
+		select {
+		case <-time.After(DISPATCH_WAIT_INTERVAL):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Flusher is implemented by writers which could flush buffered records
+type Flusher interface {
+	// Flush writes all records buffered before, and syncs them to storage.
+	// It returns number of records which are not written when ctx is done.
+	Flush(ctx context.Context) (int, error)
+}
+
+// flushResult is sent back by the writer when flush marker is reached
+type flushResult struct {
+	unwritten int
+	err       error
+}
+
+// FlushNotify checks whether rec is a flush marker. If so, sync is invoked
+// (if not nil), and the waiting Flush is notified.
+//
+// sync returns number of records still buffered in writer, and error.
+func (lc *LogCloser) FlushNotify(rec *LogRecord, sync func() (int, error)) bool {
+	return flushNotify(rec, sync)
+}
+
+// WaitForFlush adds flush marker to rec, and waits until FlushNotify is
+// called for it or ctx is done
+func (lc *LogCloser) WaitForFlush(ctx context.Context, rec chan *LogRecord) (int, error) {
+	return waitForFlush(ctx, rec)
+}
+
+func flushNotify(rec *LogRecord, sync func() (int, error)) bool {
+	if rec == nil || rec.flushAck == nil {
+		return false
+	}
+
+	var res flushResult
+	if sync != nil {
+		res.unwritten, res.err = sync()
+	}
+	rec.flushAck <- res
+	return true
+}
+
+func waitForFlush(ctx context.Context, rec chan *LogRecord) (int, error) {
+	ack := make(chan flushResult, 1)
+	select {
+	case rec <- &LogRecord{flushAck: ack}:
+	case <-ctx.Done():
+		return len(rec), ctx.Err()
+	}
+
+	select {
+	case res := <-ack:
+		return res.unwritten, res.err
+	case <-ctx.Done():
+		// the marker is not counted
+		unwritten := len(rec) - 1
+		if unwritten < 0 {
+			unwritten = 0
+		}
+		return unwritten, ctx.Err()
+	}
+}
+
+// FlushError reports filters which are not flushed or closed completely
+type FlushError struct {
+	Unwritten map[string]int   // filter name => number of records not written
+	Errors    map[string]error // filter name => error
+}
+
+func (e *FlushError) add(name string, unwritten int, err error) {
+	if unwritten > 0 {
+		e.Unwritten[name] += unwritten
+	}
+	if err != nil {
+		e.Errors[name] = err
+	}
+}
+
+func (e *FlushError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	for name := range e.Unwritten {
+		if _, ok := e.Errors[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	msgs := make([]string, 0, len(names))
+	for _, name := range names {
+		msg := fmt.Sprintf("%s: %d records unwritten", name, e.Unwritten[name])
+		if err := e.Errors[name]; err != nil {
+			msg += ": " + err.Error()
+		}
+		msgs = append(msgs, msg)
+	}
+	return "log4go: " + strings.Join(msgs, "; ")
+}
+
+// Flush writes records buffered in all writers, and waits until they are
+// written or ctx is done. Writers are flushed concurrently.
+//
+// If any record is not written, *FlushError is returned.
+func (log Logger) Flush(ctx context.Context) error {
+	return log.flush(ctx, false)
+}
+
+// flush flushes writers of the logger. Writers of filters disabled by
+// Shutdown are skipped, unless closing is true.
+func (log Logger) flush(ctx context.Context, closing bool) error {
+	ferr := &FlushError{
+		Unwritten: make(map[string]int),
+		Errors:    make(map[string]error),
+	}
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for name, filt := range log {
+		if !closing && filt.level() == levelClosed {
+			continue
+		}
+		flusher, ok := filt.LogWriter.(Flusher)
+		if !ok {
+			continue
+		}
+
+		wg.Add(1)
+		go func(name string, flusher Flusher) {
+			defer wg.Done()
+			unwritten, err := flusher.Flush(ctx)
+
+			lock.Lock()
+			ferr.add(name, unwritten, err)
+			lock.Unlock()
+		}(name, flusher)
+	}
+	wg.Wait()
+
+	if len(ferr.Unwritten) == 0 && len(ferr.Errors) == 0 {
+		return nil
+	}
+	return ferr
+}
+
+// CloseWithTimeout flushes and closes all writers, and removes all filters
+// from the logger, within the given time. Writers which could not be closed
+// in time are left behind, and reported in the returned *FlushError.
+func (log Logger) CloseWithTimeout(timeout time.Duration) error {
+	err := log.Shutdown(timeout)
+	for name := range log {
+		delete(log, name)
+	}
+	return err
+}
+
+// Shutdown flushes and closes all writers within the given time, like
+// CloseWithTimeout, but filters are kept in the logger. It is safe to call
+// while other goroutines are logging with the logger: filters are disabled
+// first, and writers are closed after records being dispatched to them are
+// written. Records logged afterwards are dropped.
+//
+// Filters shared with other loggers should be removed from the logger
+// before Shutdown, since they are disabled. Filters already shut down (e.g.,
+// by Shutdown of another logger sharing them) are skipped.
+func (log Logger) Shutdown(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	active := make(Logger, len(log))
+	for name, filt := range log {
+		if filt.swapLevel(levelClosed) != levelClosed {
+			active[name] = filt
+		}
+	}
+	log = active
+	// wait for records being dispatched to the filters
+	dispatchErrs := make(map[string]error)
+	for name, filt := range log {
+		if err := filt.waitDispatched(ctx); err != nil {
+			dispatchErrs[name] = fmt.Errorf("dispatch: %s", err)
+		}
+	}
+
+	ferr, _ := log.flush(ctx, true).(*FlushError)
+	if ferr == nil {
+		ferr = &FlushError{
+			Unwritten: make(map[string]int),
+			Errors:    make(map[string]error),
+		}
+	}
+	for name, err := range dispatchErrs {
+		if _, ok := ferr.Errors[name]; !ok {
+			ferr.add(name, 0, err)
+		}
+	}
+
+	for name, filt := range log {
+		done := make(chan bool)
+		go func(filt *Filter) {
+			filt.Close()
+			close(done)
+		}(filt)
+		filt.setRedactor(nil)
+		inflights.Delete(filt)
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			if _, ok := ferr.Errors[name]; !ok {
+				ferr.add(name, 0, fmt.Errorf("close: %s", ctx.Err()))
+			}
+		}
+	}
+
+	if len(ferr.Unwritten) == 0 && len(ferr.Errors) == 0 {
+		return nil
+	}
+	return ferr
+}
+
+// closeBeforeExit flushes and closes Global, errors are written to stderr
+func closeBeforeExit() {
+	if err := Global.CloseWithTimeout(EXIT_FLUSH_TIMEOUT); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
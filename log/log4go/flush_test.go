@@ -0,0 +1,150 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log4go
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlush(t *testing.T) {
+	l := make(Logger)
+	l.AddFilter("file", INFO, NewFileLogWriter(testLogFile, false).SetFormat("%M"))
+	defer os.Remove(testLogFile)
+	defer l.Close()
+
+	for i := 0; i < 100; i++ {
+		l.Info("message")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := l.Flush(ctx); err != nil {
+		t.Fatalf("Flush(): %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(testLogFile)
+	if err != nil {
+		t.Fatalf("Could not read output log: %s", err)
+	}
+	if n := strings.Count(string(contents), "message\n"); n != 100 {
+		t.Errorf("%d records are written after Flush(), want 100", n)
+	}
+}
+
+func TestCloseWithTimeout(t *testing.T) {
+	// writing to pipe blocks until read
+	pr, pw := io.Pipe()
+	defer pr.Close()
+
+	l := make(Logger)
+	l.AddFilter("pipe", INFO, NewFormatLogWriter(pw, "%M"))
+	for i := 0; i < 3; i++ {
+		l.Info("message")
+	}
+
+	err := l.CloseWithTimeout(50 * time.Millisecond)
+	ferr, ok := err.(*FlushError)
+	if !ok {
+		t.Fatalf("CloseWithTimeout() returned %v, want *FlushError", err)
+	}
+	// the first record is blocked in writing
+	if ferr.Unwritten["pipe"] != 2 || ferr.Errors["pipe"] != context.DeadlineExceeded {
+		t.Errorf("unexpected error: %s", ferr)
+	}
+	if len(l) != 0 {
+		t.Errorf("filters should be removed after CloseWithTimeout()")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shutdown")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fname := filepath.Join(dir, "shutdown.log")
+	l := make(Logger)
+	l.AddFilter("file", INFO, NewTimeFileLogWriter(fname, "D", 0, false).SetFormat("%M"))
+
+	// logging while shutting down, see go test -race
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 1000; i++ {
+			l.Info("message")
+		}
+		close(done)
+	}()
+	if err := l.Shutdown(time.Second); err != nil {
+		t.Errorf("Shutdown(): %s", err)
+	}
+	<-done
+
+	// filters are kept, and records are dropped
+	if _, ok := l["file"]; !ok || len(l.Levels()) != 0 {
+		t.Errorf("filters should be kept and disabled after Shutdown()")
+	}
+	l.Info("dropped")
+	if err := l.Flush(context.Background()); err != nil {
+		t.Errorf("Flush(): %s", err)
+	}
+	data, err := ioutil.ReadFile(fname)
+	if n := strings.Count(string(data), "message\n"); err != nil || len(data) != n*len("message\n") {
+		t.Errorf("got %q, error %v", data, err)
+	}
+}
+
+// test Shutdown is bounded by timeout if writer blocks, and other loggers
+// are not blocked
+func TestShutdownBlocked(t *testing.T) {
+	unblock := make(chan bool)
+	defer close(unblock)
+	blocked := make(chan bool)
+
+	l := make(Logger)
+	l.AddFilter("blocked", INFO, testWriter(func(*LogRecord) {
+		close(blocked)
+		<-unblock
+	}))
+	go l.Info("blocked")
+	<-blocked
+
+	start := time.Now()
+	err := l.Shutdown(50 * time.Millisecond)
+	if ferr, ok := err.(*FlushError); !ok || ferr.Errors["blocked"] == nil {
+		t.Errorf("Shutdown() returned %v, want error of blocked", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Shutdown() takes %s, timeout is ignored", elapsed)
+	}
+
+	// logging with another logger while the first is blocked
+	var got []string
+	other := make(Logger)
+	other.AddFilter("test", INFO, testWriter(func(rec *LogRecord) {
+		got = append(got, rec.Message)
+	}))
+	other.Info("not blocked")
+	if len(got) != 1 {
+		t.Errorf("record of other logger should be written, got %q", got)
+	}
+}
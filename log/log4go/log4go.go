@@ -63,10 +63,12 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unsafe"
 
 	"github.com/baidu/go-lib/web-monitor/module_state2"
 )
@@ -98,6 +100,7 @@ const (
 // Logging LevelType strings
 var (
 	levelStrings = [...]string{"FNST", "FINE", "DEBG", "TRAC", "INFO", "WARN", "EROR", "CRIT"}
+	levelNames   = [...]string{"FINEST", "FINE", "DEBUG", "TRACE", "INFO", "WARNING", "ERROR", "CRITICAL"}
 )
 
 func (l LevelType) String() string {
@@ -107,6 +110,26 @@ func (l LevelType) String() string {
 	return levelStrings[int(l)]
 }
 
+// Name returns full name of level, e.g., "WARNING"
+func (l LevelType) Name() string {
+	if l < 0 || int(l) >= len(levelNames) {
+		return "UNKNOWN"
+	}
+	return levelNames[int(l)]
+}
+
+// ParseLevel converts level name (e.g., "WARNING") or level string
+// (e.g., "WARN") to LevelType. The name is case-insensitive.
+func ParseLevel(str string) (LevelType, error) {
+	str = strings.ToUpper(strings.TrimSpace(str))
+	for i := range levelNames {
+		if str == levelNames[i] || str == levelStrings[i] {
+			return LevelType(i), nil
+		}
+	}
+	return INFO, fmt.Errorf("unknown log level: %s", str)
+}
+
 /****** Variables ******/
 var (
 	// LogBufferLength specifies how many log messages a particular log4go
@@ -120,6 +143,10 @@ var (
 	LogProcessId = "0"
 	// whether record src for binary log
 	EnableSrcForBinLog = true
+	// whether time of record is formatted in UTC
+	LogTimeUTC = false
+	// whether record goroutine id, see %G of FormatLogRecord
+	LogGoroutineID = false
 	// whether record state
 	WithModuleState = false
 	log4goState     module_state2.State
@@ -132,8 +159,19 @@ type LogRecord struct {
 	Level   LevelType // The log LevelType
 	Created time.Time // The time at which the log message was created (nanoseconds)
 	Source  string    // The message source
+	Caller  *Caller   // location of the caller, nil if unknown
+
+	Goroutine uint64 // id of goroutine logging the record, 0 if not recorded
 	Message string    // The log message
 	Binary  []byte    // binary log message
+	Fields  []Field   // structured key/value fields
+	Name    string    // name of module, see Logger.Named()
+
+	RequestID string // request id (or trace id), see Logger.InfoCtx()
+
+	flushAck chan flushResult // not nil for flush marker, see Logger.Flush()
+	refs     int32            // references of record from pool, see release()
+	spilled  bool             // formatted record read from spill file
 }
 
 /****** LogCloser ******/
@@ -186,7 +224,41 @@ type WriterInfo interface {
 // collect info about all writers
 type WriterInfoArray []WriterInfo
 
-var writersInfo WriterInfoArray = make(WriterInfoArray, 0)
+var (
+	writersInfo     WriterInfoArray = make(WriterInfoArray, 0)
+	writersInfoLock sync.Mutex
+)
+
+// registerWriter adds w to collection of all writers' info, after it is
+// created successfully
+func registerWriter(w WriterInfo) {
+	writersInfoLock.Lock()
+	writersInfo = append(writersInfo, w)
+	writersInfoLock.Unlock()
+}
+
+// unregisterWriter removes w from collection of all writers' info, when it
+// is closed
+func unregisterWriter(w WriterInfo) {
+	writersInfoLock.Lock()
+	defer writersInfoLock.Unlock()
+	for i, info := range writersInfo {
+		if info == w {
+			// not modified in place, since it may be iterated by GetModuleState
+			infos := make(WriterInfoArray, 0, len(writersInfo)-1)
+			infos = append(infos, writersInfo[:i]...)
+			writersInfo = append(infos, writersInfo[i+1:]...)
+			return
+		}
+	}
+}
+
+// getWritersInfo gets info of all writers
+func getWritersInfo() WriterInfoArray {
+	writersInfoLock.Lock()
+	defer writersInfoLock.Unlock()
+	return writersInfo
+}
 
 /****** Logger ******/
 
@@ -197,6 +269,32 @@ type Filter struct {
 	LogWriter
 }
 
+// level loads Level of the filter atomically. Level may be changed by
+// SetLevel while logging, so it is only accessed by level and setLevel.
+func (filt *Filter) level() LevelType {
+	if unsafe.Sizeof(filt.Level) == 4 {
+		return LevelType(atomic.LoadInt32((*int32)(unsafe.Pointer(&filt.Level))))
+	}
+	return LevelType(atomic.LoadInt64((*int64)(unsafe.Pointer(&filt.Level))))
+}
+
+// setLevel stores Level of the filter atomically
+func (filt *Filter) setLevel(lvl LevelType) {
+	if unsafe.Sizeof(filt.Level) == 4 {
+		atomic.StoreInt32((*int32)(unsafe.Pointer(&filt.Level)), int32(lvl))
+		return
+	}
+	atomic.StoreInt64((*int64)(unsafe.Pointer(&filt.Level)), int64(lvl))
+}
+
+// swapLevel stores Level of the filter atomically, and returns the old one
+func (filt *Filter) swapLevel(lvl LevelType) LevelType {
+	if unsafe.Sizeof(filt.Level) == 4 {
+		return LevelType(atomic.SwapInt32((*int32)(unsafe.Pointer(&filt.Level)), int32(lvl)))
+	}
+	return LevelType(atomic.SwapInt64((*int64)(unsafe.Pointer(&filt.Level)), int64(lvl)))
+}
+
 // A Logger represents a collection of Filters through which log messages are
 // written.
 type Logger map[string]*Filter
@@ -216,7 +314,7 @@ func NewLogger() Logger {
 func NewConsoleLogger(lvl LevelType) Logger {
 	os.Stderr.WriteString("warning: use of deprecated NewConsoleLogger\n")
 	return Logger{
-		"stdout": &Filter{lvl, NewConsoleLogWriter()},
+		"stdout": &Filter{Level: lvl, LogWriter: NewConsoleLogWriter()},
 	}
 }
 
@@ -224,7 +322,7 @@ func NewConsoleLogger(lvl LevelType) Logger {
 // or above lvl to standard output.
 func NewDefaultLogger(lvl LevelType) Logger {
 	return Logger{
-		"stdout": &Filter{lvl, NewConsoleLogWriter()},
+		"stdout": &Filter{Level: lvl, LogWriter: NewConsoleLogWriter()},
 	}
 }
 
@@ -236,6 +334,7 @@ func (log Logger) Close() {
 	// Close all open loggers
 	for name, filt := range log {
 		filt.Close()
+		filt.setRedactor(nil)
 		delete(log, name)
 	}
 }
@@ -244,18 +343,45 @@ func (log Logger) Close() {
 // higher.  This function should not be called from multiple goroutines.
 // Returns the logger for chaining.
 func (log Logger) AddFilter(name string, lvl LevelType, writer LogWriter) Logger {
-	log[name] = &Filter{lvl, writer}
+	log[name] = &Filter{Level: lvl, LogWriter: writer}
 	return log
 }
 
+// SetLevel changes level of the filter with given name. It could be called
+// while logging, the new level applies to following log messages.
+func (log Logger) SetLevel(name string, lvl LevelType) error {
+	filt, ok := log[name]
+	if !ok {
+		return fmt.Errorf("filter not exist: %s", name)
+	}
+	if lvl < FINEST || lvl > CRITICAL {
+		return fmt.Errorf("invalid log level: %d", lvl)
+	}
+
+	filt.setLevel(lvl)
+	return nil
+}
+
+// Levels returns level of each filter, except filters disabled by Shutdown
+func (log Logger) Levels() map[string]LevelType {
+	levels := make(map[string]LevelType, len(log))
+	for name, filt := range log {
+		if level := filt.level(); level != levelClosed {
+			levels[name] = level
+		}
+	}
+	return levels
+}
+
 /******* Logging *******/
+
 // Send a formatted log message internally
 func (log Logger) intLogf(lvl LevelType, format string, args ...interface{}) {
 	skip := true
 
 	// Determine if any logging will be done
 	for _, filt := range log {
-		if lvl >= filt.Level {
+		if lvl >= filt.level() {
 			skip = false
 			break
 		}
@@ -265,10 +391,11 @@ func (log Logger) intLogf(lvl LevelType, format string, args ...interface{}) {
 	}
 
 	// Determine caller func
-	pc, _, lineno, ok := runtime.Caller(2)
-	src := ""
-	if ok {
-		src = fmt.Sprintf("%s:%d", runtime.FuncForPC(pc).Name(), lineno)
+	c := callerAt(2)
+
+	// Drop repeated records, see SetLogSampling
+	if !sampleAllow(log, lvl, format, c.Source()) {
+		return
 	}
 
 	msg := format
@@ -277,21 +404,55 @@ func (log Logger) intLogf(lvl LevelType, format string, args ...interface{}) {
 	}
 
 	// Make the log record
-	rec := &LogRecord{
-		Level:   lvl,
-		Created: time.Now(),
-		Source:  src,
-		Message: msg,
-		Binary:  nil,
-	}
+	rec := getRecord()
+	rec.Level = lvl
+	rec.Created = time.Now()
+	rec.Source = c.Source()
+	rec.Caller = c
+	rec.Message = msg
 
 	// Dispatch the logs
+	log.dispatch(rec, moduleFilter{})
+}
+
+// Send a message formatted by caller (e.g., Warn) internally, records are
+// sampled by format string arg0 (or by source if arg0 is not a string)
+func (log Logger) intLogm(lvl LevelType, arg0 interface{}, msg string) {
+	skip := true
+
+	// Determine if any logging will be done
 	for _, filt := range log {
-		if lvl < filt.Level {
-			continue
+		if lvl >= filt.level() {
+			skip = false
+			break
 		}
-		filt.LogWrite(rec)
 	}
+	if skip {
+		return
+	}
+
+	// Determine caller func
+	c := callerAt(2)
+
+	// Drop repeated records, see SetLogSampling
+	format, ok := arg0.(string)
+	if !ok {
+		format = c.Source()
+	}
+	if !sampleAllow(log, lvl, format, c.Source()) {
+		return
+	}
+
+	// Make the log record
+	rec := getRecord()
+	rec.Level = lvl
+	rec.Created = time.Now()
+	rec.Source = c.Source()
+	rec.Caller = c
+	rec.Message = msg
+
+	// Dispatch the logs
+	log.dispatch(rec, moduleFilter{})
 }
 
 // Send a binary log message internally
@@ -300,7 +461,7 @@ func (log Logger) intLogb(lvl LevelType, data []byte) {
 
 	// Determine if any logging will be done
 	for _, filt := range log {
-		if lvl >= filt.Level {
+		if lvl >= filt.level() {
 			skip = false
 			break
 		}
@@ -315,30 +476,21 @@ func (log Logger) intLogb(lvl LevelType, data []byte) {
 	}
 
 	// Determine caller func
-	src := ""
+	var c *Caller
 	if EnableSrcForBinLog {
-		pc, _, lineno, ok := runtime.Caller(2)
-		if ok {
-			src = fmt.Sprintf("%s:%d", runtime.FuncForPC(pc).Name(), lineno)
-		}
+		c = callerAt(2)
 	}
 
 	// Make the log record
-	rec := &LogRecord{
-		Level:   lvl,
-		Created: time.Now(),
-		Source:  src,
-		Message: "",
-		Binary:  data,
-	}
+	rec := getRecord()
+	rec.Level = lvl
+	rec.Created = time.Now()
+	rec.Source = c.Source()
+	rec.Caller = c
+	rec.Binary = data
 
 	// Dispatch the logs
-	for _, filt := range log {
-		if lvl < filt.Level {
-			continue
-		}
-		filt.LogWrite(rec)
-	}
+	log.dispatch(rec, moduleFilter{})
 }
 
 // Send a closure log message internally
@@ -347,7 +499,7 @@ func (log Logger) intLogc(lvl LevelType, closure func() string) {
 
 	// Determine if any logging will be done
 	for _, filt := range log {
-		if lvl >= filt.Level {
+		if lvl >= filt.level() {
 			skip = false
 			break
 		}
@@ -357,28 +509,18 @@ func (log Logger) intLogc(lvl LevelType, closure func() string) {
 	}
 
 	// Determine caller func
-	pc, _, lineno, ok := runtime.Caller(2)
-	src := ""
-	if ok {
-		src = fmt.Sprintf("%s:%d", runtime.FuncForPC(pc).Name(), lineno)
-	}
+	c := callerAt(2)
 
 	// Make the log record
-	rec := &LogRecord{
-		Level:   lvl,
-		Created: time.Now(),
-		Source:  src,
-		Message: closure(),
-		Binary:  nil,
-	}
+	rec := getRecord()
+	rec.Level = lvl
+	rec.Created = time.Now()
+	rec.Source = c.Source()
+	rec.Caller = c
+	rec.Message = closure()
 
 	// Dispatch the logs
-	for _, filt := range log {
-		if lvl < filt.Level {
-			continue
-		}
-		filt.LogWrite(rec)
-	}
+	log.dispatch(rec, moduleFilter{})
 }
 
 // Send a log message with manual level, source, and message.
@@ -387,7 +529,7 @@ func (log Logger) Log(lvl LevelType, source, message string) {
 
 	// Determine if any logging will be done
 	for _, filt := range log {
-		if lvl >= filt.Level {
+		if lvl >= filt.level() {
 			skip = false
 			break
 		}
@@ -397,21 +539,14 @@ func (log Logger) Log(lvl LevelType, source, message string) {
 	}
 
 	// Make the log record
-	rec := &LogRecord{
-		Level:   lvl,
-		Created: time.Now(),
-		Source:  source,
-		Message: message,
-		Binary:  nil,
-	}
+	rec := getRecord()
+	rec.Level = lvl
+	rec.Created = time.Now()
+	rec.Source = source
+	rec.Message = message
 
 	// Dispatch the logs
-	for _, filt := range log {
-		if lvl < filt.Level {
-			continue
-		}
-		filt.LogWrite(rec)
-	}
+	log.dispatch(rec, moduleFilter{})
 }
 
 // Logf logs a formatted log message at the given log level, using the caller as
@@ -555,7 +690,7 @@ func (log Logger) Warn(arg0 interface{}, args ...interface{}) error {
 		// Build a format string so that it will be similar to Sprint
 		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
 	}
-	log.intLogf(lvl, msg)
+	log.intLogm(lvl, arg0, msg)
 	return errors.New(msg)
 }
 
@@ -578,7 +713,7 @@ func (log Logger) Error(arg0 interface{}, args ...interface{}) error {
 		// Build a format string so that it will be similar to Sprint
 		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
 	}
-	log.intLogf(lvl, msg)
+	log.intLogm(lvl, arg0, msg)
 	return errors.New(msg)
 }
 
@@ -601,7 +736,7 @@ func (log Logger) Critical(arg0 interface{}, args ...interface{}) error {
 		// Build a format string so that it will be similar to Sprint
 		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
 	}
-	log.intLogf(lvl, msg)
+	log.intLogm(lvl, arg0, msg)
 	return errors.New(msg)
 }
 
@@ -612,18 +747,38 @@ func SetLogBufferLength(bufferLen int) {
 }
 
 // set LogWithBlocking (default is true)
+// If false, LogOverflowPolicy applies when buffer is full
 // This should be invoked before create logWriter
 func SetLogWithBlocking(isBlocking bool) {
 	LogWithBlocking = isBlocking
 }
 
 // set LogFormat(default is FORMAT_DEFAULT)
+// format is a pattern (see FormatLogRecord), or FORMAT_JSON for json lines
 // This should be invoked before create logWriter
 func SetLogFormat(format string) {
 	LogFormat = format
-	if strings.Contains(LogFormat, "%P") {
+	if formatHasVerb(LogFormat, 'P') {
 		setLogProcessId()
 	}
+	if formatHasVerb(LogFormat, 'G') {
+		SetLogGoroutineID(true)
+	}
+}
+
+// set LogTimeUTC (default is false)
+// If true, time of record is formatted in UTC, otherwise in local time zone
+// This should be invoked before create logWriter
+func SetLogTimeUTC(utc bool) {
+	LogTimeUTC = utc
+}
+
+// set LogGoroutineID (default is false)
+// It is set by SetLogFormat if the format has %G. It should be set if %G is
+// used by format of writers, since getting goroutine id is not free.
+// This should be invoked before create logWriter
+func SetLogGoroutineID(enable bool) {
+	LogGoroutineID = enable
 }
 
 // set LogProcessId(default is 0)
@@ -632,7 +787,9 @@ func setLogProcessId() {
 	LogProcessId = strconv.Itoa(os.Getpid())
 }
 
-// set Src line for binary log
+// set Src line for binary log. If enabled, caller of binary log is recorded
+// in Source and Caller as text log, and the skip of Entry (see
+// Logger.WithCallerSkip) also applies.
 func SetSrcLineForBinLog(enable bool) {
 	EnableSrcForBinLog = enable
 }
@@ -651,9 +808,17 @@ func GetModuleState() *module_state2.StateData {
 	table := module_state2.NewStateData()
 
 	if WithModuleState {
-		for _, w := range writersInfo {
+		for _, w := range getWritersInfo() {
 			queueInfo := fmt.Sprintf("%s_queue_length", w.Name())
 			log4goState.SetNum(queueInfo, int64(w.QueueLen()))
+
+			// counters of writer, see WriterStat
+			if sw, ok := w.(WriterStatInfo); ok {
+				stat := sw.Stat()
+				log4goState.SetNum(w.Name()+"_dropped", stat.Dropped)
+				log4goState.SetNum(w.Name()+"_written", stat.Written)
+				log4goState.SetNum(w.Name()+"_bytes", stat.Bytes)
+			}
 		}
 
 		return log4goState.GetAll()
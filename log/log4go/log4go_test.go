@@ -19,11 +19,15 @@ package log4go
 import (
 	"crypto/md5"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 )
@@ -76,6 +80,22 @@ var formatTests = []struct {
 			FORMAT_ABBREV:  "[EROR] message\n",
 		},
 	},
+	{
+		Test: "Time and width formats",
+		Record: &LogRecord{
+			Level:     INFO,
+			Source:    "source",
+			Message:   "message",
+			Created:   now,
+			Goroutine: 7,
+		},
+		Formats: map[string]string{
+			"[%m] [%-5L] %M":  "[23:31:30.123] [INFO ] message\n",
+			"[%u] [%5L] %M":   "[23:31:30.123456] [ INFO] message\n",
+			"%I %G %-3M|":     "2009-02-13T23:31:30.123Z 7 message|\n",
+			"[%-4N] [%2L] %-": "[    ] [INFO] \n",
+		},
+	},
 }
 
 func TestFormatLogRecord(t *testing.T) {
@@ -91,6 +111,81 @@ func TestFormatLogRecord(t *testing.T) {
 	}
 }
 
+func TestFormatLogRecordVerbs(t *testing.T) {
+	defer SetLogTimeUTC(LogTimeUTC)
+	defer SetLogGoroutineID(LogGoroutineID)
+
+	rec := newLogRecord(INFO, "source", "message", nil)
+	rec.Created = time.Date(2009, 2, 14, 7, 31, 30, 5e6, time.FixedZone("CST", 8*3600))
+	if got := FormatLogRecord("%I", rec); got != "2009-02-14T07:31:30.005+08:00\n" {
+		t.Errorf("local time: got %q", got)
+	}
+	SetLogTimeUTC(true)
+	if got := FormatLogRecord("%I %T", rec); got != "2009-02-13T23:31:30.005Z 23:31:30 UTC\n" {
+		t.Errorf("utc time: got %q", got)
+	}
+
+	hostname, _ := os.Hostname()
+	want := fmt.Sprintf("%s %s\n", hostname, filepath.Base(os.Args[0]))
+	if got := FormatLogRecord("%H %A", rec); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// goroutine id is recorded if format has %G
+	var recs []*LogRecord
+	l := make(Logger)
+	l.AddFilter("test", INFO, testWriter(func(rec *LogRecord) {
+		recs = append(recs, rec)
+	}))
+	SetLogGoroutineID(false)
+	l.Info("no id")
+	defer SetLogFormat(LogFormat)
+	SetLogFormat("[%-3G] %M")
+	l.Info("id")
+	if recs[0].Goroutine != 0 || recs[1].Goroutine == 0 {
+		t.Errorf("unexpected goroutine ids %d, %d", recs[0].Goroutine, recs[1].Goroutine)
+	}
+}
+
+func TestFormatLogRecordJSON(t *testing.T) {
+	rec := &LogRecord{
+		Level:   ERROR,
+		Source:  "source",
+		Message: "line1\n\"quoted\"",
+		Created: now,
+		Fields:  Fields("request_id", "abc", "latency", 1.5, "level", 3),
+	}
+
+	got := FormatLogRecord(FORMAT_JSON, rec)
+	if !strings.HasSuffix(got, "}\n") || strings.Count(got, "\n") != 1 {
+		t.Fatalf("malformed json line: %q", got)
+	}
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(got), &obj); err != nil {
+		t.Fatalf("json.Unmarshal(%q): %s", got, err)
+	}
+
+	want := map[string]interface{}{
+		"time":         "2009-02-13T23:31:30.123456Z",
+		"level":        "EROR",
+		"pid":          float64(os.Getpid()),
+		"source":       "source",
+		"message":      "line1\n\"quoted\"",
+		"request_id":   "abc",
+		"latency":      1.5,
+		"fields.level": float64(3),
+	}
+	if len(obj) != len(want) {
+		t.Errorf("got %d keys, want %d: %q", len(obj), len(want), got)
+	}
+	for key, value := range want {
+		if obj[key] != value {
+			t.Errorf("key %s: got %v, want %v", key, obj[key], value)
+		}
+	}
+}
+
 var logRecordWriteTests = []struct {
 	Test    string
 	Record  *LogRecord
@@ -109,10 +204,8 @@ var logRecordWriteTests = []struct {
 }
 
 func TestConsoleLogWriter(t *testing.T) {
-	console := make(ConsoleLogWriter)
-
 	r, w := io.Pipe()
-	go console.run(w)
+	console := newConsoleLogWriter(w)
 	defer console.Close()
 
 	buf := make([]byte, 1024)
@@ -263,6 +356,51 @@ func TestLogger(t *testing.T) {
 	//func (l *Logger) Info(format string, args ...interface{}) {}
 }
 
+func TestSetLevel(t *testing.T) {
+	for str, want := range map[string]LevelType{"debug": DEBUG, "WARNING": WARNING, "EROR": ERROR} {
+		if lvl, err := ParseLevel(str); err != nil || lvl != want {
+			t.Errorf("ParseLevel(%s) = %v, %v, want %v", str, lvl, err, want)
+		}
+	}
+	if _, err := ParseLevel("VERBOSE"); err == nil {
+		t.Errorf("ParseLevel(VERBOSE) should fail")
+	}
+
+	l := make(Logger)
+	l.AddFilter("stdout", INFO, NewConsoleLogWriter())
+	defer l.Close()
+
+	if err := l.SetLevel("stdout", DEBUG); err != nil {
+		t.Fatalf("SetLevel(stdout): %s", err)
+	}
+	if levels := l.Levels(); levels["stdout"] != DEBUG {
+		t.Errorf("level of stdout is %v, want DEBUG", levels["stdout"])
+	}
+	if err := l.SetLevel("file", DEBUG); err == nil {
+		t.Errorf("SetLevel(file) should fail for unknown filter")
+	}
+
+	// level is changed while logging, see go test -race
+	l = make(Logger)
+	l.AddFilter("count", INFO, testWriter(func(rec *LogRecord) {}))
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			l.Debug("debug %d", i)
+			l.Named("bfe").Debug("debug %d", i)
+		}
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		l.SetLevel("count", []LevelType{DEBUG, INFO}[i%2])
+	}
+	<-done
+	l.SetLevel("count", ERROR)
+	if l.Levels()["count"] != ERROR {
+		t.Errorf("level of count is %v, want ERROR", l.Levels()["count"])
+	}
+}
+
 func TestLogOutput(t *testing.T) {
 	const (
 		expected = "fdf3e51e444da56b4cb400f30bc47424"
@@ -307,7 +445,12 @@ func TestLogOutput(t *testing.T) {
 }
 
 func TestCountMallocs(t *testing.T) {
-	const N = 1
+	defer func(out io.Writer) {
+		stdout = out
+	}(stdout)
+	stdout = ioutil.Discard
+
+	const N = 1000
 	var m runtime.MemStats
 	getMallocs := func() uint64 {
 		runtime.ReadMemStats(&m)
@@ -405,6 +548,7 @@ func TestXMLConfig(t *testing.T) {
 	fmt.Fprintln(fd, "    <property name=\"endpoint\">192.168.1.255:12124</property> <!-- recommend UDP broadcast -->")
 	fmt.Fprintln(fd, "    <property name=\"protocol\">udp</property> <!-- tcp or udp -->")
 	fmt.Fprintln(fd, "  </filter>")
+	fmt.Fprintln(fd, "  <logger name=\"bfe.route\" level=\"DEBUG\"/> <!-- level of named module -->")
 	fmt.Fprintln(fd, "</logging>")
 	fd.Close()
 
@@ -413,6 +557,7 @@ func TestXMLConfig(t *testing.T) {
 	defer os.Remove("trace.xml")
 	defer os.Remove("test.log")
 	defer log.Close()
+	defer RemoveModuleLevel("bfe.route")
 
 	// Make sure we got all loggers
 	if len(log) != 3 {
@@ -451,6 +596,9 @@ func TestXMLConfig(t *testing.T) {
 	if lvl := log["xmllog"].Level; lvl != TRACE {
 		t.Errorf("XMLConfig: Expected xmllog to be set to level %d, found %d", TRACE, lvl)
 	}
+	if lvl, ok := GetModuleLevels()["bfe.route"]; !ok || lvl != DEBUG {
+		t.Errorf("XMLConfig: Expected module bfe.route to be set to level %d, found %d", DEBUG, lvl)
+	}
 
 	// Make sure the w is open and points to the right file
 	if fname := log["file"].LogWriter.(*FileLogWriter).file.Name(); fname != "test.log" {
@@ -571,6 +719,55 @@ func BenchmarkFileUtilNotLog(b *testing.B) {
 	os.Remove("benchlog.log")
 }
 
+// BenchmarkTimeFileLogParallel logs from all procs, and includes time of
+// writing all records to file
+func BenchmarkTimeFileLogParallel(b *testing.B) {
+	dir, err := ioutil.TempDir("", "bench")
+	if err != nil {
+		b.Fatalf("ioutil.TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sl := make(Logger)
+	sl.AddFilter("file", INFO, NewTimeFileLogWriter(dir+"/bench.log", "midnight", 0, false))
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			sl.Info("%s is a log message", "This")
+		}
+	})
+	sl.Close()
+}
+
+// BenchmarkPacketLogParallel logs to udp from all procs
+func BenchmarkPacketLogParallel(b *testing.B) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatalf("net.ListenPacket(): %s", err)
+	}
+	defer pc.Close()
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			if _, _, err := pc.ReadFrom(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	sl := make(Logger)
+	sl.AddFilter("packet", INFO, NewPacketWriter("bench", "udp", pc.LocalAddr().String(), FORMAT_DEFAULT))
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			sl.Info("%s is a log message", "This")
+		}
+	})
+	sl.Close()
+}
+
 // Benchmark results (darwin amd64 6g)
 //elog.BenchmarkConsoleLog           100000       22819 ns/op
 //elog.BenchmarkConsoleNotLogged    2000000         879 ns/op
@@ -580,3 +777,11 @@ func BenchmarkFileUtilNotLog(b *testing.B) {
 //elog.BenchmarkFileNotLogged       2000000         821 ns/op
 //elog.BenchmarkFileUtilLog           50000       33945 ns/op
 //elog.BenchmarkFileUtilNotLog      1000000        1258 ns/op
+
+// Benchmark results (linux amd64, 1 CPU), channel per writer => ring buffer
+// with batched writes and pooled records
+//BenchmarkConsoleLog           200000    767 ns/op  191 B/op   3 allocs/op  =>   389 ns/op    1 B/op  0 allocs/op
+//BenchmarkFileLog              200000   2435 ns/op  391 B/op   4 allocs/op  =>   686 ns/op    1 B/op  0 allocs/op
+//BenchmarkFileUtilLog          200000   4297 ns/op  815 B/op  10 allocs/op  =>  1977 ns/op  277 B/op  3 allocs/op
+//BenchmarkTimeFileLogParallel  200000   4412 ns/op  848 B/op  11 allocs/op  =>  1750 ns/op  278 B/op  3 allocs/op
+//BenchmarkPacketLogParallel    200000   6633 ns/op  980 B/op  11 allocs/op  =>  4594 ns/op  283 B/op  3 allocs/op
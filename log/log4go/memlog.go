@@ -0,0 +1,227 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// in-memory writer keeping the latest records, for tailing log remotely
+/*
+Usage:
+    // keep the latest 1000 records in memory
+    w := log4go.NewMemoryLogWriter(1000)
+    logger.AddFilter("tail", log4go.INFO, w)
+
+    // get the latest 100 records of WARNING or above
+    recs := w.Tail(100, &log4go.RecordFilter{Level: log4go.WARNING})
+
+    // follow new records, until cancel() is called
+    ch, cancel := w.Subscribe(log4go.MEMORY_SUBSCRIBE_BUFFER)
+    defer cancel()
+    for rec := range ch {
+        ...
+    }
+
+Records are not copied. Writing a record is never blocked by subscribers,
+records are dropped for slow subscribers (see MemoryLogWriter.Dropped).
+*/
+
+package log4go
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MEMORY_SUBSCRIBE_BUFFER = 1024 // default buffer size of subscriber
+)
+
+// RecordFilter selects records by level, source, message and time
+type RecordFilter struct {
+	Level   LevelType // min level of records
+	Source  string    // substring of source ("func:line"), e.g., "route.Lookup"
+	Message string    // substring of message
+	Since   time.Time // records created before Since are skipped, if not zero
+	Until   time.Time // records created after Until are skipped, if not zero
+}
+
+// Match checks whether rec is selected by filter. Nil filter selects all.
+func (f *RecordFilter) Match(rec *LogRecord) bool {
+	if f == nil {
+		return true
+	}
+	if rec.Level < f.Level {
+		return false
+	}
+	if f.Source != "" && !strings.Contains(rec.Source, f.Source) {
+		return false
+	}
+	if f.Message != "" && !strings.Contains(rec.Message, f.Message) {
+		return false
+	}
+	if !f.Since.IsZero() && rec.Created.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && rec.Created.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// MemoryLogWriter keeps the latest records in a circular buffer
+type MemoryLogWriter struct {
+	lock    sync.Mutex
+	records []*LogRecord // circular buffer of records
+	next    int          // position for the next record
+	full    bool         // whether the buffer is full
+
+	subs    map[chan *LogRecord]struct{} // subscribers of new records
+	dropped uint64                       // records dropped for slow subscribers
+}
+
+// NewMemoryLogWriter creates a writer keeping the latest size records
+//
+// PARAMS:
+//   - size: max number of records kept, should be > 0
+func NewMemoryLogWriter(size int) *MemoryLogWriter {
+	if size <= 0 {
+		size = 1
+	}
+	return &MemoryLogWriter{
+		records: make([]*LogRecord, size),
+		subs:    make(map[chan *LogRecord]struct{}),
+	}
+}
+
+// LogWrite keeps rec in buffer, and sends it to subscribers
+func (w *MemoryLogWriter) LogWrite(rec *LogRecord) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.records[w.next] = rec
+	w.next++
+	if w.next == len(w.records) {
+		w.next = 0
+		w.full = true
+	}
+
+	for ch := range w.subs {
+		select {
+		case ch <- rec:
+		default:
+			w.dropped++
+		}
+	}
+}
+
+// Close does nothing. Records are kept, and subscribers are not stopped,
+// so the writer could be shared by loggers (e.g., after log.Reload()).
+func (w *MemoryLogWriter) Close() {
+}
+
+// Size returns max number of records kept
+func (w *MemoryLogWriter) Size() int {
+	return len(w.records)
+}
+
+// Tail returns the latest n records selected by filter, in time order.
+// All selected records are returned if n <= 0.
+//
+// PARAMS:
+//   - n: max number of records returned
+//   - filter: filter of records, nil for all
+func (w *MemoryLogWriter) Tail(n int, filter *RecordFilter) []*LogRecord {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.tail(n, filter)
+}
+
+// tail returns the latest n records selected by filter, with lock held
+func (w *MemoryLogWriter) tail(n int, filter *RecordFilter) []*LogRecord {
+	count := w.next
+	if w.full {
+		count = len(w.records)
+	}
+	if n <= 0 || n > count {
+		n = count
+	}
+
+	// scan from the latest record
+	recs := make([]*LogRecord, 0, n)
+	for i := 1; i <= count && len(recs) < n; i++ {
+		rec := w.records[(w.next-i+len(w.records))%len(w.records)]
+		if filter.Match(rec) {
+			recs = append(recs, rec)
+		}
+	}
+
+	// reverse to time order
+	for i, j := 0, len(recs)-1; i < j; i, j = i+1, j-1 {
+		recs[i], recs[j] = recs[j], recs[i]
+	}
+	return recs
+}
+
+// Subscribe returns a channel receiving records written after the call.
+// Records are dropped if the channel is full. cancel() should be called
+// when records are no longer needed; the channel is closed by it.
+//
+// PARAMS:
+//   - bufSize: buffer size of channel, e.g., MEMORY_SUBSCRIBE_BUFFER
+func (w *MemoryLogWriter) Subscribe(bufSize int) (<-chan *LogRecord, func()) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.subscribe(bufSize)
+}
+
+// TailAndSubscribe returns the latest n records selected by filter (see
+// Tail), and subscribes records written after them (see Subscribe), so that
+// no record is missed or duplicated between them.
+func (w *MemoryLogWriter) TailAndSubscribe(n int, filter *RecordFilter,
+	bufSize int) ([]*LogRecord, <-chan *LogRecord, func()) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	recs := w.tail(n, filter)
+	ch, cancel := w.subscribe(bufSize)
+	return recs, ch, cancel
+}
+
+// subscribe adds a subscriber, with lock held
+func (w *MemoryLogWriter) subscribe(bufSize int) (<-chan *LogRecord, func()) {
+	if bufSize <= 0 {
+		bufSize = MEMORY_SUBSCRIBE_BUFFER
+	}
+	ch := make(chan *LogRecord, bufSize)
+	w.subs[ch] = struct{}{}
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			w.lock.Lock()
+			delete(w.subs, ch)
+			w.lock.Unlock()
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+// Dropped returns number of records dropped for slow subscribers
+func (w *MemoryLogWriter) Dropped() uint64 {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.dropped
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log4go
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// messages returns messages of records
+func messages(recs []*LogRecord) string {
+	var msgs []string
+	for _, rec := range recs {
+		msgs = append(msgs, rec.Message)
+	}
+	return fmt.Sprint(msgs)
+}
+
+func TestMemoryLogWriter(t *testing.T) {
+	w := NewMemoryLogWriter(4)
+	if recs := w.Tail(10, nil); len(recs) != 0 {
+		t.Errorf("got %d records, want 0", len(recs))
+	}
+
+	now := time.Now()
+	levels := []LevelType{INFO, WARNING, INFO, ERROR, INFO, DEBUG}
+	for i, lvl := range levels {
+		w.LogWrite(&LogRecord{
+			Level:   lvl,
+			Created: now.Add(time.Duration(i) * time.Second),
+			Source:  fmt.Sprintf("file%d.go:1", i),
+			Message: fmt.Sprintf("m%d", i),
+		})
+	}
+
+	tests := []struct {
+		n      int
+		filter *RecordFilter
+		want   string
+	}{
+		{0, nil, "[m2 m3 m4 m5]"},
+		{2, nil, "[m4 m5]"},
+		{10, &RecordFilter{Level: INFO}, "[m2 m3 m4]"},
+		{1, &RecordFilter{Level: INFO}, "[m4]"},
+		{0, &RecordFilter{Level: WARNING}, "[m3]"},
+		{0, &RecordFilter{Source: "file4"}, "[m4]"},
+		{0, &RecordFilter{Message: "m5"}, "[m5]"},
+		{0, &RecordFilter{Since: now.Add(3 * time.Second), Until: now.Add(4 * time.Second)}, "[m3 m4]"},
+	}
+	for i, test := range tests {
+		if got := messages(w.Tail(test.n, test.filter)); got != test.want {
+			t.Errorf("case %d: got %s, want %s", i, got, test.want)
+		}
+	}
+}
+
+func TestMemoryLogWriterSubscribe(t *testing.T) {
+	w := NewMemoryLogWriter(10)
+	l := make(Logger)
+	l.AddFilter("tail", INFO, w)
+
+	l.Info("before")
+	recs, ch, cancel := w.TailAndSubscribe(0, nil, 2)
+	if got := messages(recs); got != "[before]" {
+		t.Errorf("got %s, want [before]", got)
+	}
+
+	// records are dropped for slow subscriber
+	l.Info("a")
+	l.Info("b")
+	l.Info("c")
+	if rec := <-ch; rec.Message != "a" {
+		t.Errorf("got %s, want a", rec.Message)
+	}
+	if rec := <-ch; rec.Message != "b" {
+		t.Errorf("got %s, want b", rec.Message)
+	}
+	if w.Dropped() != 1 {
+		t.Errorf("got %d dropped, want 1", w.Dropped())
+	}
+
+	// channel is closed by cancel, and logger could be closed
+	cancel()
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Errorf("channel should be closed")
+	}
+	l.Info("d")
+	l.Close()
+	if got := messages(w.Tail(2, nil)); got != "[c d]" {
+		t.Errorf("got %s, want [c d]", got)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// named implements named loggers with per-module log levels
+/*
+Usage:
+    // create a named logger
+    routeLog := logger.Named("bfe.route")
+    routeLog.Debug("match rule %s", rule)
+
+    // turn module "bfe.route" (and "bfe.route.*") up to DEBUG
+    log4go.SetModuleLevel("bfe.route", log4go.DEBUG)
+
+Names are hierarchical, separated by ".". A module without its own level
+inherits level of the nearest parent, e.g., "bfe.route.host" inherits from
+"bfe.route", then from "bfe". Without any module level, filters of the
+logger decide as usual.
+
+The module level replaces level of "general" filters, i.e. filters with the
+lowest level in the logger. Filters with a higher level (e.g., the WARNING
+filter of "log_wf") keep their level as a floor, but are raised if the module
+level is higher.
+
+Module levels could also be set in XML configuration:
+    <logging>
+      <filter enabled="true">...</filter>
+      <logger name="bfe.route" level="DEBUG"/>
+    </logging>
+When configuration is loaded, module levels set before are replaced by those
+in the configuration (see SetModuleLevels).
+*/
+package log4go
+
+import (
+	"strings"
+	"sync"
+)
+
+var (
+	moduleLevels     = make(map[string]LevelType)
+	moduleLevelsLock sync.RWMutex
+)
+
+// SetModuleLevel sets level of the named module and its children
+func SetModuleLevel(name string, lvl LevelType) {
+	moduleLevelsLock.Lock()
+	moduleLevels[name] = lvl
+	moduleLevelsLock.Unlock()
+}
+
+// SetModuleLevels replaces all module levels by levels, nil to remove all
+func SetModuleLevels(levels map[string]LevelType) {
+	newLevels := make(map[string]LevelType, len(levels))
+	for name, lvl := range levels {
+		newLevels[name] = lvl
+	}
+
+	moduleLevelsLock.Lock()
+	moduleLevels = newLevels
+	moduleLevelsLock.Unlock()
+}
+
+// RemoveModuleLevel removes level of the named module, so that it inherits
+// level from its parent again
+func RemoveModuleLevel(name string) {
+	moduleLevelsLock.Lock()
+	delete(moduleLevels, name)
+	moduleLevelsLock.Unlock()
+}
+
+// GetModuleLevels returns all module levels
+func GetModuleLevels() map[string]LevelType {
+	moduleLevelsLock.RLock()
+	defer moduleLevelsLock.RUnlock()
+
+	levels := make(map[string]LevelType, len(moduleLevels))
+	for name, lvl := range moduleLevels {
+		levels[name] = lvl
+	}
+	return levels
+}
+
+// moduleLevel gets level of the named module, inherited from parents
+func moduleLevel(name string) (LevelType, bool) {
+	if len(name) == 0 {
+		return 0, false
+	}
+
+	moduleLevelsLock.RLock()
+	defer moduleLevelsLock.RUnlock()
+
+	if len(moduleLevels) == 0 {
+		return 0, false
+	}
+	for {
+		if lvl, ok := moduleLevels[name]; ok {
+			return lvl, true
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			return 0, false
+		}
+		name = name[:i]
+	}
+}
+
+// moduleFilter decides whether a record of named logger is written to a filter
+type moduleFilter struct {
+	enabled bool      // whether module level is set
+	level   LevelType // module level
+	base    LevelType // lowest level of filters
+}
+
+// newModuleFilter creates moduleFilter for the named logger
+func (log Logger) newModuleFilter(name string) moduleFilter {
+	lvl, ok := moduleLevel(name)
+	if !ok {
+		return moduleFilter{}
+	}
+
+	base := CRITICAL
+	for _, filt := range log {
+		if level := filt.level(); level < base {
+			base = level
+		}
+	}
+	return moduleFilter{enabled: true, level: lvl, base: base}
+}
+
+// accept checks whether record at lvl should be written to filt
+func (m moduleFilter) accept(lvl LevelType, filt *Filter) bool {
+	level := filt.level()
+	if !m.enabled {
+		return lvl >= level
+	}
+	if level > m.base && level > m.level {
+		return lvl >= level
+	}
+	return lvl >= m.level
+}
+
+// Named creates an entry with name of the module, e.g., "bfe.route"
+func (log Logger) Named(name string) *Entry {
+	return &Entry{
+		logger: log,
+		name:   name,
+	}
+}
+
+// Named creates a new entry for the child module, e.g., "bfe.route" for
+// "route" of entry named "bfe". Fields of e are kept.
+func (e *Entry) Named(name string) *Entry {
+	if len(e.name) > 0 {
+		name = e.name + "." + name
+	}
+	return &Entry{
+		logger: e.logger,
+		name:   name,
+		fields: e.fields,
+		skip:   e.skip,
+	}
+}
+
+// Name returns name of the entry
+func (e *Entry) Name() string {
+	return e.name
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log4go
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// test inheritance of module levels
+func TestModuleLevel(t *testing.T) {
+	SetModuleLevel("bfe", WARNING)
+	SetModuleLevel("bfe.route", DEBUG)
+	defer RemoveModuleLevel("bfe")
+	defer RemoveModuleLevel("bfe.route")
+
+	tests := []struct {
+		name  string
+		level LevelType
+		ok    bool
+	}{
+		{"bfe", WARNING, true},
+		{"bfe.route", DEBUG, true},
+		{"bfe.route.host", DEBUG, true},
+		{"bfe.balance", WARNING, true},
+		{"bfex", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		lvl, ok := moduleLevel(test.name)
+		if ok != test.ok || lvl != test.level {
+			t.Errorf("moduleLevel(%q) = %v, %v, want %v, %v", test.name, lvl, ok, test.level, test.ok)
+		}
+	}
+}
+
+// test records of named loggers are filtered by module levels
+func TestNamed(t *testing.T) {
+	defer func(buflen int) {
+		LogBufferLength = buflen
+	}(LogBufferLength)
+	LogBufferLength = 0
+
+	wfLogFile := testLogFile + ".wf"
+	l := make(Logger)
+	l.AddFilter("file", INFO, NewFileLogWriter(testLogFile, false).SetFormat("[%L] %N %M"))
+	l.AddFilter("file_wf", WARNING, NewFileLogWriter(wfLogFile, false).SetFormat("[%L] %N %M"))
+	defer os.Remove(testLogFile)
+	defer os.Remove(wfLogFile)
+
+	SetModuleLevel("bfe.route", DEBUG)
+	SetModuleLevel("bfe.balance", ERROR)
+	defer RemoveModuleLevel("bfe.route")
+	defer RemoveModuleLevel("bfe.balance")
+
+	route := l.Named("bfe").Named("route")
+	route.Debug("route debug")
+	route.Warn("route warn")
+	balance := l.Named("bfe.balance")
+	balance.Info("balance info")
+	balance.Warn("balance warn")
+	balance.Error("balance error")
+	l.Named("bfe.other").Info("other info")
+	l.Close()
+
+	want := "[DEBG] bfe.route route debug\n" +
+		"[WARN] bfe.route route warn\n" +
+		"[EROR] bfe.balance balance error\n" +
+		"[INFO] bfe.other other info\n"
+	contents, err := ioutil.ReadFile(testLogFile)
+	if err != nil {
+		t.Fatalf("Could not read output log: %s", err)
+	}
+	if string(contents) != want {
+		t.Errorf("got %q, want %q", string(contents), want)
+	}
+
+	// filter with higher level keeps its level
+	want = "[WARN] bfe.route route warn\n" +
+		"[EROR] bfe.balance balance error\n"
+	contents, err = ioutil.ReadFile(wfLogFile)
+	if err != nil {
+		t.Fatalf("Could not read output log: %s", err)
+	}
+	if string(contents) != want {
+		t.Errorf("got %q, want %q", string(contents), want)
+	}
+}
@@ -0,0 +1,518 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// overflow implements overflow policies of writer buffer, and counters of writers
+/*
+Usage:
+    // should be invoked before create logWriter
+    log4go.SetLogWithBlocking(false)
+    log4go.SetLogOverflowPolicy(log4go.OVERFLOW_DROP_OLDEST)
+
+    // wait for 100ms at most if buffer is full, then drop the record
+    log4go.SetLogOverflowPolicy(log4go.OVERFLOW_BLOCK)
+    log4go.SetLogBlockTimeout(100 * time.Millisecond)
+
+    // write records to local file if buffer is full, which are written by
+    // the writer later
+    log4go.SetLogOverflowPolicy(log4go.OVERFLOW_SPILL)
+    log4go.SetLogSpillFile("/home/work/log/spill", 64*1024*1024)
+
+Overflow policy applies when LogWithBlocking is false. Otherwise, LogWrite
+waits until the buffer has space.
+
+Spill files are named "<writer>.<pid>.<seq>.spill" in the spill dir, so that
+writers of the same name (e.g., while reloading) do not share a file. A spill
+file is removed when its writer is closed.
+
+Writers using ring buffer (FileLogWriter, TimeFileLogWriter, ConsoleLogWriter,
+PacketWriter, StreamWriter, SyslogWriter) count records dropped, records
+written and bytes written. If module state is enabled (see
+SetWithModuleState), the counters are shown in GetModuleState(), as
+"<writer>_dropped", "<writer>_written", "<writer>_bytes". Records failed to
+be written are also counted as dropped.
+
+Writers using channel (FormatLogWriter, SocketLogWriter) also count records
+by Stat(), until they are closed. As they have no spill file, OVERFLOW_SPILL
+drops the record being written for them.
+*/
+
+package log4go
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// overflow policies
+const (
+	OVERFLOW_DROP_NEWEST = iota // drop the record being written
+	OVERFLOW_DROP_OLDEST        // drop the oldest record in buffer
+	OVERFLOW_BLOCK              // wait for LogBlockTimeout, then drop the record
+	OVERFLOW_SPILL              // write records to spill file until buffer is drained
+)
+
+// default spill settings
+const (
+	SPILL_DIR_DEFAULT  = "./log/spill"
+	SPILL_SIZE_DEFAULT = 64 * 1024 * 1024
+)
+
+// max attempts to drop the oldest record
+const DROP_OLDEST_ATTEMPTS = 8
+
+// max attempts to create spill file, if the path exists
+const SPILL_OPEN_ATTEMPTS = 8
+
+// type of frame in spill file
+const (
+	spillRecord = iota
+	spillEnd
+	spillFlush
+)
+
+var overflowPolicyNames = map[string]int{
+	"drop_newest": OVERFLOW_DROP_NEWEST,
+	"drop_oldest": OVERFLOW_DROP_OLDEST,
+	"block":       OVERFLOW_BLOCK,
+	"spill":       OVERFLOW_SPILL,
+}
+
+var (
+	// overflow policy when buffer of writer is full and LogWithBlocking is false
+	LogOverflowPolicy = OVERFLOW_DROP_NEWEST
+	// max time to wait for OVERFLOW_BLOCK
+	LogBlockTimeout = 100 * time.Millisecond
+	// directory of spill files for OVERFLOW_SPILL, one file for each writer
+	LogSpillDir = SPILL_DIR_DEFAULT
+	// max size of each spill file, records are dropped if it is exceeded
+	LogSpillSize int64 = SPILL_SIZE_DEFAULT
+)
+
+// ParseOverflowPolicy converts policy name to overflow policy, name is one of
+// "drop_newest", "drop_oldest", "block", "spill"
+func ParseOverflowPolicy(name string) (int, error) {
+	policy, ok := overflowPolicyNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown overflow policy: %s", name)
+	}
+	return policy, nil
+}
+
+// set LogOverflowPolicy (default is OVERFLOW_DROP_NEWEST)
+// This should be invoked before create logWriter
+func SetLogOverflowPolicy(policy int) error {
+	if policy < OVERFLOW_DROP_NEWEST || policy > OVERFLOW_SPILL {
+		return fmt.Errorf("invalid overflow policy: %d", policy)
+	}
+	LogOverflowPolicy = policy
+	return nil
+}
+
+// set LogBlockTimeout (default is 100ms)
+// This should be invoked before create logWriter
+func SetLogBlockTimeout(timeout time.Duration) {
+	LogBlockTimeout = timeout
+}
+
+// set LogSpillDir and LogSpillSize (default is ./log/spill and 64M)
+// This should be invoked before create logWriter
+func SetLogSpillFile(dir string, maxSize int64) {
+	LogSpillDir = dir
+	LogSpillSize = maxSize
+}
+
+// WriterStat is counters of writer
+type WriterStat struct {
+	Dropped int64 // number of records dropped
+	Written int64 // number of records written
+	Bytes   int64 // number of bytes written
+}
+
+// WriterStatInfo is implemented by writers which provide counters
+type WriterStatInfo interface {
+	Stat() WriterStat
+}
+
+// batchBuffer holds formatted records, which are written by one system call
+type batchBuffer struct {
+	bytes.Buffer
+	records int // number of records in buffer
+}
+
+func (b *batchBuffer) Reset() {
+	b.Buffer.Reset()
+	b.records = 0
+}
+
+// recordSpill is spill file of ring. Each frame in file is type (1 byte),
+// length of data (4 bytes, big endian) and formatted record.
+type recordSpill struct {
+	file     *os.File
+	readOff  int64
+	writeOff int64
+	acks     []chan flushResult // acks of flush markers in file, in order
+	err      error              // error of opening file, file is not retried
+}
+
+// stat returns counters of ring
+func (r *recordRing) stat() WriterStat {
+	return WriterStat{
+		Dropped: atomic.LoadInt64(&r.dropped),
+		Written: atomic.LoadInt64(&r.written),
+		Bytes:   atomic.LoadInt64(&r.bytes),
+	}
+}
+
+// drop drops rec, and counts it
+func (r *recordRing) drop(rec *LogRecord) {
+	atomic.AddInt64(&r.dropped, 1)
+	rec.release()
+}
+
+// countWritten counts records and bytes written
+func (r *recordRing) countWritten(records int, bytes int) {
+	atomic.AddInt64(&r.written, int64(records))
+	atomic.AddInt64(&r.bytes, int64(bytes))
+}
+
+// countDropped counts records failed to be written
+func (r *recordRing) countDropped(records int) {
+	atomic.AddInt64(&r.dropped, int64(records))
+}
+
+// dropOldest drops the oldest record in ring to make space for rec.
+// Markers (see LogCloser and Flush) are not dropped, but moved to the end.
+func (r *recordRing) dropOldest(rec *LogRecord) bool {
+	for i := 0; i < DROP_OLDEST_ATTEMPTS; i++ {
+		if old, ok := r.tryGet(); ok {
+			if old == nil || old.flushAck != nil {
+				if !r.tryPut(old) {
+					r.put(context.Background(), old)
+				}
+				continue
+			}
+			r.drop(old)
+		}
+		if r.tryPut(rec) {
+			return true
+		}
+	}
+	return false
+}
+
+// chanCounter is counters of writer using channel, see WriterStat
+type chanCounter struct {
+	dropped int64
+	written int64
+	bytes   int64
+}
+
+// counters of writers using channel, chan *LogRecord => *chanCounter. They
+// are kept aside, since such writers are channels.
+var chanCounters sync.Map
+
+// newChanCounter creates counters of writer using ch
+func newChanCounter(ch chan *LogRecord) *chanCounter {
+	c := new(chanCounter)
+	chanCounters.Store(ch, c)
+	return c
+}
+
+// getChanCounter gets counters of writer using ch, nil if it is closed
+func getChanCounter(ch chan *LogRecord) *chanCounter {
+	if c, ok := chanCounters.Load(ch); ok {
+		return c.(*chanCounter)
+	}
+	return nil
+}
+
+// stat returns counters, zero if c is nil
+func (c *chanCounter) stat() WriterStat {
+	if c == nil {
+		return WriterStat{}
+	}
+	return WriterStat{
+		Dropped: atomic.LoadInt64(&c.dropped),
+		Written: atomic.LoadInt64(&c.written),
+		Bytes:   atomic.LoadInt64(&c.bytes),
+	}
+}
+
+// countDropped counts records dropped or failed to be written
+func (c *chanCounter) countDropped(records int) {
+	if c != nil {
+		atomic.AddInt64(&c.dropped, int64(records))
+	}
+}
+
+// countWritten counts records and bytes written
+func (c *chanCounter) countWritten(records int, bytes int) {
+	if c != nil {
+		atomic.AddInt64(&c.written, int64(records))
+		atomic.AddInt64(&c.bytes, int64(bytes))
+	}
+}
+
+// chanLogWrite sends rec to ch of writer. If ch is full and LogWithBlocking
+// is false, LogOverflowPolicy applies (OVERFLOW_SPILL as OVERFLOW_DROP_NEWEST).
+func chanLogWrite(ch chan *LogRecord, rec *LogRecord) {
+	if LogWithBlocking {
+		ch <- rec
+		return
+	}
+
+	select {
+	case ch <- rec:
+		return
+	default:
+	}
+
+	switch LogOverflowPolicy {
+	case OVERFLOW_DROP_OLDEST:
+		for i := 0; i < DROP_OLDEST_ATTEMPTS; i++ {
+			select {
+			case old := <-ch:
+				if old == nil || old.flushAck != nil {
+					// marker is not dropped, but moved to the end
+					ch <- old
+					continue
+				}
+				getChanCounter(ch).countDropped(1)
+			default:
+			}
+			select {
+			case ch <- rec:
+				return
+			default:
+			}
+		}
+	case OVERFLOW_BLOCK:
+		timer := time.NewTimer(LogBlockTimeout)
+		defer timer.Stop()
+		select {
+		case ch <- rec:
+			return
+		case <-timer.C:
+		}
+	}
+	getChanCounter(ch).countDropped(1)
+}
+
+// sequence of spill files opened by the process, see spillPath()
+var spillSeq uint64
+
+// spillPath returns path of spill file for the writer. The path is unique
+// for each ring, since writers of the same name may exist at the same time
+// (e.g., the old and new writers while reloading).
+func (r *recordRing) spillPath() string {
+	name := strings.Map(func(c rune) rune {
+		if c == '/' || c == '\\' || c == ':' {
+			return '_'
+		}
+		return c
+	}, strings.Trim(r.name, "/"))
+	seq := atomic.AddUint64(&spillSeq, 1)
+	return filepath.Join(LogSpillDir, fmt.Sprintf("%s.%d.%d.spill", name, os.Getpid(), seq))
+}
+
+// openSpill opens spill file, it is tried only once. Existing files are not
+// truncated, since they may be in use by other processes.
+func (r *recordRing) openSpill() *recordSpill {
+	if r.spill != nil {
+		return r.spill
+	}
+	r.spill = new(recordSpill)
+
+	if err := os.MkdirAll(LogSpillDir, 0755); err != nil {
+		r.spill.err = err
+	} else {
+		for i := 0; i < SPILL_OPEN_ATTEMPTS; i++ {
+			r.spill.file, r.spill.err = os.OpenFile(r.spillPath(), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+			if !os.IsExist(r.spill.err) {
+				break
+			}
+		}
+	}
+	if r.spill.err != nil {
+		fmt.Fprintf(os.Stderr, "log4go: open spill file of %s: %s\n", r.name, r.spill.err)
+	}
+	return r.spill
+}
+
+// closeSpill closes and removes spill file. It is called after the consumer
+// ends, and records left in file are lost.
+func (r *recordRing) closeSpill() {
+	r.spillLock.Lock()
+	defer r.spillLock.Unlock()
+
+	if r.spill == nil || r.spill.file == nil {
+		return
+	}
+	r.spill.file.Close()
+	os.Remove(r.spill.file.Name())
+	r.spill.file = nil
+	r.spill.err = os.ErrClosed
+}
+
+// spillWrite writes rec to spill file, and rec is released. If ring is not
+// full and nothing is in spill file, rec is put to ring instead.
+func (r *recordRing) spillWrite(rec *LogRecord) {
+	if !r.trySpill(rec) {
+		// marker could not be written to file, wait for space of ring
+		r.put(context.Background(), rec)
+	}
+}
+
+// trySpill writes rec to spill file. Records failed to be written are
+// dropped, and false is returned for markers failed to be written.
+func (r *recordRing) trySpill(rec *LogRecord) bool {
+	r.spillLock.Lock()
+	defer r.spillLock.Unlock()
+
+	if atomic.LoadInt64(&r.spilled) == 0 && r.tryPut(rec) {
+		return true
+	}
+
+	isMarker := rec == nil || rec.flushAck != nil
+	spill := r.openSpill()
+	if spill.err != nil {
+		if isMarker {
+			return false
+		}
+		r.drop(rec)
+		return true
+	}
+
+	var buf bytes.Buffer
+	buf.Write([]byte{spillRecord, 0, 0, 0, 0})
+	switch {
+	case rec == nil:
+		buf.Bytes()[0] = spillEnd
+	case rec.flushAck != nil:
+		buf.Bytes()[0] = spillFlush
+	default:
+		r.format(&buf, rec)
+		if spill.writeOff+int64(buf.Len()) > LogSpillSize {
+			r.drop(rec)
+			return true
+		}
+	}
+	binary.BigEndian.PutUint32(buf.Bytes()[1:5], uint32(buf.Len()-5))
+
+	if _, err := spill.file.WriteAt(buf.Bytes(), spill.writeOff); err != nil {
+		fmt.Fprintf(os.Stderr, "log4go: write spill file of %s: %s\n", r.name, err)
+		if isMarker {
+			return false
+		}
+		r.drop(rec)
+		return true
+	}
+	spill.writeOff += int64(buf.Len())
+
+	if rec != nil {
+		if rec.flushAck != nil {
+			spill.acks = append(spill.acks, rec.flushAck)
+		}
+		rec.release()
+	}
+	atomic.AddInt64(&r.spilled, 1)
+	r.wake()
+	return true
+}
+
+// spillRead appends records in spill file to batch, until batch is full.
+// The file is truncated if all records are read.
+func (r *recordRing) spillRead(batch []*LogRecord) []*LogRecord {
+	if atomic.LoadInt64(&r.spilled) == 0 {
+		return batch
+	}
+
+	r.spillLock.Lock()
+	defer r.spillLock.Unlock()
+
+	spill := r.spill
+	var hdr [5]byte
+	for len(batch) < cap(batch) && atomic.LoadInt64(&r.spilled) > 0 {
+		data, err := r.spillFrame(hdr[:])
+		if err != nil {
+			// records left in file are lost
+			fmt.Fprintf(os.Stderr, "log4go: read spill file of %s: %s\n", r.name, err)
+			r.countDropped(int(atomic.SwapInt64(&r.spilled, 0)))
+			break
+		}
+		atomic.AddInt64(&r.spilled, -1)
+
+		switch hdr[0] {
+		case spillEnd:
+			batch = append(batch, nil)
+		case spillFlush:
+			batch = append(batch, &LogRecord{flushAck: spill.acks[0]})
+			spill.acks = spill.acks[1:]
+		default:
+			rec := getRecord()
+			rec.refs = 1
+			rec.Binary = data
+			rec.spilled = true
+			batch = append(batch, rec)
+		}
+	}
+
+	if atomic.LoadInt64(&r.spilled) == 0 {
+		spill.file.Truncate(0)
+		spill.readOff, spill.writeOff = 0, 0
+		for _, ack := range spill.acks {
+			ack <- flushResult{err: io.ErrUnexpectedEOF}
+		}
+		spill.acks = nil
+	}
+	return batch
+}
+
+// spillFrame reads a frame from spill file
+func (r *recordRing) spillFrame(hdr []byte) ([]byte, error) {
+	spill := r.spill
+	if _, err := spill.file.ReadAt(hdr, spill.readOff); err != nil {
+		return nil, err
+	}
+	size := int64(binary.BigEndian.Uint32(hdr[1:5]))
+	if size > spill.writeOff-spill.readOff-int64(len(hdr)) {
+		return nil, fmt.Errorf("invalid frame size %d at offset %d", size, spill.readOff)
+	}
+	data := make([]byte, size)
+	if _, err := spill.file.ReadAt(data, spill.readOff+int64(len(hdr))); err != nil {
+		return nil, err
+	}
+	spill.readOff += int64(len(hdr) + len(data))
+	return data, nil
+}
+
+// formatRecord formats rec into out by format of writer. Records read from
+// spill file have been formatted.
+func (r *recordRing) formatRecord(out *batchBuffer, rec *LogRecord) {
+	if rec.spilled {
+		out.Write(rec.Binary)
+	} else {
+		r.format(&out.Buffer, rec)
+	}
+	out.records++
+}
@@ -0,0 +1,274 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log4go
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setOverflow sets overflow policy, and returns function to restore it
+func setOverflow(policy int) func() {
+	blocking, old := LogWithBlocking, LogOverflowPolicy
+	LogWithBlocking = false
+	LogOverflowPolicy = policy
+	return func() {
+		LogWithBlocking, LogOverflowPolicy = blocking, old
+	}
+}
+
+// putMessages writes records with given messages to r
+func putMessages(r *recordRing, msgs ...string) {
+	for _, msg := range msgs {
+		r.logWrite(&LogRecord{Message: msg})
+	}
+}
+
+// getMessages takes all records from r
+func getMessages(r *recordRing) []string {
+	var msgs []string
+	batch := r.getBatch(make([]*LogRecord, 0, LOG_BATCH_SIZE))
+	for _, rec := range batch {
+		if rec.spilled {
+			msgs = append(msgs, string(rec.Binary))
+		} else {
+			msgs = append(msgs, rec.Message)
+		}
+	}
+	return msgs
+}
+
+func TestOverflowDrop(t *testing.T) {
+	defer setOverflow(OVERFLOW_DROP_NEWEST)()
+	r := newRecordRing(2, "test", nil)
+	putMessages(r, "a", "b", "c", "d")
+	if got := strings.Join(getMessages(r), ","); got != "a,b" {
+		t.Errorf("drop newest: got %s, want a,b", got)
+	}
+	if stat := r.stat(); stat.Dropped != 2 {
+		t.Errorf("drop newest: got %d dropped, want 2", stat.Dropped)
+	}
+
+	LogOverflowPolicy = OVERFLOW_DROP_OLDEST
+	r = newRecordRing(2, "test", nil)
+	putMessages(r, "a", "b", "c", "d")
+	if got := strings.Join(getMessages(r), ","); got != "c,d" {
+		t.Errorf("drop oldest: got %s, want c,d", got)
+	}
+	if stat := r.stat(); stat.Dropped != 2 {
+		t.Errorf("drop oldest: got %d dropped, want 2", stat.Dropped)
+	}
+}
+
+// test overflow policies of writers using channel
+func TestOverflowChan(t *testing.T) {
+	defer setOverflow(OVERFLOW_DROP_NEWEST)()
+
+	ch := make(chan *LogRecord, 2)
+	defer chanCounters.Delete(ch)
+	c := newChanCounter(ch)
+	for _, msg := range []string{"a", "b", "c", "d"} {
+		chanLogWrite(ch, &LogRecord{Message: msg})
+	}
+	if got := (<-ch).Message + "," + (<-ch).Message; got != "a,b" {
+		t.Errorf("drop newest: got %s, want a,b", got)
+	}
+	if stat := c.stat(); stat.Dropped != 2 {
+		t.Errorf("drop newest: got %d dropped, want 2", stat.Dropped)
+	}
+
+	// flush marker is kept
+	LogOverflowPolicy = OVERFLOW_DROP_OLDEST
+	ack := make(chan flushResult, 1)
+	chanLogWrite(ch, &LogRecord{flushAck: ack})
+	for _, msg := range []string{"a", "b", "c"} {
+		chanLogWrite(ch, &LogRecord{Message: msg})
+	}
+	if rec := <-ch; rec.flushAck != ack {
+		t.Errorf("drop oldest: flush marker should be kept, got %q", rec.Message)
+	}
+	if rec := <-ch; rec.Message != "c" {
+		t.Errorf("drop oldest: got %s, want c", rec.Message)
+	}
+	if stat := c.stat(); stat.Dropped != 4 {
+		t.Errorf("drop oldest: got %d dropped, want 4", stat.Dropped)
+	}
+}
+
+func TestOverflowBlock(t *testing.T) {
+	defer setOverflow(OVERFLOW_BLOCK)()
+	defer func(timeout time.Duration) {
+		LogBlockTimeout = timeout
+	}(LogBlockTimeout)
+	LogBlockTimeout = 20 * time.Millisecond
+
+	r := newRecordRing(2, "test", nil)
+	putMessages(r, "a", "b")
+
+	start := time.Now()
+	putMessages(r, "c")
+	if time.Since(start) < LogBlockTimeout {
+		t.Errorf("LogWrite() should wait for %s", LogBlockTimeout)
+	}
+	if stat := r.stat(); stat.Dropped != 1 {
+		t.Errorf("got %d dropped, want 1", stat.Dropped)
+	}
+
+	// record is written if space is available in time
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		r.getBatch(make([]*LogRecord, 0, 1))
+	}()
+	putMessages(r, "d")
+	if got := strings.Join(getMessages(r), ","); got != "b,d" {
+		t.Errorf("got %s, want b,d", got)
+	}
+}
+
+func TestOverflowSpill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer setOverflow(OVERFLOW_SPILL)()
+	defer func(dir string, size int64) {
+		LogSpillDir, LogSpillSize = dir, size
+	}(LogSpillDir, LogSpillSize)
+	SetLogSpillFile(dir, 1024)
+
+	format := func(out *bytes.Buffer, rec *LogRecord) {
+		out.WriteString("[" + rec.Message + "]")
+	}
+	r := newRecordRing(2, "/path/to/test.log", format)
+	putMessages(r, "a", "b", "c", "d")
+	if r.Len() != 4 {
+		t.Errorf("Len(): got %d, want 4", r.Len())
+	}
+	// spill file is unique for each ring of the same name
+	r2 := newRecordRing(2, "/path/to/test.log", format)
+	putMessages(r2, "a", "b", "c")
+	files, _ := filepath.Glob(filepath.Join(dir, "path_to_test.log.*.spill"))
+	if len(files) != 2 {
+		t.Errorf("got spill files %v, want 2", files)
+	}
+	if got := strings.Join(getMessages(r2), ","); got != "a,b,[c]" {
+		t.Errorf("got %s, want a,b,[c]", got)
+	}
+	r2.closeSpill()
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.spill")); len(files) != 1 {
+		t.Errorf("spill file should be removed after closed, got %v", files)
+	}
+
+	// records in spill file are formatted, and taken after records in ring
+	if got := strings.Join(getMessages(r), ","); got != "a,b,[c],[d]" {
+		t.Errorf("got %s, want a,b,[c],[d]", got)
+	}
+
+	// ring is used again after spill file is drained
+	putMessages(r, "e")
+	if got := strings.Join(getMessages(r), ","); got != "e" {
+		t.Errorf("got %s, want e", got)
+	}
+	if stat := r.stat(); stat.Dropped != 0 {
+		t.Errorf("got %d dropped, want 0", stat.Dropped)
+	}
+
+	// records exceeding max size of spill file are dropped
+	putMessages(r, "f", "g", strings.Repeat("h", 2048), "i", "j")
+	if stat := r.stat(); stat.Dropped != 1 {
+		t.Errorf("got %d dropped, want 1", stat.Dropped)
+	}
+}
+
+// test records in spill file are written before flush and close
+func TestOverflowSpillWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer setOverflow(OVERFLOW_SPILL)()
+	defer func(dir string, length int) {
+		LogSpillDir, LogBufferLength = dir, length
+	}(LogSpillDir, LogBufferLength)
+	LogSpillDir = dir
+	LogBufferLength = 2
+
+	fname := filepath.Join(dir, "test.log")
+	w := NewFileLogWriter(fname, false).SetFormat("%M")
+	l := make(Logger)
+	l.AddFilter("file", INFO, w)
+
+	const count = 100
+	for i := 0; i < count; i++ {
+		l.Info("record")
+	}
+	if err := l.Flush(context.Background()); err != nil {
+		t.Errorf("Flush(): %s", err)
+	}
+	stat := w.Stat()
+	l.Close()
+
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile(): %s", err)
+	}
+	if n := strings.Count(string(data), "record\n"); n != count {
+		t.Errorf("got %d records, want %d", n, count)
+	}
+	if stat.Written != count || stat.Bytes != int64(len(data)) || stat.Dropped != 0 {
+		t.Errorf("unexpected stat %+v, size of file %d", stat, len(data))
+	}
+}
+
+func TestWriterStatState(t *testing.T) {
+	defer SetWithModuleState(WithModuleState)
+	SetWithModuleState(true)
+
+	var out bytes.Buffer
+	w := newConsoleLogWriter(&out)
+	l := make(Logger)
+	l.AddFilter("stdout", INFO, w)
+	l.Info("first")
+	l.Info("second")
+	l.Flush(context.Background())
+	state := GetModuleState()
+	l.Close()
+
+	// writers are removed from state when closed
+	for _, info := range getWritersInfo() {
+		if info == WriterInfo(w) {
+			t.Errorf("writer should be removed after closed")
+		}
+	}
+	if state.NumStates["stdout_written"] < 2 {
+		t.Errorf("stdout_written: got %d, want 2 at least", state.NumStates["stdout_written"])
+	}
+	if state.NumStates["stdout_bytes"] < int64(out.Len()) {
+		t.Errorf("stdout_bytes: got %d, want %d at least", state.NumStates["stdout_bytes"], out.Len())
+	}
+	if _, ok := state.NumStates["stdout_dropped"]; !ok {
+		t.Errorf("stdout_dropped not found")
+	}
+}
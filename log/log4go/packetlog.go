@@ -20,6 +20,8 @@
 package log4go
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -95,9 +97,10 @@ func (pc *PacketConn) Send(data []byte) error {
 type PacketWriter struct {
 	LogCloser //for Elegant exit
 
-	rec  chan *LogRecord
-	conn *PacketConn
-	name string
+	ring   *recordRing
+	conn   *PacketConn
+	name   string
+	format string
 }
 
 // Send sends data
@@ -106,23 +109,25 @@ func (w *PacketWriter) Send(data []byte) error {
 }
 
 func (w *PacketWriter) LogWrite(rec *LogRecord) {
-	if !LogWithBlocking {
-		if len(w.rec) >= LogBufferLength {
-			return
-		}
-	}
-
-	w.rec <- rec
+	w.ring.logWrite(rec)
 }
 
+// PacketWriter consumes records from ring
+func (w *PacketWriter) consumeRing() {}
+
 // Name gets writer name
 func (w *PacketWriter) Name() string {
 	return w.name
 }
 
-// QueueLen gets length of rec channel
+// QueueLen gets number of records in ring
 func (w *PacketWriter) QueueLen() int {
-	return len(w.rec)
+	return w.ring.Len()
+}
+
+// Stat gets counters of writer
+func (w *PacketWriter) Stat() WriterStat {
+	return w.ring.stat()
 }
 
 func NewPacketWriter(name string, network string,
@@ -135,40 +140,73 @@ func NewPacketWriter(name string, network string,
 	}
 
 	w := &PacketWriter{
-		rec:  make(chan *LogRecord, LogBufferLength),
-		conn: conn,
-		name: name,
+		conn:   conn,
+		name:   name,
+		format: format,
 	}
 
+	w.ring = newRecordRing(LogBufferLength, name, w.formatRecord)
+
 	//init LogCloser
 	w.LogCloserInit()
 
 	// add w to collection of all writers' info
-	writersInfo = append(writersInfo, w)
+	registerWriter(w)
+
+	go w.run()
+
+	return w
+}
+
+// run takes records from ring in batch, and sends them. Each record is sent
+// in one packet.
+func (w *PacketWriter) run() {
+	var buf batchBuffer
+	batch := make([]*LogRecord, 0, LOG_BATCH_SIZE)
 
-	go func() {
-		for {
-			rec := <-w.rec
+	for {
+		batch = w.ring.getBatch(batch)
 
+		for _, rec := range batch {
 			if w.EndNotify(rec) {
 				return
 			}
+			if w.FlushNotify(rec, nil) {
+				continue
+			}
+
+			w.ring.formatRecord(&buf, rec)
+			if err := w.Send(buf.Bytes()); err != nil {
+				w.ring.countDropped(1)
+			} else {
+				w.ring.countWritten(1, buf.Len())
+			}
+			buf.Reset()
 
 			if rec.Binary != nil {
-				w.Send(rec.Binary)
 				putBuffer(rec.Binary) // Binary is allocated from buffer pool
-			} else {
-				msg := FormatLogRecord(format, rec)
-				w.Send([]byte(msg))
 			}
+			rec.release()
 		}
-	}()
+	}
+}
 
-	return w
+// formatRecord formats rec into out, binary record is sent as it is
+func (w *PacketWriter) formatRecord(out *bytes.Buffer, rec *LogRecord) {
+	if rec.Binary != nil {
+		out.Write(rec.Binary)
+	} else {
+		writeLogRecord(out, w.format, rec)
+	}
+}
+
+// Flush sends records buffered before
+func (w *PacketWriter) Flush(ctx context.Context) (int, error) {
+	return w.ring.waitForFlush(ctx)
 }
 
-// Close waits for dump all log and closes chan
+// Close waits for dump all log
 func (w *PacketWriter) Close() {
-	w.WaitForEnd(w.rec)
-	close(w.rec)
+	w.ring.waitForEnd(&w.LogCloser)
+	unregisterWriter(w)
 }
@@ -16,10 +16,18 @@
 package log4go
 
 import (
-	"fmt"
+	"context"
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
+	"os"
+	"strconv"
+	"strings"
+	"path/filepath"
 	"sync"
+	"time"
+	"unicode/utf8"
 )
 
 const (
@@ -27,17 +35,27 @@ const (
     FORMAT_DEFAULT_WITH_PID = "[%D %T] [%L] [%P] (%S) %M"
 	FORMAT_SHORT            = "[%t %d] [%L] %M"
 	FORMAT_ABBREV           = "[%L] %M"
+	FORMAT_JSON             = "json" // one JSON object per line, see FormatLogRecordJSON
 )
 
 type formatCacheType struct {
 	LastUpdateSeconds    int64
+	location             *time.Location // location of time, see SetLogTimeUTC
 	shortTime, shortDate string
 	longTime, longDate   string
+	clock                string // 15:04:05, prefix of time with fraction
+	isoTime, isoZone     string // 2006-01-02T15:04:05 and Z07:00 of ISO8601 time
 }
 
 var formatCache = &formatCacheType{}
 var formatMutex sync.Mutex
 
+// hostname and program name, for %H and %A
+var (
+	logHostname, _ = os.Hostname()
+	logProgram     = filepath.Base(os.Args[0])
+)
+
 var (
     // pool used to format log
     bufPool sync.Pool
@@ -66,10 +84,29 @@ func putBuf(bb *bytes.Buffer) {
 // %d - Date (01/02/06)
 // %L - Level (FNST, FINE, DEBG, TRAC, WARN, EROR, CRIT)
 // %P - Pid of process
-// %S - Source
+// %S - Source (func:line)
+// %s - Short source file (file.go:line)
+// %p - Full path of source file (/path/to/file.go:line)
+// %c - Function of source (github.com/baidu/go-lib/log.Init)
 // %M - Message
+// %F - Structured fields (k1=v1 k2=v2), appended to %M if format has no %F
+// %N - Name of module (see Logger.Named), empty if not named
+// %R - Request id (see Logger.InfoCtx), empty if not set
+// %m - Time with milliseconds (15:04:05.000)
+// %u - Time with microseconds (15:04:05.000000)
+// %I - ISO8601 (RFC3339) time with milliseconds (2006-01-02T15:04:05.000+08:00)
+// %H - Hostname
+// %A - Program name
+// %G - Goroutine id (see SetLogGoroutineID), empty if not recorded
 // Ignores unknown formats
 // Recommended: "[%D %T] [%L] (%S) %M"
+//
+// Time is in local time zone, or in UTC if LogTimeUTC is set. Verbs may have
+// a width, e.g. "%-5L" pads the level with spaces on the right to 5
+// characters, and "%5L" pads on the left. Values longer than the width are
+// not truncated.
+//
+// If format is FORMAT_JSON ("json"), the record is encoded by FormatLogRecordJSON.
 func FormatLogRecord(format string, rec *LogRecord) string {
 	if rec == nil {
 		return "<nil>"
@@ -77,38 +114,68 @@ func FormatLogRecord(format string, rec *LogRecord) string {
 	if len(format) == 0 {
 		return ""
 	}
+	if format == FORMAT_JSON {
+		return FormatLogRecordJSON(rec)
+	}
 
 	out := newBuf()
     defer putBuf(out)
 
-    secs := rec.Created.UnixNano() / 1e9
+	writeLogRecord(out, format, rec)
+	return out.String()
+}
+
+// writeLogRecord formats rec and appends it to out, see FormatLogRecord
+func writeLogRecord(out *bytes.Buffer, format string, rec *LogRecord) {
+	if len(format) == 0 {
+		return
+	}
+	if format == FORMAT_JSON {
+		writeLogRecordJSON(out, rec)
+		return
+	}
+
+	created := rec.Created
+	if LogTimeUTC {
+		created = created.UTC()
+	}
+	secs := created.Unix()
 
 	formatMutex.Lock()
 	cache := *formatCache
 	formatMutex.Unlock()
-	if cache.LastUpdateSeconds != secs {
-		month, day, year := rec.Created.Month(), rec.Created.Day(), rec.Created.Year()
-		hour, minute, second := rec.Created.Hour(), rec.Created.Minute(), rec.Created.Second()
-		zone, _ := rec.Created.Zone()
-		updated := &formatCacheType{
-			LastUpdateSeconds: secs,
-			shortTime:         fmt.Sprintf("%02d:%02d", hour, minute),
-			shortDate:         fmt.Sprintf("%02d/%02d/%02d", month, day, year%100),
-			longTime:          fmt.Sprintf("%02d:%02d:%02d %s", hour, minute, second, zone),
-			longDate:          fmt.Sprintf("%04d/%02d/%02d", year, month, day),
-		}
+	if cache.LastUpdateSeconds != secs || cache.location != created.Location() {
+		updated := newFormatCache(created)
 		formatMutex.Lock()
 		cache = *updated
 		formatCache = updated
 		formatMutex.Unlock()
 	}
 
-	// Split the string into pieces by % signs
-	pieces := bytes.Split([]byte(format), []byte{'%'})
+	// fields follow the message, unless there is a place for them
+	fieldsWithMsg := len(rec.Fields) > 0 && !formatHasVerb(format, 'F')
+
+	// Iterate over the pieces split by % signs, replacing known formats
+	for i := 0; ; i++ {
+		piece := format
+		next := strings.IndexByte(format, '%')
+		if next >= 0 {
+			piece = format[:next]
+			format = format[next+1:]
+		}
 
-	// Iterate over the pieces, replacing known formats
-	for i, piece := range pieces {
 		if i > 0 && len(piece) > 0 {
+			left, width, n := parseWidth(piece)
+			piece = piece[n:]
+			if len(piece) == 0 {
+				// no verb after width
+				if next < 0 {
+					break
+				}
+				continue
+			}
+
+			start := out.Len()
 			switch piece[0] {
 			case 'T':
 				out.WriteString(cache.longTime)
@@ -118,57 +185,394 @@ func FormatLogRecord(format string, rec *LogRecord) string {
 				out.WriteString(cache.longDate)
 			case 'd':
 				out.WriteString(cache.shortDate)
+			case 'm':
+				out.WriteString(cache.clock)
+				writeFraction(out, created.Nanosecond()/1e6, 3)
+			case 'u':
+				out.WriteString(cache.clock)
+				writeFraction(out, created.Nanosecond()/1e3, 6)
+			case 'I':
+				out.WriteString(cache.isoTime)
+				writeFraction(out, created.Nanosecond()/1e6, 3)
+				out.WriteString(cache.isoZone)
 			case 'L':
 				out.WriteString(levelStrings[rec.Level])
-            case 'P':
-                out.WriteString(LogProcessId)
+			case 'P':
+				out.WriteString(LogProcessId)
+			case 'H':
+				out.WriteString(logHostname)
+			case 'A':
+				out.WriteString(logProgram)
+			case 'G':
+				if rec.Goroutine > 0 {
+					out.WriteString(strconv.FormatUint(rec.Goroutine, 10))
+				}
 			case 'S':
 				out.WriteString(rec.Source)
+			case 's':
+				out.WriteString(rec.Caller.ShortFile())
+			case 'p':
+				out.WriteString(rec.Caller.FullFile())
+			case 'c':
+				out.WriteString(rec.Caller.FunctionName())
 			case 'M':
 				out.WriteString(rec.Message)
+				if fieldsWithMsg {
+					writeFields(out, rec.Fields)
+				}
+			case 'F':
+				writeFields(out, rec.Fields)
+			case 'N':
+				out.WriteString(rec.Name)
+			case 'R':
+				out.WriteString(rec.RequestID)
+			}
+			if width > 0 {
+				padVerb(out, start, width, left)
 			}
 			if len(piece) > 1 {
-				out.Write(piece[1:])
+				out.WriteString(piece[1:])
 			}
 		} else if len(piece) > 0 {
-			out.Write(piece)
+			out.WriteString(piece)
+		}
+
+		if next < 0 {
+			break
 		}
 	}
 	out.WriteByte('\n')
+}
+
+// newFormatCache creates cache of time strings for the second of t. All the
+// strings share one allocation.
+func newFormatCache(t time.Time) *formatCacheType {
+	year, month, day := t.Date()
+	hour, minute, second := t.Clock()
+	zone, offset := t.Zone()
+
+	var arr [128]byte
+	b := arr[:0]
+	// 15:04:05 MST
+	b = appendDigits(b, hour, 2)
+	b = append(b, ':')
+	b = appendDigits(b, minute, 2)
+	b = append(b, ':')
+	b = appendDigits(b, second, 2)
+	b = append(b, ' ')
+	b = append(b, zone...)
+	longTimeEnd := len(b)
+	// 2006/01/02
+	b = appendDigits(b, year, 4)
+	b = append(b, '/')
+	b = appendDigits(b, int(month), 2)
+	b = append(b, '/')
+	b = appendDigits(b, day, 2)
+	longDateEnd := len(b)
+	// 01/02/06
+	b = appendDigits(b, int(month), 2)
+	b = append(b, '/')
+	b = appendDigits(b, day, 2)
+	b = append(b, '/')
+	b = appendDigits(b, year%100, 2)
+	shortDateEnd := len(b)
+	// 2006-01-02T15:04:05
+	b = appendDigits(b, year, 4)
+	b = append(b, '-')
+	b = appendDigits(b, int(month), 2)
+	b = append(b, '-')
+	b = appendDigits(b, day, 2)
+	b = append(b, 'T')
+	b = append(b, b[:8]...)
+	isoTimeEnd := len(b)
+	// Z07:00
+	if offset == 0 {
+		b = append(b, 'Z')
+	} else {
+		sign := byte('+')
+		if offset < 0 {
+			sign = '-'
+			offset = -offset
+		}
+		b = append(b, sign)
+		b = appendDigits(b, offset/3600, 2)
+		b = append(b, ':')
+		b = appendDigits(b, offset%3600/60, 2)
+	}
+
+	str := string(b)
+	return &formatCacheType{
+		LastUpdateSeconds: t.Unix(),
+		location:          t.Location(),
+		shortTime:         str[:5],
+		shortDate:         str[longDateEnd:shortDateEnd],
+		longTime:          str[:longTimeEnd],
+		longDate:          str[longTimeEnd:longDateEnd],
+		clock:             str[:8],
+		isoTime:           str[shortDateEnd:isoTimeEnd],
+		isoZone:           str[isoTimeEnd:],
+	}
+}
+
+// appendDigits appends v in decimal, padded with zeros to width
+func appendDigits(b []byte, v int, width int) []byte {
+	var buf [20]byte
+	i := len(buf)
+	for v >= 10 || width > 1 {
+		i--
+		buf[i] = byte('0' + v%10)
+		v /= 10
+		width--
+	}
+	i--
+	buf[i] = byte('0' + v)
+	return append(b, buf[i:]...)
+}
+
+// writeFraction writes "." and fraction of second with given digits
+func writeFraction(out *bytes.Buffer, frac int, digits int) {
+	var buf [7]byte
+	buf[0] = '.'
+	for i := digits; i > 0; i-- {
+		buf[i] = byte('0' + frac%10)
+		frac /= 10
+	}
+	out.Write(buf[:digits+1])
+}
+
+// parseWidth parses width modifier at the beginning of piece, e.g. "-5" of
+// "-5L". It returns whether to align left, the width (0 if not set) and
+// number of bytes parsed.
+func parseWidth(piece string) (left bool, width int, n int) {
+	if n < len(piece) && piece[n] == '-' {
+		left = true
+		n++
+	}
+	for n < len(piece) && piece[n] >= '0' && piece[n] <= '9' {
+		width = width*10 + int(piece[n]-'0')
+		n++
+	}
+	return left, width, n
+}
+
+// padVerb pads value written to out since start with spaces to width
+func padVerb(out *bytes.Buffer, start int, width int, left bool) {
+	pad := width - utf8.RuneCount(out.Bytes()[start:])
+	if pad <= 0 {
+		return
+	}
+	end := out.Len()
+	for i := 0; i < pad; i++ {
+		out.WriteByte(' ')
+	}
+	if !left {
+		// move value to the right
+		b := out.Bytes()
+		copy(b[start+pad:], b[start:end])
+		for i := start; i < start+pad; i++ {
+			b[i] = ' '
+		}
+	}
+}
+
+// formatHasVerb checks whether format has the verb, with or without width
+func formatHasVerb(format string, verb byte) bool {
+	for {
+		next := strings.IndexByte(format, '%')
+		if next < 0 {
+			return false
+		}
+		format = format[next+1:]
+		_, _, n := parseWidth(format)
+		if n < len(format) && format[n] == verb {
+			return true
+		}
+	}
+}
+
+// process id for json format
+var jsonPid = strconv.Itoa(os.Getpid())
+
+// keys of json object, used by record itself
+var jsonReservedKeys = map[string]bool{
+	"time":    true,
+	"level":   true,
+	"pid":     true,
+	"source":  true,
+	"message": true,
+	"logger":  true,
+}
+
+// key of request id in json object
+const jsonRequestIDKey = "request_id"
 
+// FormatLogRecordJSON encodes the record to one line of JSON object, e.g.
+//   {"time":"2009-02-13T23:31:30.123456Z","level":"EROR","pid":1234,
+//    "source":"main.main:10","message":"message","request_id":"abc"}
+//
+// Name of module (see Logger.Named) is added as "logger", and request id (see
+// Logger.InfoCtx) is added as "request_id", if not empty.
+// Structured fields are placed at top level of the object. A field with same
+// key as the record itself (time, level, pid, source, message, logger, and
+// request_id if request id is set) is renamed to "fields.<key>".
+func FormatLogRecordJSON(rec *LogRecord) string {
+	if rec == nil {
+		return "<nil>"
+	}
+
+	out := newBuf()
+	defer putBuf(out)
+
+	writeLogRecordJSON(out, rec)
 	return out.String()
 }
 
+// writeLogRecordJSON encodes rec and appends it to out, see FormatLogRecordJSON
+func writeLogRecordJSON(out *bytes.Buffer, rec *LogRecord) {
+	var timeBuf [64]byte
+	out.WriteString(`{"time":"`)
+	out.Write(rec.Created.AppendFormat(timeBuf[:0], "2006-01-02T15:04:05.000000Z07:00"))
+	out.WriteString(`","level":"`)
+	out.WriteString(rec.Level.String())
+	out.WriteString(`","pid":`)
+	out.WriteString(jsonPid)
+	out.WriteString(`,"source":`)
+	writeJSONString(out, rec.Source)
+	out.WriteString(`,"message":`)
+	writeJSONString(out, rec.Message)
+	if len(rec.Name) > 0 {
+		out.WriteString(`,"logger":`)
+		writeJSONString(out, rec.Name)
+	}
+	if len(rec.RequestID) > 0 {
+		out.WriteString(`,"` + jsonRequestIDKey + `":`)
+		writeJSONString(out, rec.RequestID)
+	}
+
+	for _, f := range rec.Fields {
+		key := f.Key
+		if jsonReservedKeys[key] || (key == jsonRequestIDKey && len(rec.RequestID) > 0) {
+			key = "fields." + key
+		}
+		out.WriteByte(',')
+		writeJSONString(out, key)
+		out.WriteByte(':')
+		writeJSONValue(out, f.Value)
+	}
+	out.WriteString("}\n")
+}
+
+// writeJSONValue writes value of field in json
+func writeJSONValue(out *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		writeJSONString(out, v)
+		return
+	case error:
+		writeJSONString(out, v.Error())
+		return
+	case json.Marshaler:
+		// e.g., time.Time
+	case fmt.Stringer:
+		writeJSONString(out, v.String())
+		return
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		writeJSONString(out, fmt.Sprint(value))
+		return
+	}
+	out.Write(data)
+}
+
+// writeJSONString writes quoted and escaped string in json
+func writeJSONString(out *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+
+	out.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				out.WriteString(`\ufffd`)
+			} else {
+				out.WriteString(s[i : i+size])
+			}
+			i += size
+			continue
+		}
+
+		switch c {
+		case '"', '\\':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\r':
+			out.WriteString(`\r`)
+		case '\t':
+			out.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				out.WriteString(`\u00`)
+				out.WriteByte(hex[c>>4])
+				out.WriteByte(hex[c&0xf])
+			} else {
+				out.WriteByte(c)
+			}
+		}
+		i++
+	}
+	out.WriteByte('"')
+}
+
 // This is the standard writer that prints to standard output.
 type FormatLogWriter chan *LogRecord
 
 // This creates a new FormatLogWriter
 func NewFormatLogWriter(out io.Writer, format string) FormatLogWriter {
 	records := make(FormatLogWriter, LogBufferLength)
+	newChanCounter(records)
 	go records.run(out, format)
 	return records
 }
 
 func (w FormatLogWriter) run(out io.Writer, format string) {
+	counter := getChanCounter(w)
 	for rec := range w {
-		fmt.Fprint(out, FormatLogRecord(format, rec))
+		if flushNotify(rec, nil) {
+			continue
+		}
+		n, err := fmt.Fprint(out, FormatLogRecord(format, rec))
+		if err != nil {
+			counter.countDropped(1)
+		} else {
+			counter.countWritten(1, n)
+		}
 	}
 }
 
 // This is the FormatLogWriter's output method.  This will block if the output
-// buffer is full.
+// buffer is full, or LogOverflowPolicy applies if LogWithBlocking is false.
 func (w FormatLogWriter) LogWrite(rec *LogRecord) {
-    if !LogWithBlocking {
-        if len(w) >= LogBufferLength {            
-            return
-        }
-    }
-    
-	w <- rec
+	chanLogWrite(w, rec)
+}
+
+// Stat gets counters of writer, they are zero after Close
+func (w FormatLogWriter) Stat() WriterStat {
+	return getChanCounter(w).stat()
+}
+
+// Flush writes records buffered before
+func (w FormatLogWriter) Flush(ctx context.Context) (int, error) {
+	return waitForFlush(ctx, w)
 }
 
 // Close stops the logger from sending messages to standard output.  Attempts to
 // send log messages to this logger after a Close have undefined behavior.
 func (w FormatLogWriter) Close() {
+	chanCounters.Delete(chan *LogRecord(w))
 	close(w)
 }
@@ -0,0 +1,425 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// redact masks sensitive data in log records before they are written
+/*
+Usage:
+    // mask passwords, tokens and phone numbers in records of "log" filter
+    redactor, err := log4go.NewRedactorByNames("password", "token", "phone")
+    if err != nil {
+        return err
+    }
+    redactor.AddFields("card_no").SetMask("***")
+    logger.SetRedactor("log", redactor)
+
+    // register pattern for use in configuration; only the group named
+    // "secret" is masked if the pattern has it
+    log4go.RegisterRedactPattern("session", `session=(?P<secret>\w+)`)
+
+In configuration, redaction is set by properties of any filter type:
+    <property name="redact">password,token,session</property>
+    <property name="redactfields">card_no,passwd</property>
+    <property name="redactmask">***</property>
+
+Patterns are applied to the message and fields (as "key=value"), so that
+e.g. value of field "password" is masked by pattern password. Values of
+fields with given names (case insensitive) are masked entirely. Records are redacted
+before being sent to writers of the filter, so the original data never
+reaches files or remote servers of the filter. Binary records are not
+redacted.
+
+Builtin patterns are:
+    password  value of password/passwd/pwd, e.g., password=123456
+    token     value of token/access_token/api_key/secret, and bearer token
+    phone     mobile phone number of China, middle 4 digits masked
+    idcard    ID card number of China, birthday masked
+    email     user name of email address
+*/
+package log4go
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// default mask of redacted data
+	REDACT_MASK = "******"
+	// name of group masked in redact pattern
+	REDACT_GROUP = "secret"
+)
+
+var (
+	redactPatternsLock sync.RWMutex
+	redactPatterns     = map[string]*regexp.Regexp{
+		"password": regexp.MustCompile(`(?i)\b(?:password|passwd|pwd)["']?\s*[:=]\s*["']?(?P<secret>[^\s"'&,;]+)`),
+		"token":    regexp.MustCompile(`(?i)\b(?:access_token|token|api_?key|secret|bearer)(?:["']?\s*[:=]\s*["']?|\s+)(?P<secret>[^\s"'&,;]+)`),
+		"phone":    regexp.MustCompile(`\b1[3-9]\d(?P<secret>\d{4})\d{4}\b`),
+		"idcard":   regexp.MustCompile(`\b\d{6}(?P<secret>(?:18|19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01]))\d{3}[\dXx]\b`),
+		"email":    regexp.MustCompile(`\b(?P<secret>[\w.%+-]+)@[\w-]+(?:\.[\w-]+)+\b`),
+	}
+)
+
+// RegisterRedactPattern registers pattern with name, for NewRedactorByNames
+// and configuration. If the pattern has a group named REDACT_GROUP, only the
+// group is masked; otherwise the whole match is masked.
+//
+// PARAMS:
+//   - name: name of pattern, e.g., "session"
+//   - expr: regular expression, see regexp/syntax
+func RegisterRedactPattern(name string, expr string) error {
+	if len(name) == 0 {
+		return errors.New("name of redact pattern is empty")
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("redact pattern %s: %s", name, err)
+	}
+
+	redactPatternsLock.Lock()
+	redactPatterns[name] = re
+	redactPatternsLock.Unlock()
+	return nil
+}
+
+// redactPattern gets registered pattern with name
+func redactPattern(name string) (*regexp.Regexp, error) {
+	redactPatternsLock.RLock()
+	re, ok := redactPatterns[name]
+	redactPatternsLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown redact pattern: %s", name)
+	}
+	return re, nil
+}
+
+// redactRule is a pattern, and index of its group to mask
+type redactRule struct {
+	re    *regexp.Regexp
+	group int // index of REDACT_GROUP, -1 for the whole match
+}
+
+// Redactor masks sensitive data in log records. It should not be changed
+// after being set to a filter.
+type Redactor struct {
+	rules  []redactRule
+	fields map[string]bool // lower case names of fields to mask
+	mask   string
+}
+
+// NewRedactor creates a redactor without any pattern or field
+func NewRedactor() *Redactor {
+	return &Redactor{
+		fields: make(map[string]bool),
+		mask:   REDACT_MASK,
+	}
+}
+
+// NewRedactorByNames creates a redactor with registered patterns
+//
+// PARAMS:
+//   - names: names of patterns, see RegisterRedactPattern
+func NewRedactorByNames(names ...string) (*Redactor, error) {
+	r := NewRedactor()
+	for _, name := range names {
+		re, err := redactPattern(name)
+		if err != nil {
+			return nil, err
+		}
+		r.AddRegexp(re)
+	}
+	return r, nil
+}
+
+// AddRegexp adds pattern to mask. Returns the redactor for chaining.
+func (r *Redactor) AddRegexp(re *regexp.Regexp) *Redactor {
+	r.rules = append(r.rules, redactRule{re: re, group: re.SubexpIndex(REDACT_GROUP)})
+	return r
+}
+
+// AddPattern compiles expr and adds it as pattern to mask
+func (r *Redactor) AddPattern(expr string) error {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return err
+	}
+	r.AddRegexp(re)
+	return nil
+}
+
+// AddFields adds names of fields, values of which are masked entirely.
+// Names are case insensitive. Returns the redactor for chaining.
+func (r *Redactor) AddFields(names ...string) *Redactor {
+	for _, name := range names {
+		r.fields[strings.ToLower(name)] = true
+	}
+	return r
+}
+
+// SetMask sets the string replacing sensitive data, REDACT_MASK by default.
+// Returns the redactor for chaining.
+func (r *Redactor) SetMask(mask string) *Redactor {
+	r.mask = mask
+	return r
+}
+
+// RedactString masks matches of patterns in str
+func (r *Redactor) RedactString(str string) string {
+	for _, rule := range r.rules {
+		str = rule.replace(str, r.mask)
+	}
+	return str
+}
+
+// replace masks matches of the rule in str
+func (rule redactRule) replace(str string, mask string) string {
+	matches := rule.re.FindAllStringSubmatchIndex(str, -1)
+	if len(matches) == 0 {
+		return str
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if rule.group > 0 {
+			start, end = m[2*rule.group], m[2*rule.group+1]
+			if start < 0 {
+				continue
+			}
+		}
+		b.WriteString(str[last:start])
+		b.WriteString(mask)
+		last = end
+	}
+	b.WriteString(str[last:])
+	return b.String()
+}
+
+// Redact returns rec with sensitive data masked. rec is not changed; a copy
+// is returned if anything is masked.
+func (r *Redactor) Redact(rec *LogRecord) *LogRecord {
+	msg := r.RedactString(rec.Message)
+
+	var fields []Field
+	for i, f := range rec.Fields {
+		value, changed := r.redactField(f)
+		if !changed {
+			continue
+		}
+		if fields == nil {
+			fields = make([]Field, len(rec.Fields))
+			copy(fields, rec.Fields)
+		}
+		fields[i].Value = value
+	}
+
+	if msg == rec.Message && fields == nil {
+		return rec
+	}
+
+	redacted := &LogRecord{
+		Level:     rec.Level,
+		Created:   rec.Created,
+		Source:    rec.Source,
+		Caller:    rec.Caller,
+		Goroutine: rec.Goroutine,
+		Message:   msg,
+		Binary:    rec.Binary,
+		Fields:    rec.Fields,
+		Name:      rec.Name,
+		RequestID: rec.RequestID,
+	}
+	if fields != nil {
+		redacted.Fields = fields
+	}
+	return redacted
+}
+
+// redactField returns value of field with sensitive data masked, and
+// whether it is changed. Patterns are applied to "key=value" of the field.
+func (r *Redactor) redactField(f Field) (interface{}, bool) {
+	if r.fields[strings.ToLower(f.Key)] {
+		return r.mask, true
+	}
+	if len(r.rules) == 0 {
+		return f.Value, false
+	}
+
+	var str string
+	switch v := f.Value.(type) {
+	case nil, bool, time.Time, time.Duration:
+		return f.Value, false
+	case string:
+		str = v
+	case error:
+		str = v.Error()
+	case fmt.Stringer:
+		str = v.String()
+	default:
+		// e.g., phone number in integer
+		str = fmt.Sprint(v)
+	}
+
+	// patterns are matched against key=value, as the field is written, so
+	// that e.g. "password" masks value of field with key "password"
+	prefix := f.Key + "="
+	str = prefix + str
+	redacted := r.RedactString(str)
+	if redacted == str {
+		return f.Value, false
+	}
+	if !strings.HasPrefix(redacted, prefix) {
+		// key is masked too
+		return r.mask, true
+	}
+	return redacted[len(prefix):], true
+}
+
+// redactors of filters, *Filter => *Redactor. They are kept aside, so that
+// Filter could still be created by unkeyed literal.
+var (
+	redactors     sync.Map
+	redactorCount int32 // number of filters with redactor, for fast path
+)
+
+// redactor gets redactor of the filter, nil if not set
+func (filt *Filter) redactor() *Redactor {
+	if atomic.LoadInt32(&redactorCount) == 0 {
+		return nil
+	}
+	if r, ok := redactors.Load(filt); ok {
+		return r.(*Redactor)
+	}
+	return nil
+}
+
+// setRedactor sets redactor of the filter, nil to remove it
+func (filt *Filter) setRedactor(r *Redactor) {
+	if r == nil {
+		if _, ok := redactors.LoadAndDelete(filt); ok {
+			atomic.AddInt32(&redactorCount, -1)
+		}
+		return
+	}
+	if _, ok := redactors.Swap(filt, r); !ok {
+		atomic.AddInt32(&redactorCount, 1)
+	}
+}
+
+// SetRedactor sets redactor of the filter with given name, nil to disable
+// redaction. It should be called before logging to the filter. Redactor is
+// removed when the filter is closed by Close, CloseWithTimeout or Shutdown.
+func (log Logger) SetRedactor(name string, r *Redactor) error {
+	filt, ok := log[name]
+	if !ok {
+		return fmt.Errorf("filter not exist: %s", name)
+	}
+	filt.setRedactor(r)
+	return nil
+}
+
+// MergeRedactor returns a redactor masking data masked by redactors of all
+// filters of the logger, e.g., for another filter receiving the same records.
+// Mask of the first filter (by name) with redactor is used. Returns nil if no
+// filter has redactor.
+func (log Logger) MergeRedactor() *Redactor {
+	names := make([]string, 0, len(log))
+	for name := range log {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var merged *Redactor
+	for _, name := range names {
+		r := log[name].redactor()
+		if r == nil {
+			continue
+		}
+		if merged == nil {
+			merged = NewRedactor().SetMask(r.mask)
+		}
+		for _, rule := range r.rules {
+			if !merged.hasRegexp(rule.re) {
+				merged.rules = append(merged.rules, rule)
+			}
+		}
+		for field := range r.fields {
+			merged.fields[field] = true
+		}
+	}
+	return merged
+}
+
+// hasRegexp checks whether the pattern is added to the redactor
+func (r *Redactor) hasRegexp(re *regexp.Regexp) bool {
+	for _, rule := range r.rules {
+		if rule.re == re {
+			return true
+		}
+	}
+	return false
+}
+
+// properties of redaction for filters of all types
+var redactProperties = map[string]int{
+	"redact":       propString,
+	"redactfields": propString,
+	"redactmask":   propString,
+}
+
+// propsToRedactor creates redactor by properties of filter, or nil if
+// redaction is not configured
+func propsToRedactor(props []xmlProperty) (*Redactor, error) {
+	var names, fields []string
+	mask := REDACT_MASK
+	for _, prop := range props {
+		value := strings.Trim(prop.Value, " \r\n")
+		switch prop.Name {
+		case "redact":
+			names = splitList(value)
+		case "redactfields":
+			fields = splitList(value)
+		case "redactmask":
+			mask = value
+		}
+	}
+	if len(names) == 0 && len(fields) == 0 {
+		return nil, nil
+	}
+
+	r, err := NewRedactorByNames(names...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid property \"%s\": %s", "redact", err)
+	}
+	return r.AddFields(fields...).SetMask(mask), nil
+}
+
+// splitList splits comma separated list, empty items are skipped
+func splitList(str string) []string {
+	var items []string
+	for _, item := range strings.Split(str, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
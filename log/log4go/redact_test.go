@@ -0,0 +1,195 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log4go
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	r, err := NewRedactorByNames("password", "token", "phone", "idcard", "email")
+	if err != nil {
+		t.Fatalf("NewRedactorByNames(): %s", err)
+	}
+
+	cases := map[string]string{
+		"login user=bob password=123456 ok":           "login user=bob password=****** ok",
+		`{"passwd": "s3cret", "name": "bob"}`:         `{"passwd": "******", "name": "bob"}`,
+		"GET /api?access_token=abc.def&x=1":           "GET /api?access_token=******&x=1",
+		"Authorization: Bearer eyJhbGciOi.x-y_z":      "Authorization: Bearer ******",
+		"call 13812345678, 12345678901":               "call 138******5678, 12345678901",
+		"id 11010519491231002X checked":               "id 110105******002X checked",
+		"mail to bob.smith@example.com":               "mail to ******@example.com",
+		"nothing sensitive, version 1.2.3, pwd is ok": "nothing sensitive, version 1.2.3, pwd is ok",
+	}
+	for str, want := range cases {
+		if got := r.RedactString(str); got != want {
+			t.Errorf("RedactString(%q): got %q, want %q", str, got, want)
+		}
+	}
+
+	if _, err := NewRedactorByNames("salary"); err == nil {
+		t.Errorf("unknown pattern should fail")
+	}
+	if err := RegisterRedactPattern("salary", `salary=(?P<secret>\d+`); err == nil {
+		t.Errorf("invalid pattern should fail")
+	}
+	if err := RegisterRedactPattern("salary", `salary=\d+`); err != nil {
+		t.Fatalf("RegisterRedactPattern(): %s", err)
+	}
+	r, _ = NewRedactorByNames("salary")
+	r.SetMask("[hidden]")
+	if got := r.RedactString("bob salary=1000"); got != "bob [hidden]" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestRedactRecord(t *testing.T) {
+	r, _ := NewRedactorByNames("phone")
+	r.AddFields("Card_No")
+
+	rec := &LogRecord{
+		Level:   INFO,
+		Message: "order done",
+		Fields:  Fields("card_no", "6222020200112233", "mobile", int64(13812345678), "err", errors.New("sms to 13812345678 failed"), "n", 13812345678.5),
+	}
+	redacted := r.Redact(rec)
+	if redacted == rec {
+		t.Fatalf("record should be copied")
+	}
+	want := "order done card_no=****** mobile=138******5678 err=\"sms to 138******5678 failed\" n=1.38123456785e+10\n"
+	if got := FormatLogRecord("%M", redacted); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if rec.Fields[0].Value != "6222020200112233" {
+		t.Errorf("original record should not be changed")
+	}
+
+	rec = &LogRecord{Level: INFO, Message: "nothing", Fields: Fields("a", 1)}
+	if r.Redact(rec) != rec {
+		t.Errorf("record should not be copied")
+	}
+}
+
+func TestRedactFilter(t *testing.T) {
+	var raw, redacted []*LogRecord
+	// Filter could be created by unkeyed literal
+	l := Logger{"raw": &Filter{DEBUG, testWriter(func(rec *LogRecord) {
+		raw = append(raw, rec)
+	})}}
+	l.AddFilter("redacted", DEBUG, testWriter(func(rec *LogRecord) {
+		redacted = append(redacted, rec)
+	}))
+	r, _ := NewRedactorByNames("password")
+	if err := l.SetRedactor("redacted", r.AddFields("token")); err != nil {
+		t.Fatalf("SetRedactor(): %s", err)
+	}
+	if err := l.SetRedactor("missing", r); err == nil {
+		t.Errorf("SetRedactor() should fail for unknown filter")
+	}
+
+	l.Info("login with password=%s", "123456")
+	l.InfoKV("refresh", "token", "abc")
+	l.With("user", "bob").Warn("bad pwd=%s", "xyz")
+	// key of field is matched by pattern
+	l.InfoKV("login", "password", "123456", "user", "bob")
+
+	if len(raw) != 4 || len(redacted) != 4 {
+		t.Fatalf("got %d and %d records, want 4", len(raw), len(redacted))
+	}
+	wants := []string{"login with password=******\n", "refresh token=******\n", "bad pwd=****** user=bob\n",
+		"login password=****** user=bob\n"}
+	for i, want := range wants {
+		if got := FormatLogRecord("%M", redacted[i]); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	if got := FormatLogRecord("%M", raw[0]); got != "login with password=123456\n" {
+		t.Errorf("raw filter should not be redacted, got %q", got)
+	}
+
+	filt := l["redacted"]
+	l.Close()
+	if filt.redactor() != nil {
+		t.Errorf("redactor should be removed after closed")
+	}
+}
+
+func TestMergeRedactor(t *testing.T) {
+	l := Logger{
+		"a": &Filter{DEBUG, testWriter(func(rec *LogRecord) {})},
+		"b": &Filter{DEBUG, testWriter(func(rec *LogRecord) {})},
+		"c": &Filter{DEBUG, testWriter(func(rec *LogRecord) {})},
+	}
+	defer l.Close()
+	if l.MergeRedactor() != nil {
+		t.Errorf("MergeRedactor() should be nil without redactor")
+	}
+
+	ra, _ := NewRedactorByNames("password")
+	rb, _ := NewRedactorByNames("password", "token")
+	l.SetRedactor("a", ra.SetMask("***"))
+	l.SetRedactor("b", rb.AddFields("card_no"))
+	r := l.MergeRedactor()
+	if len(r.rules) != 2 {
+		t.Errorf("got %d rules, want 2", len(r.rules))
+	}
+	got := FormatLogRecord("%M", r.Redact(&LogRecord{
+		Message: "pwd=1 token=2",
+		Fields:  []Field{{Key: "card_no", Value: "3"}},
+	}))
+	if want := "pwd=*** token=*** card_no=***\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRedactConfig(t *testing.T) {
+	const config = `<logging>
+  <filter enabled="true">
+    <tag>stdout</tag>
+    <type>console</type>
+    <level>INFO</level>
+    <property name="redact">password, phone</property>
+    <property name="redactfields">card_no</property>
+    <property name="redactmask">***</property>
+  </filter>
+  <filter enabled="true">
+    <tag>plain</tag>
+    <type>console</type>
+    <level>INFO</level>
+  </filter>
+</logging>`
+	cfg, err := ParseConfig([]byte(config), CONFIG_XML)
+	if err != nil {
+		t.Fatalf("ParseConfig(): %s", err)
+	}
+	l, err := cfg.Build()
+	if err != nil {
+		t.Fatalf("Build(): %s", err)
+	}
+	defer l.Close()
+
+	r := l["stdout"].redactor()
+	if r == nil || l["plain"].redactor() != nil {
+		t.Fatalf("redactor should only be set for stdout")
+	}
+	if got := r.RedactString("password=1 13812345678"); got != "password=*** 138***5678" {
+		t.Errorf("got %q", got)
+	}
+	if !r.fields["card_no"] {
+		t.Errorf("field card_no should be redacted")
+	}
+}
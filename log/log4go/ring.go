@@ -0,0 +1,445 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// ring implements lock-free ring buffer of log records, and pool of records
+/*
+Usage (inside a writer):
+    w.ring = newRecordRing(LogBufferLength, name, w.formatRecord)
+
+    // producer side, see LogWrite()
+    w.ring.logWrite(rec)
+
+    // consumer side: records are taken in batch, formatted into one buffer,
+    // and written by one system call
+    batch := make([]*LogRecord, 0, LOG_BATCH_SIZE)
+    for {
+        batch = w.ring.getBatch(batch)
+        for _, rec := range batch {
+            ...
+            rec.release()
+        }
+    }
+
+The ring is a bounded multi-producer multi-consumer queue (see Dmitry Vyukov's
+bounded MPMC queue). Producers never take a lock unless the ring is full (see
+overflow.go for policies when the ring is full). The consumer sleeps on a
+channel only when the ring is empty.
+
+Each writer has its own ring, shared by all goroutines logging to the writer.
+Rings are not shared among writers, so that a slow writer (e.g., remote log
+server) does not block others, and overflow policy applies per writer.
+
+Records are allocated from pool by the Logger. A record is recycled after all
+writers it is dispatched to have released it. If any of the writers does not
+consume records from ring (e.g., FormatLogWriter, or writers defined outside
+log4go, which may keep the record), the record is not recycled.
+*/
+
+package log4go
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/baidu/go-lib/gotrack"
+)
+
+// max number of records written in one batch
+const LOG_BATCH_SIZE = 256
+
+// ringCell is a slot of ring
+type ringCell struct {
+	seq uint64 // sequence of the slot, for synchronizing producers and consumers
+	rec *LogRecord
+}
+
+// recordRing is lock-free ring buffer of log records
+type recordRing struct {
+	_    [8]uint64 // padding, avoid false sharing of head and tail
+	head uint64    // position for next put
+	_    [7]uint64
+	tail uint64 // position for next get
+	_    [7]uint64
+
+	mask  uint64
+	cells []ringCell
+
+	sleeping int32         // 1 if consumer is waiting for records
+	notify   chan struct{} // wake up consumer
+
+	waiters int32         // number of producers waiting for space
+	lock    sync.Mutex    // protect space
+	space   chan struct{} // closed when space is available for waiters
+
+	name   string                          // name of writer
+	format func(*bytes.Buffer, *LogRecord) // format of writer, for spill file
+
+	spillLock sync.Mutex   // protect spill
+	spill     *recordSpill // opened when the first record is spilled
+	spilled   int64        // number of records in spill file
+
+	dropped int64 // number of records dropped
+	written int64 // number of records written
+	bytes   int64 // number of bytes written
+}
+
+// newRecordRing creates ring, capacity of which is the smallest power of 2
+// not less than size.
+//
+// PARAMS:
+//   - size: min capacity of ring
+//   - name: name of writer, for spill file and counters
+//   - format: format of writer, used when record is written to spill file
+func newRecordRing(size int, name string, format func(*bytes.Buffer, *LogRecord)) *recordRing {
+	capacity := 2
+	for capacity < size {
+		capacity <<= 1
+	}
+
+	r := &recordRing{
+		mask:   uint64(capacity - 1),
+		cells:  make([]ringCell, capacity),
+		notify: make(chan struct{}, 1),
+		space:  make(chan struct{}),
+		name:   name,
+		format: format,
+	}
+	for i := range r.cells {
+		r.cells[i].seq = uint64(i)
+	}
+	return r
+}
+
+// Cap returns capacity of ring
+func (r *recordRing) Cap() int {
+	return len(r.cells)
+}
+
+// Len returns number of records in ring, including records in spill file
+func (r *recordRing) Len() int {
+	tail := atomic.LoadUint64(&r.tail)
+	head := atomic.LoadUint64(&r.head)
+	spilled := int(atomic.LoadInt64(&r.spilled))
+	if head <= tail {
+		return spilled
+	}
+	return int(head-tail) + spilled
+}
+
+// tryPut adds rec to ring, returns false if ring is full
+func (r *recordRing) tryPut(rec *LogRecord) bool {
+	pos := atomic.LoadUint64(&r.head)
+	for {
+		cell := &r.cells[pos&r.mask]
+		seq := atomic.LoadUint64(&cell.seq)
+		diff := int64(seq - pos)
+
+		if diff == 0 {
+			if atomic.CompareAndSwapUint64(&r.head, pos, pos+1) {
+				cell.rec = rec
+				atomic.StoreUint64(&cell.seq, pos+1)
+				r.wake()
+				return true
+			}
+		} else if diff < 0 {
+			// slot is not consumed yet
+			return false
+		}
+		pos = atomic.LoadUint64(&r.head)
+	}
+}
+
+// tryGet takes the oldest record from ring, ok is false if ring is empty.
+// Note: nil record is valid (end marker, see LogCloser)
+func (r *recordRing) tryGet() (rec *LogRecord, ok bool) {
+	pos := atomic.LoadUint64(&r.tail)
+	for {
+		cell := &r.cells[pos&r.mask]
+		seq := atomic.LoadUint64(&cell.seq)
+		diff := int64(seq - (pos + 1))
+
+		if diff == 0 {
+			if atomic.CompareAndSwapUint64(&r.tail, pos, pos+1) {
+				rec = cell.rec
+				cell.rec = nil
+				atomic.StoreUint64(&cell.seq, pos+r.mask+1)
+				return rec, true
+			}
+		} else if diff < 0 {
+			// slot is not filled yet
+			return nil, false
+		}
+		pos = atomic.LoadUint64(&r.tail)
+	}
+}
+
+// put adds rec to ring. If ring is full, it waits for space until ctx is done.
+func (r *recordRing) put(ctx context.Context, rec *LogRecord) error {
+	for {
+		if r.tryPut(rec) {
+			return nil
+		}
+
+		atomic.AddInt32(&r.waiters, 1)
+		r.lock.Lock()
+		space := r.space
+		r.lock.Unlock()
+
+		// check again, space may be released before waiters is increased
+		if r.tryPut(rec) {
+			atomic.AddInt32(&r.waiters, -1)
+			return nil
+		}
+
+		select {
+		case <-space:
+			atomic.AddInt32(&r.waiters, -1)
+		case <-ctx.Done():
+			atomic.AddInt32(&r.waiters, -1)
+			return ctx.Err()
+		}
+	}
+}
+
+// wake wakes up the consumer if it is waiting
+func (r *recordRing) wake() {
+	if atomic.LoadInt32(&r.sleeping) == 1 {
+		select {
+		case r.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// interrupt makes the consumer return from getBatch(), even if the ring is
+// empty, so that it could handle other requests (e.g., rotate)
+func (r *recordRing) interrupt() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// releaseSpace wakes up producers waiting for space
+func (r *recordRing) releaseSpace() {
+	if atomic.LoadInt32(&r.waiters) > 0 {
+		r.lock.Lock()
+		close(r.space)
+		r.space = make(chan struct{})
+		r.lock.Unlock()
+	}
+}
+
+// drain appends records in ring to batch, until batch is full
+func (r *recordRing) drain(batch []*LogRecord) []*LogRecord {
+	for len(batch) < cap(batch) {
+		rec, ok := r.tryGet()
+		if !ok {
+			break
+		}
+		batch = append(batch, rec)
+	}
+	return batch
+}
+
+// getBatch takes records from ring, up to cap(batch). Records in spill file
+// are taken after ring is drained. It waits if ring is empty, and may return
+// empty batch if interrupt() is called.
+func (r *recordRing) getBatch(batch []*LogRecord) []*LogRecord {
+	batch = r.spillRead(r.drain(batch[:0]))
+	if len(batch) == 0 {
+		atomic.StoreInt32(&r.sleeping, 1)
+		// check again, record may be added before sleeping is set
+		batch = r.spillRead(r.drain(batch))
+		if len(batch) == 0 {
+			<-r.notify
+		}
+		atomic.StoreInt32(&r.sleeping, 0)
+		batch = r.spillRead(r.drain(batch))
+	}
+
+	if len(batch) > 0 {
+		r.releaseSpace()
+	}
+	return batch
+}
+
+// logWrite adds rec to ring. If ring is full and LogWithBlocking is false,
+// LogOverflowPolicy applies.
+func (r *recordRing) logWrite(rec *LogRecord) {
+	if LogWithBlocking {
+		r.put(context.Background(), rec)
+		return
+	}
+
+	switch LogOverflowPolicy {
+	case OVERFLOW_SPILL:
+		if atomic.LoadInt64(&r.spilled) == 0 && r.tryPut(rec) {
+			return
+		}
+		r.spillWrite(rec)
+		return
+	case OVERFLOW_DROP_OLDEST:
+		if r.tryPut(rec) || r.dropOldest(rec) {
+			return
+		}
+	case OVERFLOW_BLOCK:
+		if r.tryPut(rec) {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), LogBlockTimeout)
+		err := r.put(ctx, rec)
+		cancel()
+		if err == nil {
+			return
+		}
+	default:
+		if r.tryPut(rec) {
+			return
+		}
+	}
+	r.drop(rec)
+}
+
+// putMarker adds marker to ring. In spill mode, marker is written to spill
+// file if records are spilled, so that it is behind them.
+func (r *recordRing) putMarker(ctx context.Context, rec *LogRecord) error {
+	if !LogWithBlocking && LogOverflowPolicy == OVERFLOW_SPILL {
+		r.spillWrite(rec)
+		return nil
+	}
+	return r.put(ctx, rec)
+}
+
+// waitForEnd adds end marker to ring, and waits until EndNotify is called.
+// Spill file is removed after that.
+func (r *recordRing) waitForEnd(lc *LogCloser) {
+	r.putMarker(context.Background(), nil)
+	if lc.IsEnd != nil {
+		<-lc.IsEnd
+		r.closeSpill()
+	}
+}
+
+// waitForFlush adds flush marker to ring, and waits until FlushNotify is
+// called for it or ctx is done
+func (r *recordRing) waitForFlush(ctx context.Context) (int, error) {
+	ack := make(chan flushResult, 1)
+	if err := r.putMarker(ctx, &LogRecord{flushAck: ack}); err != nil {
+		return r.Len(), err
+	}
+
+	select {
+	case res := <-ack:
+		return res.unwritten, res.err
+	case <-ctx.Done():
+		// the marker is not counted
+		unwritten := r.Len() - 1
+		if unwritten < 0 {
+			unwritten = 0
+		}
+		return unwritten, ctx.Err()
+	}
+}
+
+// ringConsumer is implemented by writers consuming records from ring, which
+// release each record after it is written
+type ringConsumer interface {
+	consumeRing()
+}
+
+// pool of log records
+var recordPool = sync.Pool{
+	New: func() interface{} {
+		return new(LogRecord)
+	},
+}
+
+// getRecord gets a record from pool
+func getRecord() *LogRecord {
+	return recordPool.Get().(*LogRecord)
+}
+
+// release drops a reference of rec, and recycles it to pool if it is the
+// last one. It is a no-op for records not from pool.
+func (rec *LogRecord) release() {
+	if rec == nil || atomic.LoadInt32(&rec.refs) == 0 {
+		return
+	}
+	if atomic.AddInt32(&rec.refs, -1) == 0 {
+		*rec = LogRecord{}
+		recordPool.Put(rec)
+	}
+}
+
+// dispatch writes rec to filters accepting it. Filters with redactor get a
+// redacted copy of rec if anything is masked. If all the writers getting rec
+// are ringConsumer, rec is recycled after written by all of them.
+func (log Logger) dispatch(rec *LogRecord, mf moduleFilter) {
+	if LogGoroutineID {
+		rec.Goroutine = gotrack.CurGoroutineID()
+	}
+
+	var targets [8]LogWriter
+	var targetRecs [8]*LogRecord
+	var targetCounts [8]*int64
+	writers := targets[:0]
+	recs := targetRecs[:0]
+	counts := targetCounts[:0]
+	pooled := true
+	refs := int32(0)
+
+	for _, filt := range log {
+		if !mf.accept(rec.Level, filt) {
+			continue
+		}
+		// Shutdown waits for rec, unless it has disabled filt before
+		n := filt.inflight()
+		atomic.AddInt64(n, 1)
+		if !mf.accept(rec.Level, filt) {
+			atomic.AddInt64(n, -1)
+			continue
+		}
+		counts = append(counts, n)
+
+		r := rec
+		if redactor := filt.redactor(); redactor != nil {
+			r = redactor.Redact(rec)
+		}
+		writers = append(writers, filt.LogWriter)
+		recs = append(recs, r)
+
+		// redacted copy is not from pool
+		if r != rec {
+			continue
+		}
+		refs++
+		if _, ok := filt.LogWriter.(ringConsumer); !ok {
+			pooled = false
+		}
+	}
+
+	if len(writers) == 0 {
+		return
+	}
+	if pooled {
+		rec.refs = refs
+	}
+	for i, w := range writers {
+		w.LogWrite(recs[i])
+		atomic.AddInt64(counts[i], -1)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log4go
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecordRing(t *testing.T) {
+	r := newRecordRing(3, "test", nil)
+	if r.Cap() != 4 {
+		t.Fatalf("Cap(): got %d, want 4", r.Cap())
+	}
+
+	recs := make([]*LogRecord, 5)
+	for i := range recs {
+		recs[i] = &LogRecord{Message: string(rune('a' + i))}
+	}
+	for i := 0; i < 4; i++ {
+		if !r.tryPut(recs[i]) {
+			t.Fatalf("tryPut(%d) failed", i)
+		}
+	}
+	if r.tryPut(recs[4]) {
+		t.Errorf("tryPut() should fail when ring is full")
+	}
+	if r.Len() != 4 {
+		t.Errorf("Len(): got %d, want 4", r.Len())
+	}
+
+	// producer waits for space
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := r.put(ctx, recs[4]); err != context.DeadlineExceeded {
+		t.Errorf("put(): got %v, want DeadlineExceeded", err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- r.put(context.Background(), recs[4])
+	}()
+
+	batch := r.getBatch(make([]*LogRecord, 0, 2))
+	if len(batch) != 2 || batch[0] != recs[0] || batch[1] != recs[1] {
+		t.Fatalf("getBatch(): unexpected batch %v", batch)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("put(): %s", err)
+	}
+
+	batch = r.getBatch(make([]*LogRecord, 0, LOG_BATCH_SIZE))
+	if len(batch) != 3 || batch[2] != recs[4] {
+		t.Errorf("getBatch(): unexpected batch %v", batch)
+	}
+}
+
+// test records from concurrent producers are all taken, in order of each producer
+func TestRecordRingConcurrent(t *testing.T) {
+	const producers = 4
+	const count = 10000
+
+	r := newRecordRing(16, "test", nil)
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				r.put(context.Background(), &LogRecord{Level: LevelType(p), Created: time.Unix(int64(i), 0)})
+			}
+		}(p)
+	}
+
+	next := make([]int64, producers)
+	batch := make([]*LogRecord, 0, LOG_BATCH_SIZE)
+	for n := 0; n < producers*count; {
+		batch = r.getBatch(batch)
+		for _, rec := range batch {
+			if got := rec.Created.Unix(); got != next[rec.Level] {
+				t.Fatalf("producer %d: got record %d, want %d", rec.Level, got, next[rec.Level])
+			}
+			next[rec.Level]++
+		}
+		n += len(batch)
+	}
+	wg.Wait()
+}
+
+func TestRecordRelease(t *testing.T) {
+	// record not from pool
+	rec := &LogRecord{Message: "test"}
+	rec.release()
+	if rec.Message != "test" {
+		t.Errorf("record not from pool should not be reset")
+	}
+
+	// record referenced by two writers
+	rec = getRecord()
+	rec.Message = "test"
+	rec.refs = 2
+	rec.release()
+	if rec.Message != "test" {
+		t.Errorf("record should not be reset before all references are released")
+	}
+	rec.release()
+	if rec.Message != "" {
+		t.Errorf("record should be reset after all references are released")
+	}
+}
+
+func TestDispatchPooled(t *testing.T) {
+	r, w := newTestRing()
+	l := make(Logger)
+	l.AddFilter("ring", INFO, w)
+
+	l.Info("pooled")
+	if rec, _ := r.tryGet(); rec == nil || rec.refs != 1 {
+		t.Errorf("record should be from pool, got %+v", rec)
+	}
+
+	// writers not consuming ring may keep records, which are not recycled
+	l.AddFilter("format", INFO, testWriter(func(*LogRecord) {}))
+	l.Info("not pooled")
+	if rec, _ := r.tryGet(); rec == nil || rec.refs != 0 {
+		t.Errorf("record should not be from pool, got %+v", rec)
+	}
+}
+
+// testRingWriter puts records to ring without consuming them
+type testRingWriter struct {
+	ring *recordRing
+}
+
+func newTestRing() (*recordRing, testRingWriter) {
+	r := newRecordRing(16, "test", nil)
+	return r, testRingWriter{ring: r}
+}
+
+func (w testRingWriter) LogWrite(rec *LogRecord) { w.ring.tryPut(rec) }
+func (w testRingWriter) Close()                  {}
+func (w testRingWriter) consumeRing()            {}
+
+// testWriter calls the function for each record
+type testWriter func(*LogRecord)
+
+func (w testWriter) LogWrite(rec *LogRecord) { w(rec) }
+func (w testWriter) Close()                  {}
@@ -0,0 +1,178 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// sample implements rate limiting of repeated log records
+/*
+Usage:
+    // at most 100 records from the same source line per second
+    log4go.SetLogSampling(time.Second, 100, log4go.SAMPLE_BY_SOURCE)
+
+    // disable sampling
+    log4go.SetLogSampling(0, 0, log4go.SAMPLE_BY_SOURCE)
+
+Records are grouped by key, which is the source (func:line) of the record, or
+the format string (also for Warn/Error/Critical, though they format message
+for the returned error). Records beyond the limit are dropped before being
+sent to writers. At the end of each interval, a summary like "suppressed 1234
+similar messages" is logged for each key with dropped records, with the level
+and source of the last dropped record.
+
+If module state is enabled (see SetWithModuleState), the number of dropped
+records is counted in "log_suppressed".
+*/
+package log4go
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	SAMPLE_BY_SOURCE = iota // group records by source (func:line)
+	SAMPLE_BY_FORMAT        // group records by format string
+)
+
+// key of module state for number of suppressed records
+const SAMPLE_STATE_KEY = "log_suppressed"
+
+// sampleCount is the count of records with the same key in an interval
+type sampleCount struct {
+	logged     int       // number of records logged
+	suppressed int       // number of records dropped
+	logger     Logger    // logger of the last dropped record
+	level      LevelType // level of the last dropped record
+	source     string    // source of the last dropped record
+}
+
+// sampler limits records with the same key to burst per interval
+type sampler struct {
+	interval time.Duration
+	burst    int
+	by       int
+
+	lock   sync.Mutex
+	counts map[string]*sampleCount
+
+	stop chan bool
+	done chan bool
+}
+
+var logSampler atomic.Pointer[sampler]
+
+// SetLogSampling limits records with the same key to burst per interval.
+// by is SAMPLE_BY_SOURCE or SAMPLE_BY_FORMAT. Sampling is disabled if
+// interval or burst is not positive.
+//
+// Suppressed records of the previous setting are summarized immediately.
+func SetLogSampling(interval time.Duration, burst int, by int) {
+	var s *sampler
+	if interval > 0 && burst > 0 {
+		s = &sampler{
+			interval: interval,
+			burst:    burst,
+			by:       by,
+			counts:   make(map[string]*sampleCount),
+			stop:     make(chan bool),
+			done:     make(chan bool),
+		}
+		go s.run()
+	}
+
+	if old := logSampler.Swap(s); old != nil {
+		close(old.stop)
+		<-old.done
+	}
+}
+
+// sampleAllow checks whether the record should be logged
+//
+// PARAMS:
+//   - log: logger of the record
+//   - lvl: level of the record
+//   - format: format string of the record
+//   - src: source of the record
+func sampleAllow(log Logger, lvl LevelType, format string, src string) bool {
+	s := logSampler.Load()
+	if s == nil {
+		return true
+	}
+
+	key := src
+	if s.by == SAMPLE_BY_FORMAT {
+		key = format
+	}
+	return s.allow(key, log, lvl, src)
+}
+
+func (s *sampler) allow(key string, log Logger, lvl LevelType, src string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	cnt, ok := s.counts[key]
+	if !ok {
+		cnt = new(sampleCount)
+		s.counts[key] = cnt
+	}
+
+	if cnt.logged < s.burst {
+		cnt.logged++
+		return true
+	}
+
+	cnt.suppressed++
+	cnt.logger = log
+	cnt.level = lvl
+	cnt.source = src
+	return false
+}
+
+func (s *sampler) run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-s.stop:
+			s.flush()
+			close(s.done)
+			return
+		}
+	}
+}
+
+// flush logs summary of suppressed records, and starts a new interval
+func (s *sampler) flush() {
+	s.lock.Lock()
+	counts := s.counts
+	s.counts = make(map[string]*sampleCount)
+	s.lock.Unlock()
+
+	total := 0
+	for _, cnt := range counts {
+		if cnt.suppressed == 0 {
+			continue
+		}
+		total += cnt.suppressed
+		cnt.logger.Log(cnt.level, cnt.source,
+			fmt.Sprintf("suppressed %d similar messages", cnt.suppressed))
+	}
+
+	if total > 0 && WithModuleState {
+		log4goState.Inc(SAMPLE_STATE_KEY, total)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log4go
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLogSampling(t *testing.T) {
+	defer func(buflen int) {
+		LogBufferLength = buflen
+	}(LogBufferLength)
+	LogBufferLength = 0
+
+	defer SetWithModuleState(false)
+	SetWithModuleState(true)
+
+	l := make(Logger)
+	l.AddFilter("file", INFO, NewFileLogWriter(testLogFile, false).SetFormat("[%L] %M"))
+	defer os.Remove(testLogFile)
+
+	SetLogSampling(time.Hour, 2, SAMPLE_BY_FORMAT)
+	for i := 0; i < 10; i++ {
+		l.Info("request %d failed", i)
+		l.Info("request done")
+	}
+	l.Debug("not logged")
+
+	// summary is logged when sampling is reset
+	SetLogSampling(0, 0, SAMPLE_BY_FORMAT)
+	l.Info("request %d failed", 10)
+	l.Close()
+
+	want := "[INFO] request 0 failed\n" +
+		"[INFO] request done\n" +
+		"[INFO] request 1 failed\n" +
+		"[INFO] request done\n"
+	contents, err := ioutil.ReadFile(testLogFile)
+	if err != nil {
+		t.Fatalf("Could not read output log: %s", err)
+	}
+	got := string(contents)
+	if len(got) < len(want) || got[:len(want)] != want {
+		t.Fatalf("got %q, want prefix %q", got, want)
+	}
+
+	// one summary for each format
+	rest := got[len(want):]
+	summary := "[INFO] suppressed 8 similar messages\n"
+	if rest != summary+summary+"[INFO] request 10 failed\n" {
+		t.Errorf("invalid summary: %q", rest)
+	}
+
+	if n := log4goState.GetCounter(SAMPLE_STATE_KEY); n != 16 {
+		t.Errorf("%s is %d, want 16", SAMPLE_STATE_KEY, n)
+	}
+}
+
+// records of Warn/Error/Critical are grouped by format, not by message
+func TestLogSamplingError(t *testing.T) {
+	var got []string
+	l := make(Logger)
+	l.AddFilter("test", INFO, testWriter(func(rec *LogRecord) {
+		got = append(got, rec.Message)
+	}))
+
+	SetLogSampling(time.Hour, 2, SAMPLE_BY_FORMAT)
+	for i := 0; i < 5; i++ {
+		if err := l.Error("connect %s failed: %d", "host", i); err == nil {
+			t.Errorf("Error() should return error")
+		}
+		l.With("id", i).Warn("request %d failed", i)
+	}
+	SetLogSampling(0, 0, SAMPLE_BY_FORMAT)
+	l.Close()
+
+	want := []string{
+		"connect host failed: 0",
+		"request 0 failed",
+		"connect host failed: 1",
+		"request 1 failed",
+		"suppressed 3 similar messages",
+		"suppressed 3 similar messages",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("message %d is %q, want %q", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// slog handler writing records to Logger
+/*
+Usage:
+    // records of slog are written by writers of logger, e.g., TimeFileLogWriter
+    logger := slog.New(l.SlogHandler())
+    logger.Info("request done", "status", 200, slog.Group("req", "id", 12))
+
+    // with FORMAT_DEFAULT, the record is written as:
+    // [2019/01/01 10:00:00] [INFO] (main.handle:42) request done status=200 req.id=12
+
+Levels of slog are mapped to levels of log4go, see LevelFromSlog.
+Attributes are written as fields (see Field), keys in groups are prefixed
+with names of groups, separated by ".". Request id is extracted from
+context of records (see ContextRequestID).
+*/
+
+package log4go
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// SlogHandler is a slog.Handler writing records to Logger
+type SlogHandler struct {
+	logger func() Logger // logger to write, got for each record
+	fields []Field       // fields added by WithAttrs
+	prefix string        // prefix of keys, added by WithGroup
+}
+
+// SlogHandler creates a slog.Handler writing records to the logger
+func (log Logger) SlogHandler() *SlogHandler {
+	return NewSlogHandler(func() Logger {
+		return log
+	})
+}
+
+// NewSlogHandler creates a slog.Handler writing records to logger returned
+// by getLogger, which is invoked for each record. It is used for logger
+// which may be replaced at runtime (e.g., log.Logger after log.Reload).
+func NewSlogHandler(getLogger func() Logger) *SlogHandler {
+	return &SlogHandler{logger: getLogger}
+}
+
+// LevelFromSlog converts level of slog to log4go level
+func LevelFromSlog(level slog.Level) LevelType {
+	switch {
+	case level >= slog.LevelError+4:
+		return CRITICAL
+	case level >= slog.LevelError:
+		return ERROR
+	case level >= slog.LevelWarn:
+		return WARNING
+	case level >= slog.LevelInfo:
+		return INFO
+	case level >= slog.LevelDebug+2:
+		return TRACE
+	case level >= slog.LevelDebug:
+		return DEBUG
+	case level >= slog.LevelDebug-4:
+		return FINE
+	default:
+		return FINEST
+	}
+}
+
+// SlogLevel converts level to level of slog, see LevelFromSlog
+func (l LevelType) SlogLevel() slog.Level {
+	switch {
+	case l >= CRITICAL:
+		return slog.LevelError + 4
+	case l == ERROR:
+		return slog.LevelError
+	case l == WARNING:
+		return slog.LevelWarn
+	case l == INFO:
+		return slog.LevelInfo
+	case l == TRACE:
+		return slog.LevelDebug + 2
+	case l == DEBUG:
+		return slog.LevelDebug
+	case l == FINE:
+		return slog.LevelDebug - 4
+	default:
+		return slog.LevelDebug - 8
+	}
+}
+
+// Enabled checks whether records at level are written by any filter
+func (h *SlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	lvl := LevelFromSlog(level)
+	for _, filt := range h.logger() {
+		if lvl >= filt.level() {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle writes the record to filters accepting it
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	log := h.logger()
+	lvl := LevelFromSlog(r.Level)
+
+	// Determine if any logging will be done
+	accepted := false
+	for _, filt := range log {
+		if lvl >= filt.level() {
+			accepted = true
+			break
+		}
+	}
+	if !accepted {
+		return nil
+	}
+
+	// Drop repeated records, see SetLogSampling
+	c := callerForPC(r.PC)
+	if !sampleAllow(log, lvl, r.Message, c.Source()) {
+		return nil
+	}
+
+	fields := h.fields
+	if r.NumAttrs() > 0 {
+		fields = make([]Field, len(h.fields), len(h.fields)+r.NumAttrs())
+		copy(fields, h.fields)
+		r.Attrs(func(attr slog.Attr) bool {
+			fields = appendAttr(fields, h.prefix, attr)
+			return true
+		})
+	}
+
+	created := r.Time
+	if created.IsZero() {
+		created = time.Now()
+	}
+
+	// Make the log record
+	rec := getRecord()
+	rec.Level = lvl
+	rec.Created = created
+	rec.Source = c.Source()
+	rec.Caller = c
+	rec.Message = r.Message
+	rec.Fields = fields
+	if ctx != nil {
+		rec.RequestID = ContextRequestID(ctx)
+	}
+
+	// Dispatch the logs
+	log.dispatch(rec, moduleFilter{})
+	return nil
+}
+
+// WithAttrs returns a handler adding attrs to each record
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make([]Field, len(h.fields), len(h.fields)+len(attrs))
+	copy(fields, h.fields)
+	for _, attr := range attrs {
+		fields = appendAttr(fields, h.prefix, attr)
+	}
+	return &SlogHandler{logger: h.logger, fields: fields, prefix: h.prefix}
+}
+
+// WithGroup returns a handler adding name as prefix of keys
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &SlogHandler{logger: h.logger, fields: h.fields, prefix: h.prefix + name + "."}
+}
+
+// appendAttr converts attr to fields, and appends them to fields
+func appendAttr(fields []Field, prefix string, attr slog.Attr) []Field {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		// empty attr is ignored
+		return fields
+	}
+
+	if attr.Value.Kind() != slog.KindGroup {
+		return append(fields, Field{Key: prefix + attr.Key, Value: attr.Value.Any()})
+	}
+
+	// attrs of group without name are inlined
+	if attr.Key != "" {
+		prefix = prefix + attr.Key + "."
+	}
+	for _, a := range attr.Value.Group() {
+		fields = appendAttr(fields, prefix, a)
+	}
+	return fields
+}
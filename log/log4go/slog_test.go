@@ -0,0 +1,83 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log4go
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogHandler(t *testing.T) {
+	var recs []*LogRecord
+	l := make(Logger)
+	l.AddFilter("test", TRACE, testWriter(func(rec *LogRecord) {
+		recs = append(recs, rec)
+	}))
+
+	logger := slog.New(l.SlogHandler())
+	if logger.Enabled(context.Background(), slog.LevelDebug) {
+		t.Errorf("debug should not be enabled")
+	}
+
+	file, line := currentLine()
+	logger.Info("request done", "status", 200, slog.Group("req", "id", 12))
+	logger.Debug("skipped")
+	ctx := ContextWithRequestID(context.Background(), "req-1")
+	logger.With("conn", 3).WithGroup("rpc").With("peer", "a").ErrorContext(ctx, "failed",
+		"code", 5, slog.Group("", "inline", true), slog.Group("empty"))
+	logger.Log(ctx, slog.LevelDebug+2, "trace")
+
+	if len(recs) != 3 {
+		t.Fatalf("got %d records, want 3", len(recs))
+	}
+	if rec := recs[0]; rec.Level != INFO || rec.Message != "request done" ||
+		rec.Caller == nil || rec.Caller.File != file || rec.Caller.Line != line+1 ||
+		!strings.HasSuffix(rec.Caller.Function, ".TestSlogHandler") {
+		t.Errorf("unexpected record %+v", rec)
+	}
+	if got := FormatLogRecord("%M", recs[0]); got != "request done status=200 req.id=12\n" {
+		t.Errorf("got %q", got)
+	}
+	if got := FormatLogRecord("%L %R %M", recs[1]); got != "EROR req-1 failed conn=3 rpc.peer=a rpc.code=5 rpc.inline=true\n" {
+		t.Errorf("got %q", got)
+	}
+	if recs[2].Level != TRACE {
+		t.Errorf("got level %s, want TRACE", recs[2].Level)
+	}
+}
+
+func TestSlogLevel(t *testing.T) {
+	for lvl := FINEST; lvl <= CRITICAL; lvl++ {
+		if got := LevelFromSlog(lvl.SlogLevel()); got != lvl {
+			t.Errorf("got %s, want %s", got, lvl)
+		}
+	}
+	levels := map[slog.Level]LevelType{
+		slog.LevelDebug - 1: FINE,
+		slog.LevelDebug:     DEBUG,
+		slog.LevelInfo - 1:  TRACE,
+		slog.LevelInfo + 1:  INFO,
+		slog.LevelWarn:      WARNING,
+		slog.LevelError:     ERROR,
+		slog.LevelError + 8: CRITICAL,
+	}
+	for level, want := range levels {
+		if got := LevelFromSlog(level); got != want {
+			t.Errorf("%s: got %s, want %s", level, got, want)
+		}
+	}
+}
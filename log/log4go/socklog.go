@@ -17,6 +17,7 @@
 package log4go
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -28,16 +29,21 @@ type SocketLogWriter chan *LogRecord
 
 // This is the SocketLogWriter's output method
 func (w SocketLogWriter) LogWrite(rec *LogRecord) {
-    if !LogWithBlocking {
-        if len(w) >= LogBufferLength {            
-            return
-        }
-    }
-    
-	w <- rec
+	chanLogWrite(w, rec)
+}
+
+// Stat gets counters of writer, they are zero after Close
+func (w SocketLogWriter) Stat() WriterStat {
+	return getChanCounter(w).stat()
+}
+
+// Flush sends records buffered before
+func (w SocketLogWriter) Flush(ctx context.Context) (int, error) {
+	return waitForFlush(ctx, w)
 }
 
 func (w SocketLogWriter) Close() {
+	chanCounters.Delete(chan *LogRecord(w))
 	close(w)
 }
 
@@ -49,6 +55,7 @@ func NewSocketLogWriter(proto, hostport string) SocketLogWriter {
 	}
 
 	w := SocketLogWriter(make(chan *LogRecord, LogBufferLength))
+	counter := newChanCounter(w)
 
 	go func() {
 		defer func() {
@@ -58,18 +65,25 @@ func NewSocketLogWriter(proto, hostport string) SocketLogWriter {
 		}()
 
 		for rec := range w {
+			if flushNotify(rec, nil) {
+				continue
+			}
+
 			// Marshall into JSON
 			js, err := json.Marshal(rec)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "SocketLogWriter(%q): %s", hostport, err)
+				counter.countDropped(1)
 				return
 			}
 
 			_, err = sock.Write(js)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "SocketLogWriter(%q): %s", hostport, err)
+				counter.countDropped(1)
 				return
 			}
+			counter.countWritten(1, len(js))
 		}
 	}()
 
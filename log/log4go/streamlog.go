@@ -0,0 +1,568 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// streamlog is stream-oriented log writer, for remote log server over tcp or tls
+/*
+Usage:
+    w := log4go.NewStreamWriter("access", "tls", "logsvr.example.com:6514", log4go.LogFormat)
+    w.SetFraming(log4go.FRAME_LENGTH).SetSpillFile("./log/access.spill", 1<<30)
+    logger.AddFilter("remote", log4go.INFO, w)
+
+The connection is established in background, and re-established with
+exponential backoff after failure. Records are buffered in memory while
+disconnected. If the memory buffer is full, records are appended to the
+spill file (if set), or dropped. Buffered records are sent in order after
+reconnection.
+
+Each record is framed by:
+- FRAME_NEWLINE: record ends with "\n" (the default)
+- FRAME_LENGTH: 4-byte length in big endian, followed by the record
+*/
+
+package log4go
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	FRAME_NEWLINE = iota // record ends with newline
+	FRAME_LENGTH         // record is prefixed with 4-byte length in big endian
+)
+
+const (
+	STREAM_BUFFER_SIZE   = 4 * 1024 * 1024 // default size of memory buffer, in bytes
+	STREAM_MIN_BACKOFF   = 100 * time.Millisecond
+	STREAM_MAX_BACKOFF   = 30 * time.Second
+	STREAM_DIAL_TIMEOUT  = 5 * time.Second
+	STREAM_WRITE_TIMEOUT = 5 * time.Second
+	STREAM_SPILL_SIZE    = 1 << 30 // default max size of spill file, in bytes
+)
+
+var (
+	ErrStreamNetwork = errors.New("network in following list:  tcp, tcp4, tcp6, tls")
+)
+
+// StreamWriter sends output to a stream connection (tcp or tls)
+type StreamWriter struct {
+	LogCloser //for Elegant exit
+
+	ring    *recordRing
+	name    string
+	network string
+	addr    string
+	format  string
+
+	// config, protected by lock
+	lock       sync.Mutex
+	framing    int
+	tlsConfig  *tls.Config
+	bufferSize int
+	spillName  string
+	spillSize  int64
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	// state, only accessed by the writing goroutine
+	conn      net.Conn
+	backoff   time.Duration
+	nextDial  time.Time
+	pending   [][]byte // framed records in memory
+	pendBytes int      // total size of pending
+	spill     *os.File // spill file, frames are prefixed with length
+	spillOff  int64    // offset of the first unsent frame in spill file
+	spillEnd  int64    // size of spill file
+	spillErr  error    // error in opening spill file
+	dropped   int64    // number of dropped records since last report
+}
+
+// NewStreamWriter creates stream writer
+//
+// PARAMS:
+//   - name: name of writer
+//   - network: "tcp", "tcp4", "tcp6" or "tls"
+//   - remoteAddr: address of log server, e.g., "127.0.0.1:514"
+//   - format: format of record, see FormatLogRecord
+func NewStreamWriter(name string, network string,
+	remoteAddr string, format string) *StreamWriter {
+	network = strings.ToLower(network)
+	switch network {
+	case "tcp", "tcp4", "tcp6", "tls":
+	default:
+		fmt.Fprintf(os.Stderr, "NewStreamWriter(%s, %s): %s\n",
+			name, remoteAddr, ErrStreamNetwork)
+		return nil
+	}
+
+	w := &StreamWriter{
+		name:       name,
+		network:    network,
+		addr:       remoteAddr,
+		format:     format,
+		framing:    FRAME_NEWLINE,
+		bufferSize: STREAM_BUFFER_SIZE,
+		minBackoff: STREAM_MIN_BACKOFF,
+		maxBackoff: STREAM_MAX_BACKOFF,
+	}
+
+	w.ring = newRecordRing(LogBufferLength, name, w.formatRecord)
+
+	//init LogCloser
+	w.LogCloserInit()
+
+	// add w to collection of all writers' info
+	registerWriter(w)
+
+	go w.run()
+
+	return w
+}
+
+// SetFraming sets framing of records, FRAME_NEWLINE or FRAME_LENGTH
+// This should be invoked before write any record
+func (w *StreamWriter) SetFraming(framing int) *StreamWriter {
+	w.lock.Lock()
+	w.framing = framing
+	w.lock.Unlock()
+	return w
+}
+
+// SetTLSConfig sets config for tls connection
+func (w *StreamWriter) SetTLSConfig(config *tls.Config) *StreamWriter {
+	w.lock.Lock()
+	w.tlsConfig = config
+	w.lock.Unlock()
+	return w
+}
+
+// SetBufferSize sets max size (in bytes) of records buffered in memory
+// while disconnected
+func (w *StreamWriter) SetBufferSize(size int) *StreamWriter {
+	w.lock.Lock()
+	w.bufferSize = size
+	w.lock.Unlock()
+	return w
+}
+
+// SetSpillFile sets file for records which overflow the memory buffer.
+// Records are dropped if size of the file exceeds maxSize, STREAM_SPILL_SIZE
+// is used if maxSize <= 0.
+// This should be invoked before write any record
+func (w *StreamWriter) SetSpillFile(filename string, maxSize int64) *StreamWriter {
+	if maxSize <= 0 {
+		maxSize = STREAM_SPILL_SIZE
+	}
+	w.lock.Lock()
+	w.spillName = filename
+	w.spillSize = maxSize
+	w.lock.Unlock()
+	return w
+}
+
+// SetBackoff sets min and max interval between reconnections
+func (w *StreamWriter) SetBackoff(min, max time.Duration) *StreamWriter {
+	w.lock.Lock()
+	w.minBackoff = min
+	w.maxBackoff = max
+	w.lock.Unlock()
+	return w
+}
+
+func (w *StreamWriter) LogWrite(rec *LogRecord) {
+	w.ring.logWrite(rec)
+}
+
+// StreamWriter consumes records from ring
+func (w *StreamWriter) consumeRing() {}
+
+// Name gets writer name
+func (w *StreamWriter) Name() string {
+	return w.name
+}
+
+// QueueLen gets number of records in ring
+func (w *StreamWriter) QueueLen() int {
+	return w.ring.Len()
+}
+
+// Stat gets counters of writer. Records are counted as written when they
+// are sent, and as dropped if they could not be buffered or spilled, or are
+// discarded by Close.
+func (w *StreamWriter) Stat() WriterStat {
+	return w.ring.stat()
+}
+
+// Flush sends records buffered before. Records which could not be sent
+// (e.g., the server is down) are kept in memory, and counted as unwritten.
+// The spill file is synced.
+func (w *StreamWriter) Flush(ctx context.Context) (int, error) {
+	return w.ring.waitForFlush(ctx)
+}
+
+func (w *StreamWriter) sync() (int, error) {
+	w.send()
+
+	var err error
+	if w.spill != nil {
+		err = w.spill.Sync()
+	}
+	return len(w.pending), err
+}
+
+// Close waits for dump all log
+//
+// Records still buffered (e.g., the server is down) are discarded, except
+// those in the spill file.
+func (w *StreamWriter) Close() {
+	w.ring.waitForEnd(&w.LogCloser)
+	unregisterWriter(w)
+}
+
+// run takes records from ring in batch, and buffers them as frames, which
+// are sent if connected
+func (w *StreamWriter) run() {
+	w.lock.Lock()
+	retry := w.minBackoff
+	w.lock.Unlock()
+
+	// wake up periodically to reconnect, even if no record is written
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		ticker := time.NewTicker(retry)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.ring.interrupt()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var buf batchBuffer
+	batch := make([]*LogRecord, 0, LOG_BATCH_SIZE)
+
+	for {
+		batch = w.ring.getBatch(batch)
+
+		for _, rec := range batch {
+			if rec == nil {
+				w.send()
+				w.shutdown()
+				w.EndNotify(rec)
+				return
+			}
+			if w.FlushNotify(rec, w.sync) {
+				continue
+			}
+
+			w.ring.formatRecord(&buf, rec)
+			w.enqueue(append([]byte(nil), buf.Bytes()...))
+			buf.Reset()
+			rec.release()
+		}
+
+		w.send()
+	}
+}
+
+// formatRecord formats rec into frame in out. Binary may be shared by other
+// writers, it is not recycled here.
+func (w *StreamWriter) formatRecord(out *bytes.Buffer, rec *LogRecord) {
+	w.lock.Lock()
+	framing := w.framing
+	w.lock.Unlock()
+
+	start := out.Len()
+	if framing == FRAME_LENGTH {
+		// length is filled after the record is formatted
+		out.Write([]byte{0, 0, 0, 0})
+	}
+
+	if rec.Binary != nil {
+		out.Write(rec.Binary)
+	} else {
+		writeLogRecord(out, w.format, rec)
+	}
+
+	frame := out.Bytes()[start:]
+	if framing == FRAME_LENGTH {
+		binary.BigEndian.PutUint32(frame, uint32(len(frame)-4))
+	} else if len(frame) == 0 || frame[len(frame)-1] != '\n' {
+		out.WriteByte('\n')
+	}
+}
+
+// enqueue adds frame to memory buffer or spill file
+func (w *StreamWriter) enqueue(frame []byte) {
+	w.lock.Lock()
+	bufferSize := w.bufferSize
+	w.lock.Unlock()
+
+	// frames left in spill file by the previous process are older
+	w.openSpill()
+
+	// keep order: once spilled, following frames go to spill file
+	if w.spillOff == w.spillEnd && w.pendBytes+len(frame) <= bufferSize {
+		w.pending = append(w.pending, frame)
+		w.pendBytes += len(frame)
+		return
+	}
+
+	if err := w.spillWrite(frame); err != nil {
+		w.dropped++
+		w.ring.countDropped(1)
+	}
+}
+
+// spillWrite appends frame to spill file
+func (w *StreamWriter) spillWrite(frame []byte) error {
+	w.lock.Lock()
+	name, maxSize := w.spillName, w.spillSize
+	w.lock.Unlock()
+
+	if len(name) == 0 {
+		return errors.New("no spill file")
+	}
+	if w.spillEnd+4+int64(len(frame)) > maxSize {
+		return errors.New("spill file is full")
+	}
+
+	if w.spill == nil {
+		if err := w.openSpill(); err != nil {
+			return err
+		}
+	}
+
+	var hdr [4]byte
+	binary.BigEndian.PutUint32(hdr[:], uint32(len(frame)))
+	if _, err := w.spill.WriteAt(hdr[:], w.spillEnd); err != nil {
+		return err
+	}
+	if _, err := w.spill.WriteAt(frame, w.spillEnd+4); err != nil {
+		return err
+	}
+	w.spillEnd += 4 + int64(len(frame))
+	return nil
+}
+
+// openSpill opens spill file if it is set and not opened yet. Frames left by
+// the previous process are kept; as the file is opened before any record is
+// buffered, new records are appended to the file after them, and sent later.
+func (w *StreamWriter) openSpill() error {
+	if w.spill != nil || w.spillErr != nil {
+		return w.spillErr
+	}
+	w.lock.Lock()
+	name := w.spillName
+	w.lock.Unlock()
+	if len(name) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "StreamWriter(%s): %s\n", w.name, err)
+		w.spillErr = err
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		fmt.Fprintf(os.Stderr, "StreamWriter(%s): %s\n", w.name, err)
+		w.spillErr = err
+		return err
+	}
+
+	// partial frame at the end (e.g., written before crash) is discarded
+	size := spillValidSize(f, fi.Size())
+	if size < fi.Size() {
+		fmt.Fprintf(os.Stderr, "StreamWriter(%s): spill file is corrupted, %d bytes discarded\n",
+			w.name, fi.Size()-size)
+		f.Truncate(size)
+	}
+
+	w.spill = f
+	w.spillOff, w.spillEnd = 0, size
+	return nil
+}
+
+// spillValidSize returns size of complete frames at the beginning of spill file
+func spillValidSize(f *os.File, size int64) int64 {
+	var hdr [4]byte
+	var off int64
+	for off+4 <= size {
+		if _, err := f.ReadAt(hdr[:], off); err != nil {
+			break
+		}
+		next := off + 4 + int64(binary.BigEndian.Uint32(hdr[:]))
+		if next > size {
+			break
+		}
+		off = next
+	}
+	return off
+}
+
+// send sends buffered frames, if connected (or reconnected)
+func (w *StreamWriter) send() {
+	w.openSpill()
+
+	if len(w.pending) == 0 && w.spillOff == w.spillEnd {
+		return
+	}
+	if !w.connect() {
+		return
+	}
+
+	// frames in memory are older than those in spill file, since frames are
+	// buffered in memory only if spill file is empty
+	for len(w.pending) > 0 {
+		frame := w.pending[0]
+		if err := w.write(frame); err != nil {
+			return
+		}
+		w.pending[0] = nil
+		w.pending = w.pending[1:]
+		w.pendBytes -= len(frame)
+	}
+	w.pending = nil
+
+	if w.spill != nil {
+		w.sendSpill()
+	}
+}
+
+// sendSpill sends frames in spill file
+func (w *StreamWriter) sendSpill() {
+	r := bufio.NewReader(io.NewSectionReader(w.spill, w.spillOff, w.spillEnd-w.spillOff))
+	var hdr [4]byte
+	for w.spillOff < w.spillEnd {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			break
+		}
+		// length beyond the file is corrupted, e.g., by partial write
+		size := int64(binary.BigEndian.Uint32(hdr[:]))
+		if size > w.spillEnd-w.spillOff-4 {
+			fmt.Fprintf(os.Stderr, "StreamWriter(%s): spill file is corrupted, %d bytes discarded\n",
+				w.name, w.spillEnd-w.spillOff)
+			break
+		}
+		frame := make([]byte, size)
+		if _, err := io.ReadFull(r, frame); err != nil {
+			break
+		}
+		if err := w.write(frame); err != nil {
+			return
+		}
+		w.spillOff += 4 + int64(len(frame))
+	}
+
+	// all sent (or spill file is broken), start over
+	w.spill.Truncate(0)
+	w.spillOff, w.spillEnd = 0, 0
+}
+
+// write writes frame to connection, the connection is closed if failed
+func (w *StreamWriter) write(frame []byte) error {
+	w.conn.SetWriteDeadline(time.Now().Add(STREAM_WRITE_TIMEOUT))
+	if _, err := w.conn.Write(frame); err != nil {
+		fmt.Fprintf(os.Stderr, "StreamWriter(%s, %s): %s\n", w.name, w.addr, err)
+		w.conn.Close()
+		w.conn = nil
+		return err
+	}
+	w.ring.countWritten(1, len(frame))
+	return nil
+}
+
+// connect connects to log server, with backoff after failure
+func (w *StreamWriter) connect() bool {
+	if w.conn != nil {
+		return true
+	}
+
+	now := time.Now()
+	if now.Before(w.nextDial) {
+		return false
+	}
+
+	w.lock.Lock()
+	tlsConfig := w.tlsConfig
+	minBackoff, maxBackoff := w.minBackoff, w.maxBackoff
+	w.lock.Unlock()
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: STREAM_DIAL_TIMEOUT}
+	if w.network == "tls" {
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", w.addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial(w.network, w.addr)
+	}
+
+	if err != nil {
+		if w.backoff < minBackoff {
+			w.backoff = minBackoff
+		} else if w.backoff *= 2; w.backoff > maxBackoff {
+			w.backoff = maxBackoff
+		}
+		w.nextDial = now.Add(w.backoff)
+		fmt.Fprintf(os.Stderr, "StreamWriter(%s, %s): %s, retry in %s\n",
+			w.name, w.addr, err, w.backoff)
+		return false
+	}
+
+	w.conn = conn
+	w.backoff = 0
+	if w.dropped > 0 {
+		fmt.Fprintf(os.Stderr, "StreamWriter(%s, %s): %d records dropped while disconnected\n",
+			w.name, w.addr, w.dropped)
+		w.dropped = 0
+	}
+	return true
+}
+
+// shutdown closes connection and spill file, records in memory are dropped
+func (w *StreamWriter) shutdown() {
+	w.ring.countDropped(len(w.pending))
+	w.pending = nil
+
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+	if w.spill != nil {
+		w.spill.Close()
+		w.spill = nil
+	}
+}
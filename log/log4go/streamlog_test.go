@@ -0,0 +1,202 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log4go
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readFrames reads n length-prefixed frames from conn
+func readFrames(t *testing.T, conn net.Conn, n int) []string {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+
+	var frames []string
+	var hdr [4]byte
+	for i := 0; i < n; i++ {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			t.Fatalf("read header of frame %d: %s", i, err)
+		}
+		data := make([]byte, binary.BigEndian.Uint32(hdr[:]))
+		if _, err := io.ReadFull(r, data); err != nil {
+			t.Fatalf("read frame %d: %s", i, err)
+		}
+		frames = append(frames, string(data))
+	}
+	return frames
+}
+
+func TestStreamWriter(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen(): %s", err)
+	}
+	defer ln.Close()
+
+	w := NewStreamWriter("test", "tcp", ln.Addr().String(), "[%L] %M")
+	w.SetFraming(FRAME_LENGTH)
+
+	l := make(Logger)
+	l.AddFilter("stream", INFO, w)
+	l.Info("first")
+	l.Warn("second")
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Accept(): %s", err)
+	}
+	defer conn.Close()
+
+	frames := readFrames(t, conn, 2)
+	if err := l.Flush(context.Background()); err != nil {
+		t.Errorf("Flush(): %s", err)
+	}
+	stat := w.Stat()
+	l.Close()
+
+	if frames[0] != "[INFO] first\n" || frames[1] != "[WARN] second\n" {
+		t.Errorf("unexpected frames: %q", frames)
+	}
+	if stat.Written != 2 || stat.Bytes != 4+13+4+14 || stat.Dropped != 0 {
+		t.Errorf("unexpected stat %+v", stat)
+	}
+}
+
+// test records which could not be sent are counted as dropped
+func TestStreamWriterDropped(t *testing.T) {
+	// get a free port, and keep it closed
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen(): %s", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	w := NewStreamWriter("test", "tcp", addr, "%M")
+	w.SetBufferSize(20)
+
+	l := make(Logger)
+	l.AddFilter("stream", INFO, w)
+	for i := 0; i < 5; i++ {
+		l.Info("record-%d", i)
+	}
+	l.Close()
+
+	// 2 records in memory are discarded by Close, the others overflow
+	if stat := w.Stat(); stat.Dropped != 5 || stat.Written != 0 {
+		t.Errorf("unexpected stat %+v", stat)
+	}
+}
+
+// test records are buffered and spilled while disconnected
+func TestStreamWriterReconnect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stream")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// get a free port, and keep it closed for a while
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen(): %s", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	w := NewStreamWriter("test", "tcp", addr, "%M")
+	w.SetFraming(FRAME_LENGTH).SetBackoff(10*time.Millisecond, 50*time.Millisecond)
+	w.SetBufferSize(40).SetSpillFile(filepath.Join(dir, "test.spill"), 1<<20)
+
+	l := make(Logger)
+	l.AddFilter("stream", INFO, w)
+	defer l.Close()
+
+	want := []string{"record-0\n", "record-1\n", "record-2\n", "record-3\n", "record-4\n", "record-5\n"}
+	for i := range want {
+		l.Info("record-%d", i)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("net.Listen(%s): %s", addr, err)
+	}
+	defer ln.Close()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Accept(): %s", err)
+	}
+	defer conn.Close()
+
+	frames := readFrames(t, conn, len(want))
+	for i := range want {
+		if frames[i] != want[i] {
+			t.Errorf("frame %d: got %q, want %q", i, frames[i], want[i])
+		}
+	}
+}
+
+// test frames left in spill file are sent before new ones
+func TestStreamWriterSpillLeft(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stream")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a frame left by the previous process, and a partial frame with
+	// length beyond the file; frames in file are prefixed with length
+	spill := filepath.Join(dir, "test.spill")
+	left := []byte{0, 0, 0, 8, 0, 0, 0, 4, 'o', 'l', 'd', '\n', 0xff, 0xff, 0xff, 0xff, 'x'}
+	if err := ioutil.WriteFile(spill, left, 0644); err != nil {
+		t.Fatalf("WriteFile(): %s", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen(): %s", err)
+	}
+	defer ln.Close()
+
+	w := NewStreamWriter("test", "tcp", ln.Addr().String(), "%M")
+	w.SetFraming(FRAME_LENGTH).SetSpillFile(spill, 0)
+
+	l := make(Logger)
+	l.AddFilter("stream", INFO, w)
+	defer l.Close()
+	l.Info("new")
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Accept(): %s", err)
+	}
+	defer conn.Close()
+
+	frames := readFrames(t, conn, 2)
+	if frames[0] != "old\n" || frames[1] != "new\n" {
+		t.Errorf("unexpected frames: %q", frames)
+	}
+}
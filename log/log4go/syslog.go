@@ -0,0 +1,385 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// syslog is log writer for syslog daemon (e.g., rsyslog)
+/*
+Usage:
+    // local syslog daemon
+    w := log4go.NewSyslogWriter("syslog", "unixgram", "/dev/log",
+        log4go.SYSLOG_RFC3164, log4go.FACILITY_LOCAL0, "myprog")
+
+    // remote syslog server
+    w := log4go.NewSyslogWriter("syslog", "tcp", "10.0.0.1:514",
+        log4go.SYSLOG_RFC5424, log4go.FACILITY_LOCAL0, "myprog")
+
+Messages are sent over packet connection (udp, unixgram), or tcp connection.
+Over tcp, RFC 5424 messages are framed by octet counting, RFC 3164
+messages are terminated by newline (see RFC 6587). Newlines within RFC 3164
+messages (e.g., stack traces) are escaped as "#012" over tcp, like rsyslog.
+
+Log levels are mapped to syslog severities:
+    FINEST, FINE, DEBUG, TRACE: debug
+    INFO: info
+    WARNING: warning
+    ERROR: err
+    CRITICAL: crit
+*/
+
+package log4go
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SYSLOG_RFC3164 = iota // BSD syslog protocol
+	SYSLOG_RFC5424        // the syslog protocol
+)
+
+// syslog facilities
+const (
+	FACILITY_KERN = iota
+	FACILITY_USER
+	FACILITY_MAIL
+	FACILITY_DAEMON
+	FACILITY_AUTH
+	FACILITY_SYSLOG
+	FACILITY_LPR
+	FACILITY_NEWS
+	FACILITY_UUCP
+	FACILITY_CRON
+	FACILITY_AUTHPRIV
+	FACILITY_FTP
+	_
+	_
+	_
+	_
+	FACILITY_LOCAL0
+	FACILITY_LOCAL1
+	FACILITY_LOCAL2
+	FACILITY_LOCAL3
+	FACILITY_LOCAL4
+	FACILITY_LOCAL5
+	FACILITY_LOCAL6
+	FACILITY_LOCAL7
+)
+
+// syslog severities
+const (
+	SEVERITY_EMERG = iota
+	SEVERITY_ALERT
+	SEVERITY_CRIT
+	SEVERITY_ERR
+	SEVERITY_WARNING
+	SEVERITY_NOTICE
+	SEVERITY_INFO
+	SEVERITY_DEBUG
+)
+
+// default format of syslog message
+const FORMAT_SYSLOG = "(%S) %M"
+
+var (
+	ErrSyslogNetwork = errors.New("network in following list:  udp, udp4, udp6, unixgram, tcp, tcp4, tcp6")
+)
+
+// severities of log levels
+var levelSeverities = [...]int{
+	FINEST:   SEVERITY_DEBUG,
+	FINE:     SEVERITY_DEBUG,
+	DEBUG:    SEVERITY_DEBUG,
+	TRACE:    SEVERITY_DEBUG,
+	INFO:     SEVERITY_INFO,
+	WARNING:  SEVERITY_WARNING,
+	ERROR:    SEVERITY_ERR,
+	CRITICAL: SEVERITY_CRIT,
+}
+
+// facility names used in config
+var facilityNames = map[string]int{
+	"kern":     FACILITY_KERN,
+	"user":     FACILITY_USER,
+	"mail":     FACILITY_MAIL,
+	"daemon":   FACILITY_DAEMON,
+	"auth":     FACILITY_AUTH,
+	"syslog":   FACILITY_SYSLOG,
+	"lpr":      FACILITY_LPR,
+	"news":     FACILITY_NEWS,
+	"uucp":     FACILITY_UUCP,
+	"cron":     FACILITY_CRON,
+	"authpriv": FACILITY_AUTHPRIV,
+	"ftp":      FACILITY_FTP,
+	"local0":   FACILITY_LOCAL0,
+	"local1":   FACILITY_LOCAL1,
+	"local2":   FACILITY_LOCAL2,
+	"local3":   FACILITY_LOCAL3,
+	"local4":   FACILITY_LOCAL4,
+	"local5":   FACILITY_LOCAL5,
+	"local6":   FACILITY_LOCAL6,
+	"local7":   FACILITY_LOCAL7,
+}
+
+// ParseFacility converts facility name (e.g., "local0") to facility
+func ParseFacility(name string) (int, error) {
+	facility, ok := facilityNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown syslog facility: %s", name)
+	}
+	return facility, nil
+}
+
+// SyslogWriter sends output to syslog daemon
+type SyslogWriter struct {
+	LogCloser //for Elegant exit
+
+	ring     *recordRing
+	name     string
+	network  string
+	addr     string
+	rfc      int
+	facility int
+	tag      string
+	hostname string
+	pid      string
+	format   string
+
+	pconn *PacketConn // for packet-oriented network
+	conn  net.Conn    // for tcp
+}
+
+// NewSyslogWriter creates syslog writer
+//
+// PARAMS:
+//   - name: name of writer
+//   - network: "udp", "unixgram" or "tcp"
+//   - remoteAddr: address of syslog daemon, e.g., "/dev/log", "127.0.0.1:514"
+//   - rfc: SYSLOG_RFC3164 or SYSLOG_RFC5424
+//   - facility: syslog facility, e.g., FACILITY_LOCAL0
+//   - tag: tag (APP-NAME) of message; if empty, program name is used
+func NewSyslogWriter(name string, network string, remoteAddr string,
+	rfc int, facility int, tag string) *SyslogWriter {
+	if len(tag) == 0 {
+		tag = filepath.Base(os.Args[0])
+	}
+	hostname, _ := os.Hostname()
+	if len(hostname) == 0 {
+		hostname = "-"
+	}
+
+	w := &SyslogWriter{
+		name:     name,
+		network:  strings.ToLower(network),
+		addr:     remoteAddr,
+		rfc:      rfc,
+		facility: facility,
+		tag:      tag,
+		hostname: hostname,
+		pid:      strconv.Itoa(os.Getpid()),
+		format:   FORMAT_SYSLOG,
+	}
+
+	var err error
+	switch w.network {
+	case "udp", "udp4", "udp6", "unixgram":
+		w.pconn, err = newPacketConn(w.network, remoteAddr)
+	case "tcp", "tcp4", "tcp6":
+		w.conn, err = net.DialTimeout(w.network, remoteAddr, STREAM_DIAL_TIMEOUT)
+	default:
+		err = ErrSyslogNetwork
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "NewSyslogWriter(%s, %s): %s\n", name, remoteAddr, err)
+		return nil
+	}
+
+	w.ring = newRecordRing(LogBufferLength, name, w.formatRecord)
+
+	//init LogCloser
+	w.LogCloserInit()
+
+	// add w to collection of all writers' info
+	registerWriter(w)
+
+	go w.run()
+
+	return w
+}
+
+// run takes records from ring in batch, and sends them. Each record is sent
+// in one message.
+func (w *SyslogWriter) run() {
+	var buf batchBuffer
+	batch := make([]*LogRecord, 0, LOG_BATCH_SIZE)
+
+	for {
+		batch = w.ring.getBatch(batch)
+
+		for _, rec := range batch {
+			if w.EndNotify(rec) {
+				return
+			}
+			if w.FlushNotify(rec, nil) {
+				continue
+			}
+
+			w.ring.formatRecord(&buf, rec)
+			if err := w.send(buf.Bytes()); err != nil {
+				fmt.Fprintf(os.Stderr, "SyslogWriter(%s, %s): %s\n", w.name, w.addr, err)
+				w.ring.countDropped(1)
+			} else {
+				w.ring.countWritten(1, buf.Len())
+			}
+			buf.Reset()
+			rec.release()
+		}
+	}
+}
+
+// formatRecord formats rec into syslog message in out, without framing.
+// Binary may be shared by other writers, it is not recycled here.
+func (w *SyslogWriter) formatRecord(out *bytes.Buffer, rec *LogRecord) {
+	var msg string
+	if rec.Binary != nil {
+		msg = string(rec.Binary)
+	} else {
+		msg = FormatLogRecord(w.format, rec)
+	}
+	out.Write(w.formatSyslog(rec.Level, rec.Created, strings.TrimRight(msg, "\n")))
+}
+
+// Set format of message (chainable), see FormatLogRecord.
+// Must be called before the first log message is written.
+func (w *SyslogWriter) SetFormat(format string) *SyslogWriter {
+	w.format = format
+	return w
+}
+
+func (w *SyslogWriter) LogWrite(rec *LogRecord) {
+	w.ring.logWrite(rec)
+}
+
+// SyslogWriter consumes records from ring
+func (w *SyslogWriter) consumeRing() {}
+
+// Name gets writer name
+func (w *SyslogWriter) Name() string {
+	return w.name
+}
+
+// QueueLen gets number of records in ring
+func (w *SyslogWriter) QueueLen() int {
+	return w.ring.Len()
+}
+
+// Stat gets counters of writer
+func (w *SyslogWriter) Stat() WriterStat {
+	return w.ring.stat()
+}
+
+// Flush sends records buffered before
+func (w *SyslogWriter) Flush(ctx context.Context) (int, error) {
+	return w.ring.waitForFlush(ctx)
+}
+
+// Close waits for dump all log
+func (w *SyslogWriter) Close() {
+	w.ring.waitForEnd(&w.LogCloser)
+	unregisterWriter(w)
+
+	if w.conn != nil {
+		w.conn.Close()
+	}
+	if w.pconn != nil {
+		w.pconn.conn.Close()
+	}
+}
+
+// send sends syslog message to syslog daemon
+func (w *SyslogWriter) send(data []byte) error {
+	if w.pconn != nil {
+		return w.pconn.Send(data)
+	}
+
+	// framing over tcp, see RFC 6587
+	if w.rfc == SYSLOG_RFC5424 {
+		data = append([]byte(strconv.Itoa(len(data))+" "), data...)
+	} else {
+		// newline ends the message, escape newlines within it
+		data = append(bytes.ReplaceAll(data, []byte("\n"), []byte("#012")), '\n')
+	}
+
+	// reconnect once if failed
+	if w.conn == nil {
+		if err := w.redial(); err != nil {
+			return err
+		}
+	}
+	w.conn.SetWriteDeadline(time.Now().Add(STREAM_WRITE_TIMEOUT))
+	if _, err := w.conn.Write(data); err != nil {
+		if err := w.redial(); err != nil {
+			return err
+		}
+		w.conn.SetWriteDeadline(time.Now().Add(STREAM_WRITE_TIMEOUT))
+		_, err = w.conn.Write(data)
+		return err
+	}
+	return nil
+}
+
+// redial re-establishes tcp connection
+func (w *SyslogWriter) redial() error {
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+	conn, err := net.DialTimeout(w.network, w.addr, STREAM_DIAL_TIMEOUT)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+// formatSyslog formats syslog message
+func (w *SyslogWriter) formatSyslog(lvl LevelType, t time.Time, msg string) []byte {
+	severity := SEVERITY_INFO
+	if lvl >= 0 && int(lvl) < len(levelSeverities) {
+		severity = levelSeverities[lvl]
+	}
+	pri := w.facility<<3 | severity
+
+	if w.rfc == SYSLOG_RFC5424 {
+		// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+		return []byte(fmt.Sprintf("<%d>1 %s %s %s %s - - %s", pri,
+			t.Format("2006-01-02T15:04:05.000000Z07:00"), w.hostname, w.tag, w.pid, msg))
+	}
+
+	// <PRI>TIMESTAMP HOSTNAME TAG[PID]: MSG
+	// hostname is omitted for local syslog daemon, which adds it
+	if w.network == "unixgram" {
+		return []byte(fmt.Sprintf("<%d>%s %s[%s]: %s", pri,
+			t.Format(time.Stamp), w.tag, w.pid, msg))
+	}
+	return []byte(fmt.Sprintf("<%d>%s %s %s[%s]: %s", pri,
+		t.Format(time.Stamp), w.hostname, w.tag, w.pid, msg))
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log4go
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatSyslog(t *testing.T) {
+	created := time.Date(2019, time.March, 5, 8, 9, 10, 123456000, time.UTC)
+	w := &SyslogWriter{
+		network:  "udp",
+		facility: FACILITY_LOCAL0,
+		tag:      "prog",
+		hostname: "host",
+		pid:      "100",
+	}
+
+	w.rfc = SYSLOG_RFC5424
+	want := "<131>1 2019-03-05T08:09:10.123456Z host prog 100 - - msg"
+	if got := string(w.formatSyslog(ERROR, created, "msg")); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	w.rfc = SYSLOG_RFC3164
+	want = "<135>Mar  5 08:09:10 host prog[100]: msg"
+	if got := string(w.formatSyslog(DEBUG, created, "msg")); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	w.network = "unixgram"
+	want = "<130>Mar  5 08:09:10 prog[100]: msg"
+	if got := string(w.formatSyslog(CRITICAL, created, "msg")); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSyslogWriterUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.ListenPacket(): %s", err)
+	}
+	defer pc.Close()
+
+	w := NewSyslogWriter("syslog", "udp", pc.LocalAddr().String(),
+		SYSLOG_RFC3164, FACILITY_USER, "prog")
+	if w == nil {
+		t.Fatalf("NewSyslogWriter() failed")
+	}
+	w.SetFormat("%M")
+	l := make(Logger)
+	l.AddFilter("syslog", INFO, w)
+	defer l.Close()
+
+	l.Warn("disk is full")
+
+	buf := make([]byte, 1024)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom(): %s", err)
+	}
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<12>") || !strings.HasSuffix(msg, " prog["+w.pid+"]: disk is full") {
+		t.Errorf("unexpected message: %q", msg)
+	}
+
+	l.Flush(context.Background())
+	if stat := w.Stat(); stat.Written != 1 || stat.Bytes != int64(n) {
+		t.Errorf("unexpected stat %+v", stat)
+	}
+}
+
+func TestSyslogWriterTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen(): %s", err)
+	}
+	defer ln.Close()
+
+	w := NewSyslogWriter("syslog", "tcp", ln.Addr().String(),
+		SYSLOG_RFC5424, FACILITY_DAEMON, "prog")
+	if w == nil {
+		t.Fatalf("NewSyslogWriter() failed")
+	}
+	w.SetFormat("%M")
+	l := make(Logger)
+	l.AddFilter("syslog", INFO, w)
+	defer l.Close()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Accept(): %s", err)
+	}
+	defer conn.Close()
+
+	l.Info("started")
+
+	// octet counting framing: "LEN MSG"
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	length, err := r.ReadString(' ')
+	if err != nil {
+		t.Fatalf("read length: %s", err)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(length))
+	if err != nil {
+		t.Fatalf("invalid length %q: %s", length, err)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		t.Fatalf("read message: %s", err)
+	}
+	if !strings.HasPrefix(string(msg), "<30>1 ") ||
+		!strings.HasSuffix(string(msg), " prog "+w.pid+" - - started") {
+		t.Errorf("unexpected message: %q", msg)
+	}
+}
+
+// test newlines within RFC 3164 message are escaped over tcp
+func TestSyslogWriterTCPNewline(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen(): %s", err)
+	}
+	defer ln.Close()
+
+	w := NewSyslogWriter("syslog", "tcp", ln.Addr().String(),
+		SYSLOG_RFC3164, FACILITY_DAEMON, "prog")
+	if w == nil {
+		t.Fatalf("NewSyslogWriter() failed")
+	}
+	w.SetFormat("%M")
+	l := make(Logger)
+	l.AddFilter("syslog", INFO, w)
+	defer l.Close()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Accept(): %s", err)
+	}
+	defer conn.Close()
+
+	l.Info("panic: failed\ngoroutine 1\n")
+	l.Info("next")
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	for _, want := range []string{" panic: failed#012goroutine 1\n", " next\n"} {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read message: %s", err)
+		}
+		if !strings.HasSuffix(line, want) {
+			t.Errorf("got %q, want suffix %q", line, want)
+		}
+	}
+}
@@ -17,6 +17,8 @@
 package log4go
 
 import (
+	"bytes"
+	"context"
 	"io"
 	"os"
 	"fmt"
@@ -25,41 +27,140 @@ import (
 var stdout io.Writer = os.Stdout
 
 // This is the standard writer that prints to standard output.
-type ConsoleLogWriter chan *LogRecord
+//
+// Note: ConsoleLogWriter was "chan *LogRecord" before, it is a struct with
+// ring buffer now. It should be created by NewConsoleLogWriter, and could not
+// be used as channel.
+type ConsoleLogWriter struct {
+	LogCloser //for Elegant exit
+
+	ring *recordRing
+}
 
 // This creates a new ConsoleLogWriter
 func NewConsoleLogWriter() ConsoleLogWriter {
-	records := make(ConsoleLogWriter, LogBufferLength)
-	go records.run(stdout)
-	return records
+	return newConsoleLogWriter(stdout)
+}
+
+// newConsoleLogWriter creates ConsoleLogWriter which writes to out
+func newConsoleLogWriter(out io.Writer) ConsoleLogWriter {
+	w := ConsoleLogWriter{
+		ring: newRecordRing(LogBufferLength, "stdout", formatConsoleRecord),
+	}
+	w.LogCloserInit()
+
+	// add w to collection of all writers' info
+	registerWriter(w)
+
+	go w.run(out)
+	return w
 }
 
+// run takes records from ring in batch, and writes them to out. Records in
+// a batch are written by one system call.
 func (w ConsoleLogWriter) run(out io.Writer) {
 	var timestr string
 	var timestrAt int64
 
-	for rec := range w {
-		if at := rec.Created.UnixNano() / 1e9; at != timestrAt {
-			timestr, timestrAt = rec.Created.Format("01/02/06 15:04:05"), at
+	var buf batchBuffer
+	batch := make([]*LogRecord, 0, LOG_BATCH_SIZE)
+
+	for {
+		batch = w.ring.getBatch(batch)
+
+		for _, rec := range batch {
+			if rec == nil {
+				w.writeBuf(out, &buf)
+				w.EndNotify(rec)
+				return
+			}
+			if rec.flushAck != nil {
+				w.writeBuf(out, &buf)
+				flushNotify(rec, nil)
+				continue
+			}
+
+			if rec.spilled {
+				w.ring.formatRecord(&buf, rec)
+			} else {
+				if at := rec.Created.UnixNano() / 1e9; at != timestrAt {
+					timestr, timestrAt = rec.Created.Format("01/02/06 15:04:05"), at
+				}
+				writeConsoleRecord(&buf.Buffer, timestr, rec)
+				buf.records++
+			}
+			rec.release()
 		}
-		fmt.Fprint(out, "[", timestr, "] [", levelStrings[rec.Level], "] ", rec.Message, "\n")
+
+		w.writeBuf(out, &buf)
+	}
+}
+
+// writeBuf writes formatted records in buf to out
+func (w ConsoleLogWriter) writeBuf(out io.Writer, buf *batchBuffer) {
+	if buf.Len() == 0 {
+		return
 	}
+	if _, err := out.Write(buf.Bytes()); err != nil {
+		fmt.Fprintf(os.Stderr, "ConsoleLogWriter: %s\n", err)
+		w.ring.countDropped(buf.records)
+	} else {
+		w.ring.countWritten(buf.records, buf.Len())
+	}
+	buf.Reset()
+}
+
+// writeConsoleRecord formats rec as "[time] [level] message fields"
+func writeConsoleRecord(out *bytes.Buffer, timestr string, rec *LogRecord) {
+	out.WriteByte('[')
+	out.WriteString(timestr)
+	out.WriteString("] [")
+	out.WriteString(levelStrings[rec.Level])
+	out.WriteString("] ")
+	out.WriteString(rec.Message)
+	if len(rec.Fields) > 0 {
+		writeFields(out, rec.Fields)
+	}
+	out.WriteByte('\n')
+}
+
+// formatConsoleRecord formats rec for spill file
+func formatConsoleRecord(out *bytes.Buffer, rec *LogRecord) {
+	writeConsoleRecord(out, rec.Created.Format("01/02/06 15:04:05"), rec)
 }
 
 // This is the ConsoleLogWriter's output method.  This will block if the output
 // buffer is full.
 func (w ConsoleLogWriter) LogWrite(rec *LogRecord) {
-    if !LogWithBlocking {
-        if len(w) >= LogBufferLength {            
-            return
-        }
-    }
-    
-	w <- rec
+	w.ring.logWrite(rec)
+}
+
+// ConsoleLogWriter consumes records from ring
+func (w ConsoleLogWriter) consumeRing() {}
+
+// Name gets writer name
+func (w ConsoleLogWriter) Name() string {
+	return "stdout"
+}
+
+// QueueLen gets number of records in ring
+func (w ConsoleLogWriter) QueueLen() int {
+	return w.ring.Len()
+}
+
+// Stat gets counters of writer
+func (w ConsoleLogWriter) Stat() WriterStat {
+	return w.ring.stat()
+}
+
+// Flush writes records buffered before
+func (w ConsoleLogWriter) Flush(ctx context.Context) (int, error) {
+	return w.ring.waitForFlush(ctx)
 }
 
 // Close stops the logger from sending messages to standard output.  Attempts to
 // send log messages to this logger after a Close have undefined behavior.
 func (w ConsoleLogWriter) Close() {
-	close(w)
+	w.ring.waitForEnd(&w.LogCloser)
+	unregisterWriter(w)
 }
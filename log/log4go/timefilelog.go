@@ -22,20 +22,25 @@ It supports:
 - Split log file by day, hour, minite
 - Suffix of log file reflect time of logging
 - Support backupCount
+- Split log file by size within one period, with sub-suffix of .001, .002, ...
+- Remove backups by total size and by age, besides backupCount
+- Compress backups in background, with codec of tar.gz, gzip or zstd (with
+  build tag "zstd")
+- Hash chain of records for audit, see audit.go
 */
 package log4go
 
 import (
-	"archive/tar"
-	"compress/gzip"
+	"bytes"
+	"context"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	strftime "github.com/jehiah/go-strftime"
@@ -47,13 +52,18 @@ const (
 
 	COMPRESS_SUFFIX       = ".tar.gz"   /* file suffix when enable compress for log */
 	REGEX_COMPRESS_SUFFIX = `\.tar\.gz` /* file regular suffix when enable compress for log */
+
+	REGEX_SIZE_SUFFIX = `(\.\d{3,})?` /* file regular sub-suffix for roll over by size */
+	MAX_SIZE_BACKUPS  = 999           /* max number of roll over by size within one period */
+
+	ROTATE_RETRY_INTERVAL = 10 /* seconds before retrying a failed roll over */
 )
 
 // This log writer sends output to a file
 type TimeFileLogWriter struct {
 	LogCloser //for Elegant exit
 
-	rec chan *LogRecord
+	ring *recordRing
 
 	// The opened file
 	filename     string
@@ -63,17 +73,33 @@ type TimeFileLogWriter struct {
 	// The logging format
 	format string
 
+	binaryFrame bool        // whether binary records are written in frames
+	audit       *auditChain // hash chain of records, see TimeFileOptions
+
 	when        string // 'D', 'H', 'M', "MIDNIGHT", "NEXTHOUR"
 	backupCount int    // If backupCount is > 0, when rollover is done,
 	// no more than backupCount files are kept
 
-	enableCompress bool // compress the roll over log file
+	enableCompress bool          // compress the roll over log file
+	codec          CompressCodec // codec for compressing, default is tar.gz
+
+	maxSize int64 // If maxSize > 0, roll over when size of file exceeds maxSize
+	curSize int64 // size of current file
+
+	maxBackupSize int64          // If maxBackupSize > 0, total size of backups is limited
+	maxBackupAge  time.Duration  // If maxBackupAge > 0, older backups are removed
+	deleting      sync.WaitGroup // goroutines deleting backups, see deleteFiles
+
+	compressing  sync.WaitGroup  // backups queued for compression
+	compressLock sync.Mutex      // protects queued
+	queued       map[string]bool // backups queued for compression, not removed
 
 	interval   int64
 	suffix     string         // suffix of log file
 	fileFilter *regexp.Regexp // for removing old log files
 
 	rolloverAt int64 // time.Unix()
+	retryAt    int64 // time.Unix(), no roll over before it after a failed one
 }
 
 // WhenIsValid checks whether value of when is valid
@@ -86,23 +112,41 @@ func WhenIsValid(when string) bool {
 	}
 }
 
-// This is the FileLogWriter's output method
+// This is the FileLogWriter's output method. Binary records larger than
+// BINARY_FRAME_MAX_SIZE are dropped if written in frames.
 func (w *TimeFileLogWriter) LogWrite(rec *LogRecord) {
-	if !LogWithBlocking {
-		select {
-		case w.rec <- rec:
-		default:
-		}
+	if w.binaryFrame && len(rec.Binary) > BINARY_FRAME_MAX_SIZE {
+		w.ring.drop(rec)
 		return
 	}
+	w.ring.logWrite(rec)
+}
+
+// TimeFileLogWriter consumes records from ring
+func (w *TimeFileLogWriter) consumeRing() {}
 
-	w.rec <- rec
+// Flush writes records buffered before, and syncs the file
+func (w *TimeFileLogWriter) Flush(ctx context.Context) (int, error) {
+	return w.ring.waitForFlush(ctx)
 }
 
-// Close waits for dump all log and close chan
+func (w *TimeFileLogWriter) sync() (int, error) {
+	if w.file == nil {
+		return 0, nil
+	}
+	if err := w.file.Sync(); err != nil {
+		return 0, err
+	}
+	if w.audit != nil {
+		return 0, w.syncAudit()
+	}
+	return 0, nil
+}
+
+// Close waits for dump all log and close file
 func (w *TimeFileLogWriter) Close() {
-	w.WaitForEnd(w.rec)
-	close(w.rec)
+	w.ring.waitForEnd(&w.LogCloser)
+	unregisterWriter(w)
 }
 
 func (w *TimeFileLogWriter) computeRollover(currTime time.Time) int64 {
@@ -132,28 +176,34 @@ func (w *TimeFileLogWriter) prepare() {
 	case "M":
 		w.interval = 60
 		w.suffix = "%Y-%m-%d_%H-%M"
-		regRule = `^\d{4}-\d{2}-\d{2}_\d{2}-\d{2}$`
+		regRule = `^\d{4}-\d{2}-\d{2}_\d{2}-\d{2}`
 	case "H", "NEXTHOUR":
 		w.interval = 60 * 60
 		w.suffix = "%Y-%m-%d_%H"
-		regRule = `^\d{4}-\d{2}-\d{2}_\d{2}$`
+		regRule = `^\d{4}-\d{2}-\d{2}_\d{2}`
 	case "D", "MIDNIGHT":
 		w.interval = 60 * 60 * 24
 		w.suffix = "%Y-%m-%d"
-		regRule = `^\d{4}-\d{2}-\d{2}$`
+		regRule = `^\d{4}-\d{2}-\d{2}`
 	default:
 		// default is "D"
 		w.interval = 60 * 60 * 24
 		w.suffix = "%Y-%m-%d"
-		regRule = `^\d{4}-\d{2}-\d{2}$`
+		regRule = `^\d{4}-\d{2}-\d{2}`
 	}
 
-	// file name would be end with '.tar.gz' if the compress option is enable
-	if w.enableCompress {
-		regRule = regRule[:len(regRule)-1] + REGEX_COMPRESS_SUFFIX + regRule[len(regRule)-1:]
-	}
+	// file name may be end with '.001', '.002', ... if roll over by size
+	regRule += REGEX_SIZE_SUFFIX
+
+	// file name would be end with suffix of codec (e.g., '.tar.gz') if the
+	// compress option is enable. Backups with suffix of any codec, and
+	// uncompressed backups are all matched, so that they could be removed.
+	regRule += regexCompressSuffix()
 
-	w.fileFilter = regexp.MustCompile(regRule)
+	w.fileFilter = regexp.MustCompile(regRule + "$")
+
+	// remove temporary files left by compression interrupted
+	w.removeCompressTemp()
 
 	fInfo, err := os.Stat(w.filename)
 
@@ -167,6 +217,35 @@ func (w *TimeFileLogWriter) prepare() {
 	w.rolloverAt = w.computeRollover(t)
 }
 
+// removeCompressTemp removes temporary files of compressing backups, e.g.,
+// app.log.2019-01-01.tar.gz.tmp, which are left if compression is interrupted
+func (w *TimeFileLogWriter) removeCompressTemp() {
+	dirName := filepath.Dir(w.baseFilename)
+	prefix := filepath.Base(w.baseFilename) + "."
+
+	fileInfos, err := ioutil.ReadDir(dirName)
+	if err != nil {
+		return
+	}
+	suffixes := compressSuffixes()
+	for _, fileInfo := range fileInfos {
+		fileName := fileInfo.Name()
+		if !strings.HasPrefix(fileName, prefix) || !strings.HasSuffix(fileName, ".tmp") {
+			continue
+		}
+		target := strings.TrimSuffix(fileName[len(prefix):], ".tmp")
+		if !w.fileFilter.MatchString(target) {
+			continue
+		}
+		for _, suffix := range suffixes {
+			if strings.HasSuffix(target, suffix) {
+				os.Remove(filepath.Join(dirName, fileName))
+				break
+			}
+		}
+	}
+}
+
 func (w *TimeFileLogWriter) shouldRollover() bool {
 	t := time.Now().Unix()
 
@@ -177,6 +256,31 @@ func (w *TimeFileLogWriter) shouldRollover() bool {
 	}
 }
 
+// shouldRolloverBySize checks whether size of current file exceeds maxSize
+func (w *TimeFileLogWriter) shouldRolloverBySize() bool {
+	return w.maxSize > 0 && w.curSize >= w.maxSize
+}
+
+// shouldRotate checks whether to roll over, not retrying a failed roll over
+// within ROTATE_RETRY_INTERVAL
+func (w *TimeFileLogWriter) shouldRotate() bool {
+	if time.Now().Unix() < w.retryAt {
+		return false
+	}
+	return w.shouldRollover() || w.shouldRolloverBySize()
+}
+
+// TimeFileOptions is options of TimeFileLogWriter, which are applied
+// before the writer starts (e.g., backups are removed by them at startup)
+type TimeFileOptions struct {
+	MaxBackupSize int64         // max total size of backups, if > 0
+	MaxBackupAge  time.Duration // max age of backups, if > 0
+
+	BinaryFrame bool   // write binary records in frames, see SetBinaryFrame
+	Audit       bool   // hash chain of records, see audit.go; not with BinaryFrame
+	AuditKey    []byte // key of HMAC-SHA256 for audit chain, SHA-256 if empty
+}
+
 // NewTimeFileLogWriter creates a new TimeFileLogWriter
 //
 // PARAMS:
@@ -191,28 +295,45 @@ func (w *TimeFileLogWriter) shouldRollover() bool {
 //       backupCount files are kept - the oldest ones are deleted.
 //   - enableCompress: whether to compress the roll over log file
 func NewTimeFileLogWriter(fname string, when string, backupCount int, enableCompress bool) *TimeFileLogWriter {
+	return NewTimeFileLogWriterWithOptions(fname, when, backupCount, enableCompress, TimeFileOptions{})
+}
+
+// NewTimeFileLogWriterWithOptions creates a new TimeFileLogWriter, with
+// options applied before the writer starts
+//
+// PARAMS:
+//   - fname, when, backupCount, enableCompress: see NewTimeFileLogWriter
+//   - opts: options of the writer
+func NewTimeFileLogWriterWithOptions(fname string, when string, backupCount int, enableCompress bool,
+	opts TimeFileOptions) *TimeFileLogWriter {
 	// check value of when is valid
 	if !WhenIsValid(when) {
 		fmt.Fprintf(os.Stderr, "NewTimeFileLogWriter(%q): invalid value of when:%s \n",
 			fname, when)
 		return nil
 	}
+	if opts.Audit && opts.BinaryFrame {
+		fmt.Fprintf(os.Stderr, "NewTimeFileLogWriter(%q): audit chain could not be used with binary frame\n",
+			fname)
+		return nil
+	}
 
 	// change when to upper
 	when = strings.ToUpper(when)
 
 	// create TimeFileLogWriter
 	w := &TimeFileLogWriter{
-		rec:            make(chan *LogRecord, LogBufferLength),
 		filename:       fname,
 		format:         "[%D %T] [%L] (%S) %M",
 		when:           when,
 		backupCount:    backupCount,
 		enableCompress: enableCompress,
+		maxBackupSize:  opts.MaxBackupSize,
+		maxBackupAge:   opts.MaxBackupAge,
+		binaryFrame:    opts.BinaryFrame,
 	}
-
-	// add w to collection of all writers
-	writersInfo = append(writersInfo, w)
+	w.codec, _ = GetCompressCodec(COMPRESS_TARGZ)
+	w.ring = newRecordRing(LogBufferLength, fname, w.formatRecord)
 
 	//init LogCloser
 	w.LogCloserInit()
@@ -234,47 +355,120 @@ func NewTimeFileLogWriter(fname string, when string, backupCount int, enableComp
 		return nil
 	}
 
-	go func() {
-		defer func() {
-			if w.file != nil {
-				w.file.Close()
-			}
-		}()
+	// resume audit chain before the writer starts
+	if opts.Audit {
+		if err := w.initAuditChain(opts.AuditKey); err != nil {
+			fmt.Fprintf(os.Stderr, "NewTimeFileLogWriter(%q): audit chain: %s\n", w.filename, err)
+			w.file.Close()
+			return nil
+		}
+	}
+
+	// add w to collection of all writers
+	registerWriter(w)
+
+	go w.run()
+
+	return w
+}
+
+// run takes records from ring in batch, and writes them to file. Records in
+// a batch are written by one system call.
+func (w *TimeFileLogWriter) run() {
+	defer func() {
+		if w.file != nil {
+			w.file.Close()
+		}
+	}()
+
+	var buf batchBuffer
+	batch := make([]*LogRecord, 0, LOG_BATCH_SIZE)
 
-		for rec := range w.rec {
-			if w.EndNotify(rec) {
+	for {
+		batch = w.ring.getBatch(batch)
+
+		for _, rec := range batch {
+			if rec == nil {
+				w.writeBuf(&buf)
+				if w.audit != nil {
+					if err := w.syncAudit(); err != nil {
+						fmt.Fprintf(os.Stderr, "NewTimeFileLogWriter(%q): %s\n", w.filename, err)
+					}
+				}
+				w.deleting.Wait()
+				w.compressing.Wait()
+				w.EndNotify(rec)
 				return
 			}
+			if rec.flushAck != nil {
+				w.writeBuf(&buf)
+				w.FlushNotify(rec, w.sync)
+				continue
+			}
 
-			if w.shouldRollover() {
+			if w.shouldRotate() {
+				w.writeBuf(&buf)
 				if err := w.intRotate(); err != nil {
+					// keep writing to current file (if still open), and
+					// retry later instead of on every record
 					fmt.Fprintf(os.Stderr, "NewTimeFileLogWriter(%q): %s\n", w.filename, err)
-					continue
+					w.retryAt = time.Now().Unix() + ROTATE_RETRY_INTERVAL
 				}
 			}
 
-			// Perform the write
-			var err error
-			if rec.Binary != nil {
-				_, err = w.file.Write(rec.Binary)
-			} else {
-				_, err = fmt.Fprint(w.file, FormatLogRecord(w.format, rec))
-			}
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "NewTimeFileLogWriter(%q): %s\n", w.filename, err)
+			// Format the record into buffer, size of file includes
+			// records in buffer
+			n := buf.Len()
+			w.ring.formatRecord(&buf, rec)
+			if w.audit != nil {
+				w.audit.chainRecord(&buf, n)
 			}
+			w.curSize += int64(buf.Len() - n)
+			rec.release()
 		}
-	}()
 
-	return w
+		w.writeBuf(&buf)
+	}
 }
 
-// getFilesToDelete determines the files to delete when rolling over
-func (w *TimeFileLogWriter) getFilesToDelete() []string {
+// writeBuf writes formatted records in buf to file
+func (w *TimeFileLogWriter) writeBuf(buf *batchBuffer) {
+	if buf.Len() == 0 {
+		return
+	}
+	if _, err := w.file.Write(buf.Bytes()); err != nil {
+		fmt.Fprintf(os.Stderr, "NewTimeFileLogWriter(%q): %s\n", w.filename, err)
+		w.ring.countDropped(buf.records)
+		if w.audit != nil {
+			w.audit.rollback()
+		}
+	} else {
+		w.ring.countWritten(buf.records, buf.Len())
+		if w.audit != nil {
+			w.audit.commit()
+		}
+	}
+	buf.Reset()
+}
+
+// formatRecord formats rec into out, binary record is written as it is,
+// or in frame (see SetBinaryFrame)
+func (w *TimeFileLogWriter) formatRecord(out *bytes.Buffer, rec *LogRecord) {
+	if rec.Binary != nil && w.binaryFrame {
+		writeBinaryFrame(out, rec)
+	} else if rec.Binary != nil {
+		out.Write(rec.Binary)
+	} else {
+		writeLogRecord(out, w.format, rec)
+	}
+}
+
+// getBackupFiles gets info of backup files, from the oldest to the newest
+func (w *TimeFileLogWriter) getBackupFiles() []os.FileInfo {
 	dirName := filepath.Dir(w.baseFilename)
 	baseName := filepath.Base(w.baseFilename)
 
-	result := []string{}
+	result := []os.FileInfo{}
 
 	fileInfos, err := ioutil.ReadDir(dirName)
 	if err != nil {
@@ -291,50 +485,186 @@ func (w *TimeFileLogWriter) getFilesToDelete() []string {
 			if fileName[:plen] == prefix {
 				suffix := fileName[plen:]
 				if w.fileFilter.MatchString(suffix) {
-					result = append(result, filepath.Join(dirName, fileName))
+					result = append(result, fileInfo)
 				}
 			}
 		}
 	}
 
-	sort.Sort(sort.StringSlice(result))
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
 
-	if len(result) < w.backupCount {
-		result = result[0:0]
-	} else {
-		result = result[:len(result)-w.backupCount]
+	return result
+}
+
+// retention is limits of backups, see getFilesToDelete
+type retention struct {
+	backupCount   int
+	maxBackupSize int64
+	maxBackupAge  time.Duration
+}
+
+// enabled checks whether any limit is set
+func (r retention) enabled() bool {
+	return r.backupCount > 0 || r.maxBackupSize > 0 || r.maxBackupAge > 0
+}
+
+// retention gets limits of backups of the writer
+func (w *TimeFileLogWriter) retention() retention {
+	return retention{
+		backupCount:   w.backupCount,
+		maxBackupSize: w.maxBackupSize,
+		maxBackupAge:  w.maxBackupAge,
+	}
+}
+
+// getFilesToDelete determines the files to delete when rolling over
+//
+// A backup is deleted if any of the following is true:
+// - it is not in the newest backupCount backups (if backupCount > 0)
+// - total size of it and newer backups exceeds maxBackupSize (if maxBackupSize > 0)
+// - it was modified before maxBackupAge ago (if maxBackupAge > 0)
+func (w *TimeFileLogWriter) getFilesToDelete(r retention) []string {
+	dirName := filepath.Dir(w.baseFilename)
+	backups := w.getBackupFiles()
+
+	// number of the oldest backups to delete
+	count := 0
+	if r.backupCount > 0 && len(backups) > r.backupCount {
+		count = len(backups) - r.backupCount
+	}
+
+	// check total size, from the newest to the oldest
+	if r.maxBackupSize > 0 {
+		var totalSize int64
+		for i := len(backups) - 1; i >= count; i-- {
+			totalSize += backups[i].Size()
+			if totalSize > r.maxBackupSize {
+				count = i + 1
+				break
+			}
+		}
+	}
+
+	result := []string{}
+	for i, fileInfo := range backups {
+		fileName := filepath.Join(dirName, fileInfo.Name())
+		if w.isQueued(fileName) {
+			// being compressed, removed later if still beyond limits
+			continue
+		}
+		if i < count {
+			result = append(result, fileName)
+			continue
+		}
+
+		// check age of backup
+		if r.maxBackupAge > 0 && time.Since(fileInfo.ModTime()) > r.maxBackupAge {
+			result = append(result, fileName)
+		}
 	}
 	return result
 }
 
-// moveToBackup renames file to backup name
-func (w *TimeFileLogWriter) moveToBackup() error {
+// compressQueued marks backup as queued for compression
+func (w *TimeFileLogWriter) compressQueued(fname string) {
+	w.compressing.Add(1)
+	w.compressLock.Lock()
+	if w.queued == nil {
+		w.queued = make(map[string]bool)
+	}
+	w.queued[fname] = true
+	w.compressLock.Unlock()
+}
+
+// compressDone marks backup as compressed (or failed)
+func (w *TimeFileLogWriter) compressDone(fname string) {
+	w.compressLock.Lock()
+	delete(w.queued, fname)
+	w.compressLock.Unlock()
+	w.compressing.Done()
+}
+
+// isQueued checks whether backup is queued for compression
+func (w *TimeFileLogWriter) isQueued(fname string) bool {
+	w.compressLock.Lock()
+	defer w.compressLock.Unlock()
+	return w.queued[fname]
+}
+
+// backupExists checks whether backup file (or its compressed file) exists
+func (w *TimeFileLogWriter) backupExists(fname string) bool {
+	if _, err := os.Lstat(fname); err == nil {
+		return true
+	}
+	for _, suffix := range compressSuffixes() {
+		if _, err := os.Lstat(fname + suffix); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// backupName gets name of backup file
+//
+// Name of backup is baseFilename.<suffix>. If the file has rolled over by
+// size within current period, numbered sub-suffix is appended, e.g.,
+// baseFilename.<suffix>.001, baseFilename.<suffix>.002, ...
+func (w *TimeFileLogWriter) backupName(bySize bool) (string, error) {
+	// get the time that this sequence started at and make it a TimeTuple
+	t := time.Unix(w.rolloverAt-w.interval, 0).Local()
+	fname := w.baseFilename + "." + strftime.Format(w.suffix, t)
+
+	if !bySize && !w.backupExists(fname+".001") {
+		return fname, nil
+	}
+
+	// Find the next available number
+	for num := 1; num <= MAX_SIZE_BACKUPS; num++ {
+		name := fname + fmt.Sprintf(".%03d", num)
+		if !w.backupExists(name) {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("Rotate: Cannot find free log number to rename %s\n", w.filename)
+}
+
+// moveToBackup renames file to backup name, and returns the backup name
+// ("" if file not exists)
+func (w *TimeFileLogWriter) moveToBackup(bySize bool) (string, error) {
 	_, err := os.Lstat(w.filename)
 	if err == nil { // file exists
-		// get the time that this sequence started at and make it a TimeTuple
-		t := time.Unix(w.rolloverAt-w.interval, 0).Local()
-		fname := w.baseFilename + "." + strftime.Format(w.suffix, t)
+		fname, err := w.backupName(bySize)
+		if err != nil {
+			return "", err
+		}
 
 		// remove the file with fname if exist
 		if _, err := os.Stat(fname); err == nil {
 			err = os.Remove(fname)
 			if err != nil {
-				return fmt.Errorf("Rotate: %s\n", err)
+				return "", fmt.Errorf("Rotate: %s\n", err)
 			}
 		}
 
 		// Rename the file to its newfound home
 		err = os.Rename(w.baseFilename, fname)
 		if err != nil {
-			return fmt.Errorf("Rotate: %s\n", err)
+			return "", fmt.Errorf("Rotate: %s\n", err)
 		}
 
-		// compress the newfile if enable compressed
+		// compress the newfile in background if enable compressed
 		if w.enableCompress {
-			compressArchiveFile(fname)
+			w.compressQueued(fname)
+			if err := compressAsync(fname, w.codec, w.compressDone); err != nil {
+				fmt.Fprintf(os.Stderr, "TimeFileLogWriter(%q): %s", w.filename, err)
+				w.compressDone(fname)
+			}
 		}
+		return fname, nil
 	}
-	return nil
+	return "", nil
 }
 
 func (w *TimeFileLogWriter) adjustRolloverAt() {
@@ -348,32 +678,46 @@ func (w *TimeFileLogWriter) adjustRolloverAt() {
 	w.rolloverAt = newRolloverAt
 }
 
-// remove files, according to backupCount
-func (w *TimeFileLogWriter) deleteFiles(){
-	if w.backupCount > 0 {
-		for _, fileName := range w.getFilesToDelete() {
-			os.Remove(fileName)
-		}
+// remove files, according to backupCount, maxBackupSize and maxBackupAge.
+// Limits are passed by value, since it runs in background.
+func (w *TimeFileLogWriter) deleteFiles(r retention) {
+	defer w.deleting.Done()
+
+	for _, fileName := range w.getFilesToDelete(r) {
+		os.Remove(fileName)
+		// manifest of audit chain, if any
+		os.Remove(AuditManifestName(fileName))
 	}
 }
 
 // If this is called in a threaded context, it MUST be synchronized
 func (w *TimeFileLogWriter) intRotate() error {
-	// Close any log file that may be open
-	if w.file != nil {
-		w.file.Close()
-		w.file = nil
-	}
-
+	var backup string
+	var err error
 	if w.shouldRollover() {
 		// rename file to backup name
-		if err := w.moveToBackup(); err != nil {
+		if backup, err = w.moveToBackup(false); err != nil {
+			return err
+		}
+	} else if w.shouldRolloverBySize() {
+		// rename file to backup name with numbered sub-suffix
+		if backup, err = w.moveToBackup(true); err != nil {
 			return err
 		}
 	}
-	
+
+	// Close any log file that may be open, it is kept open if the file
+	// fails to be moved to backup, so that records are not lost
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+
 	// asynchronously delete legacy files to avoid from blocking
-	go w.deleteFiles()
+	if r := w.retention(); r.enabled() {
+		w.deleting.Add(1)
+		go w.deleteFiles(r)
+	}
 
 	// Open the log file
 	fd, err := os.OpenFile(w.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
@@ -382,6 +726,17 @@ func (w *TimeFileLogWriter) intRotate() error {
 	}
 	w.file = fd
 
+	// get size of current file
+	w.curSize = 0
+	if fInfo, err := fd.Stat(); err == nil {
+		w.curSize = fInfo.Size()
+	}
+
+	// chain of the new file starts from the end of the backup
+	if w.audit != nil {
+		w.rotateAudit(backup)
+	}
+
 	// adjust rolloverAt
 	w.adjustRolloverAt()
 
@@ -395,67 +750,82 @@ func (w *TimeFileLogWriter) SetFormat(format string) *TimeFileLogWriter {
 	return w
 }
 
-// Name gets file name
-func (w *TimeFileLogWriter) Name() string {
-	return w.filename
-}
-
-// QueueLen gets rec channel length
-func (w *TimeFileLogWriter) QueueLen() int {
-	return len(w.rec)
+// SetRotateSize sets max size of log file (chainable). Must be called before
+// the first log message is written.
+//
+// If maxSize > 0, the log file also rolls over when its size exceeds maxSize
+// within one period. Backup files of such rollover are with numbered
+// sub-suffix, e.g., app.log.2019-01-01_10.001, app.log.2019-01-01_10.002, ...
+func (w *TimeFileLogWriter) SetRotateSize(maxSize int) *TimeFileLogWriter {
+	w.maxSize = int64(maxSize)
+	return w
 }
 
-// compressArchiveFile will package and compress file by the name
-// use gzip as compressing algorithm
-func compressArchiveFile(fname string) error {
-	var errMsg = "Compress file: %s\n"
-
-	// generate target file which is compressed archived
-	fw, err := os.Create(fname + COMPRESS_SUFFIX)
+// SetCompressCodec sets codec for compressing backups, COMPRESS_TARGZ by
+// default. Must be called before the first log message is written.
+// It takes effect only if compress is enabled by NewTimeFileLogWriter.
+//
+// Codec is one of COMPRESS_TARGZ, COMPRESS_GZIP, COMPRESS_ZSTD (only built with
+// tag "zstd"), or name of codec registered by RegisterCompressCodec().
+func (w *TimeFileLogWriter) SetCompressCodec(name string) error {
+	codec, err := GetCompressCodec(name)
 	if err != nil {
-		return fmt.Errorf(errMsg, err)
+		return err
 	}
-	defer fw.Close()
 
-	// create Gzip writer
-	gw := gzip.NewWriter(fw)
-	defer gw.Close()
-	// create Tar writer
-	tw := tar.NewWriter(gw)
-	defer tw.Close()
+	w.codec = codec
+	return nil
+}
 
-	// obtain file info header
-	fi, err := os.Stat(fname)
-	if err != nil {
-		return fmt.Errorf(errMsg, err)
-	}
-	hdr, err := tar.FileInfoHeader(fi, "")
-	if err != nil {
-		return fmt.Errorf(errMsg, err)
-	}
+// SetMaxBackupSize sets max total size of backup files (chainable). Must be
+// called before the first log message is written.
+//
+// If maxBackupSize > 0, when rollover is done, the oldest backups are deleted
+// until total size of backups (plain or compressed) is no more than maxBackupSize.
+// It applies from the next rollover; use TimeFileOptions to apply it at startup.
+func (w *TimeFileLogWriter) SetMaxBackupSize(maxBackupSize int64) *TimeFileLogWriter {
+	w.maxBackupSize = maxBackupSize
+	return w
+}
 
-	// write archive file header
-	err = tw.WriteHeader(hdr)
-	if err != nil {
-		return fmt.Errorf(errMsg, err)
-	}
+// SetMaxBackupAge sets max age of backup files (chainable). Must be called
+// before the first log message is written.
+//
+// If maxBackupAge > 0, when rollover is done, backups (plain or compressed)
+// which were last modified before maxBackupAge ago are deleted. It applies
+// from the next rollover; use TimeFileOptions to apply it at startup.
+func (w *TimeFileLogWriter) SetMaxBackupAge(maxBackupAge time.Duration) *TimeFileLogWriter {
+	w.maxBackupAge = maxBackupAge
+	return w
+}
 
-	// write compressed file
-	fr, err := os.Open(fname)
-	if err != nil {
-		return fmt.Errorf(errMsg, err)
-	}
-	defer fr.Close()
-	_, err = io.Copy(tw, fr)
-	if err != nil {
-		return fmt.Errorf(errMsg, err)
+// SetBinaryFrame sets whether binary records are written in frames
+// (chainable). Must be called before the first log message is written.
+//
+// Frames carry level, time and checksum of records, and could be read by
+// BinaryLogReader. By default, binary records are written as they are.
+// Binary frame could not be enabled with audit chain, see TimeFileOptions.
+func (w *TimeFileLogWriter) SetBinaryFrame(enable bool) *TimeFileLogWriter {
+	if enable && w.audit != nil {
+		fmt.Fprintf(os.Stderr, "TimeFileLogWriter(%q): audit chain could not be used with binary frame\n",
+			w.filename)
+		return w
 	}
+	w.binaryFrame = enable
+	return w
+}
 
-	// remove raw file
-	err = os.Remove(fname)
-	if err != nil {
-		return fmt.Errorf(errMsg, err)
-	}
+// Name gets file name
+func (w *TimeFileLogWriter) Name() string {
+	return w.filename
+}
 
-	return nil
+// QueueLen gets number of records in ring
+func (w *TimeFileLogWriter) QueueLen() int {
+	return w.ring.Len()
+}
+
+// Stat gets counters of writer
+func (w *TimeFileLogWriter) Stat() WriterStat {
+	return w.ring.stat()
 }
@@ -14,7 +14,14 @@
 package log4go
 
 import (
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
     "testing"
+    "time"
+
+    strftime "github.com/jehiah/go-strftime"
 )
 
 // test WhenIsValid()
@@ -38,4 +45,138 @@ func TestWhenIsValid(t *testing.T) {
     if !WhenIsValid("d") {
         t.Error("err in WhenIsValid('H')")
     }
-}
\ No newline at end of file
+}
+
+// test roll over by size within one period
+func TestTimeFileLogWriterRotateSize(t *testing.T) {
+    defer func(buflen int) {
+        LogBufferLength = buflen
+    }(LogBufferLength)
+    LogBufferLength = 0
+
+    dir, err := ioutil.TempDir("", "timefilelog")
+    if err != nil {
+        t.Fatalf("ioutil.TempDir(): %s", err)
+    }
+    defer os.RemoveAll(dir)
+
+    fname := filepath.Join(dir, "test.log")
+    w := NewTimeFileLogWriter(fname, "D", 1, false)
+    if w == nil {
+        t.Fatalf("Invalid return: w should not be nil")
+    }
+    w.SetRotateSize(60)
+
+    // each record is 50 bytes
+    for i := 0; i < 5; i++ {
+        w.LogWrite(newLogRecord(CRITICAL, "source", "message", nil))
+    }
+    w.Close()
+
+    // only the latest backup is kept
+    suffix := strftime.Format("%Y-%m-%d", time.Now())
+    for _, name := range []string{"test.log", "test.log." + suffix + ".002"} {
+        if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+            t.Errorf("file %s should exist: %s", name, err)
+        }
+    }
+    if _, err := os.Stat(filepath.Join(dir, "test.log."+suffix+".001")); !os.IsNotExist(err) {
+        t.Errorf("file %s should be removed", "test.log."+suffix+".001")
+    }
+}
+
+// test records are kept in current file when roll over fails
+func TestTimeFileLogWriterRotateFail(t *testing.T) {
+    dir, err := ioutil.TempDir("", "timefilelog")
+    if err != nil {
+        t.Fatalf("ioutil.TempDir(): %s", err)
+    }
+    defer os.RemoveAll(dir)
+
+    // numbered backups of this period are exhausted
+    suffix := strftime.Format("%Y-%m-%d", time.Now())
+    for num := 1; num <= MAX_SIZE_BACKUPS; num++ {
+        name := filepath.Join(dir, fmt.Sprintf("test.log.%s.%03d", suffix, num))
+        if err := ioutil.WriteFile(name, nil, 0644); err != nil {
+            t.Fatalf("ioutil.WriteFile(): %s", err)
+        }
+    }
+
+    fname := filepath.Join(dir, "test.log")
+    w := NewTimeFileLogWriter(fname, "D", 0, false)
+    if w == nil {
+        t.Fatalf("Invalid return: w should not be nil")
+    }
+    w.SetRotateSize(60)
+
+    // each record is 50 bytes
+    for i := 0; i < 5; i++ {
+        w.LogWrite(newLogRecord(CRITICAL, "source", "message", nil))
+    }
+    w.Close()
+
+    if stat := w.Stat(); stat.Dropped != 0 || stat.Written != 5 {
+        t.Errorf("stat should be 0 dropped, 5 written: %+v", stat)
+    }
+    data, err := ioutil.ReadFile(fname)
+    if err != nil {
+        t.Fatalf("ioutil.ReadFile(): %s", err)
+    }
+    if len(data) != 250 {
+        t.Errorf("all records should be in %s, size %d", fname, len(data))
+    }
+}
+
+// test retention by total size and age
+func TestTimeFileLogWriterRetention(t *testing.T) {
+    dir, err := ioutil.TempDir("", "timefilelog")
+    if err != nil {
+        t.Fatalf("ioutil.TempDir(): %s", err)
+    }
+    defer os.RemoveAll(dir)
+
+    // prepare backups, each is 100 bytes, the first is 10 days ago
+    backups := []string{
+        "test.log.2019-01-01_00",
+        "test.log.2019-01-01_01.tar.gz",
+        "test.log.2019-01-01_02.001",
+        "test.log.2019-01-01_02.002.tar.gz",
+        "test.log.2019-01-01_03",
+    }
+    for i, name := range backups {
+        path := filepath.Join(dir, name)
+        if err := ioutil.WriteFile(path, make([]byte, 100), 0644); err != nil {
+            t.Fatalf("ioutil.WriteFile(): %s", err)
+        }
+        if i == 0 {
+            modTime := time.Now().Add(-10 * 24 * time.Hour)
+            os.Chtimes(path, modTime, modTime)
+        }
+    }
+    // not a backup
+    ioutil.WriteFile(filepath.Join(dir, "test.log.bak"), make([]byte, 100), 0644)
+
+    // by age, applied at startup
+    w := NewTimeFileLogWriterWithOptions(filepath.Join(dir, "test.log"), "H", 0, false,
+        TimeFileOptions{MaxBackupAge: 7 * 24 * time.Hour})
+    if w == nil {
+        t.Fatalf("Invalid return: w should not be nil")
+    }
+    w.Close()
+    if _, err := os.Stat(filepath.Join(dir, backups[0])); !os.IsNotExist(err) {
+        t.Errorf("backup %s should be removed at startup", backups[0])
+    }
+    backups = backups[1:]
+
+    // by total size
+    files := w.getFilesToDelete(retention{maxBackupSize: 250})
+    if len(files) != 2 || filepath.Base(files[1]) != backups[1] {
+        t.Errorf("err in getFilesToDelete() by size: %v", files)
+    }
+
+    // by count and total size
+    files = w.getFilesToDelete(retention{backupCount: 1, maxBackupSize: 250})
+    if len(files) != 3 {
+        t.Errorf("err in getFilesToDelete() by count and size: %v", files)
+    }
+}
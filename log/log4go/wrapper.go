@@ -17,10 +17,12 @@
 package log4go
 
 import (
+	"context"
 	"errors"
 	"os"
 	"fmt"
 	"strings"
+	"time"
 )
 
 var (
@@ -46,17 +48,28 @@ func Close() {
 	Global.Close()
 }
 
+// Wrapper for (*Logger).Flush
+func Flush(ctx context.Context) error {
+	return Global.Flush(ctx)
+}
+
+// Wrapper for (*Logger).CloseWithTimeout
+func CloseWithTimeout(timeout time.Duration) error {
+	return Global.CloseWithTimeout(timeout)
+}
+
 func Crash(args ...interface{}) {
 	if len(args) > 0 {
 		Global.intLogf(CRITICAL, strings.Repeat(" %v", len(args))[1:], args...)
 	}
+	closeBeforeExit() // so that the messages get logged
 	panic(args)
 }
 
 // Logs the given message and crashes the program
 func Crashf(format string, args ...interface{}) {
 	Global.intLogf(CRITICAL, format, args...)
-	Global.Close() // so that hopefully the messages get logged
+	closeBeforeExit() // so that the messages get logged
 	panic(fmt.Sprintf(format, args...))
 }
 
@@ -65,14 +78,14 @@ func Exit(args ...interface{}) {
 	if len(args) > 0 {
 		Global.intLogf(ERROR, strings.Repeat(" %v", len(args))[1:], args...)
 	}
-	Global.Close() // so that hopefully the messages get logged
+	closeBeforeExit() // so that the messages get logged
 	os.Exit(0)
 }
 
 // Compatibility with `log`
 func Exitf(format string, args ...interface{}) {
 	Global.intLogf(ERROR, format, args...)
-	Global.Close() // so that hopefully the messages get logged
+	closeBeforeExit() // so that the messages get logged
 	os.Exit(0)
 }
 
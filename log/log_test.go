@@ -15,8 +15,17 @@
 package log
 
 import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/baidu/go-lib/log/log4go"
 )
 
 func TestLog(t *testing.T) {
@@ -35,7 +44,11 @@ func TestLog(t *testing.T) {
 		// time.Sleep(10 * time.Second)
 	}
 
-	time.Sleep(100 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := Logger.Flush(ctx); err != nil {
+		t.Errorf("Logger.Flush(): %s", err)
+	}
 }
 
 func TestCompress(t *testing.T) {
@@ -54,3 +67,347 @@ func TestCompress(t *testing.T) {
 		i++
 	}
 }
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log.yaml")
+	writeConfig := func(logFile string) {
+		config := "filters:\n" +
+			"  - tag: log\n" +
+			"    type: timefile\n" +
+			"    level: INFO\n" +
+			"    properties:\n" +
+			"      filename: " + filepath.Join(dir, logFile) + "\n" +
+			"      format: \"%M\"\n"
+		if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile(): %s", err)
+		}
+	}
+
+	writeConfig("a.log")
+	if err := Reload(path); err != nil {
+		t.Fatalf("Reload(): %s", err)
+	}
+	if ConfigPath() != path {
+		t.Errorf("ConfigPath(): got %s, want %s", ConfigPath(), path)
+	}
+	for i := 0; i < 100; i++ {
+		Logger.Info("first")
+	}
+
+	// records written to old logger are not lost
+	writeConfig("b.log")
+	if err := Reload(path); err != nil {
+		t.Fatalf("Reload(): %s", err)
+	}
+	for i := 0; i < 100; i++ {
+		Logger.Info("second")
+	}
+	closing.Wait()
+
+	// logging while reloading, see go test -race
+	writeConfig("c.log")
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 1000; i++ {
+			Current().Info("third")
+			Get("unregistered").Debug("skipped")
+		}
+		close(done)
+	}()
+	for i := 0; i < 3; i++ {
+		if err := Reload(path); err != nil {
+			t.Fatalf("Reload(): %s", err)
+		}
+	}
+	<-done
+	closing.Wait()
+
+	// Logger is not changed if configuration is invalid
+	if err := ioutil.WriteFile(path, []byte("filters: [{tag: log}]"), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile(): %s", err)
+	}
+	if err := Reload(path); err == nil {
+		t.Errorf("Reload() should fail for invalid configuration")
+	}
+	if err := Logger.Flush(context.Background()); err != nil {
+		t.Errorf("Logger.Flush(): %s", err)
+	}
+
+	for file, msg := range map[string]string{"a.log": "first\n", "b.log": "second\n"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatalf("ioutil.ReadFile(): %s", err)
+		}
+		if string(data) != strings.Repeat(msg, 100) {
+			t.Errorf("%s: got %d bytes, want 100 records of %q", file, len(data), msg)
+		}
+	}
+	// records logged to old loggers after they are closed are dropped
+	data, err := ioutil.ReadFile(filepath.Join(dir, "c.log"))
+	if n := strings.Count(string(data), "third\n"); err != nil || n == 0 || len(data) != n*len("third\n") {
+		t.Errorf("c.log: got %q, error %v", data, err)
+	}
+}
+
+func TestReloadReuse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log.yaml")
+	logFile := filepath.Join(dir, "a.log")
+	writeConfig := func(level, format string) {
+		config := "filters:\n" +
+			"  - tag: log\n" +
+			"    type: timefile\n" +
+			"    level: " + level + "\n" +
+			"    properties:\n" +
+			"      filename: " + logFile + "\n" +
+			"      format: \"" + format + "\"\n"
+		if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile(): %s", err)
+		}
+	}
+
+	writeConfig("INFO", "%M")
+	if err := Reload(path); err != nil {
+		t.Fatalf("Reload(): %s", err)
+	}
+	filt := Current()["log"]
+	for i := 0; i < 100; i++ {
+		Current().Info("first")
+	}
+
+	// writer is reused if only level is changed
+	writeConfig("DEBUG", "%M")
+	if err := Reload(path); err != nil {
+		t.Fatalf("Reload(): %s", err)
+	}
+	if Current()["log"] != filt {
+		t.Errorf("filter should be reused if writer is not changed")
+	}
+	if got := GetLevels()["log"]; got != "DEBUG" {
+		t.Errorf("got level %s, want DEBUG", got)
+	}
+	for i := 0; i < 100; i++ {
+		Current().Debug("second")
+	}
+
+	// old writer of the file is closed before new writer is created
+	writeConfig("DEBUG", "[%L] %M")
+	if err := Reload(path); err != nil {
+		t.Fatalf("Reload(): %s", err)
+	}
+	if Current()["log"] == filt {
+		t.Errorf("filter should not be reused if writer is changed")
+	}
+	for i := 0; i < 100; i++ {
+		Current().Info("third")
+	}
+	closing.Wait()
+	if err := Current().Flush(context.Background()); err != nil {
+		t.Errorf("Flush(): %s", err)
+	}
+
+	data, err := ioutil.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile(): %s", err)
+	}
+	want := strings.Repeat("first\n", 100) + strings.Repeat("second\n", 100) +
+		strings.Repeat("[INFO] third\n", 100)
+	if string(data) != want {
+		t.Errorf("a.log: got %d bytes, want %d bytes", len(data), len(want))
+	}
+}
+
+func TestEnableTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tail")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(logger log4go.Logger) {
+		setLogger(logger)
+		tailFilter = nil
+	}(Logger)
+	setLogger(make(log4go.Logger))
+
+	if TailWriter() != nil {
+		t.Errorf("TailWriter() should be nil before EnableTail()")
+	}
+	if err := EnableTail(10, "VERBOSE"); err == nil {
+		t.Errorf("EnableTail() should fail for invalid level")
+	}
+	if err := EnableTail(10, "INFO"); err != nil {
+		t.Fatalf("EnableTail(): %s", err)
+	}
+	Logger.Info("a")
+	Logger.Debug("b")
+
+	// filter for tail is kept after reload
+	path := filepath.Join(dir, "log.yaml")
+	config := "filters:\n" +
+		"  - tag: log\n" +
+		"    type: file\n" +
+		"    level: INFO\n" +
+		"    properties:\n" +
+		"      filename: " + filepath.Join(dir, "a.log") + "\n"
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile(): %s", err)
+	}
+	if err := Reload(path); err != nil {
+		t.Fatalf("Reload(): %s", err)
+	}
+	if err := EnableTail(10, "DEBUG"); err != nil {
+		t.Fatalf("EnableTail(): %s", err)
+	}
+	Logger.Debug("c")
+
+	var msgs []string
+	for _, rec := range TailWriter().Tail(0, nil) {
+		msgs = append(msgs, rec.Message)
+	}
+	if got := strings.Join(msgs, ","); got != "a,c" {
+		t.Errorf("got %s, want a,c", got)
+	}
+	if got := GetLevels()[TAIL_FILTER]; got != "DEBUG" {
+		t.Errorf("got level %s, want DEBUG", got)
+	}
+	Logger.Close()
+	configPath = ""
+	lastConfig = nil
+}
+
+func TestSlog(t *testing.T) {
+	defer func(logger log4go.Logger) {
+		setLogger(logger)
+	}(Logger)
+
+	// records of slog are written to Logger, which may be replaced
+	w := log4go.NewMemoryLogWriter(10)
+	setLogger(make(log4go.Logger))
+	logger := slog.New(SlogHandler())
+	Logger.AddFilter("mem", log4go.INFO, w)
+	logger.Info("from slog", "id", 1)
+	Logger.Info("from log4go")
+
+	var msgs []string
+	for _, rec := range w.Tail(0, nil) {
+		msgs = append(msgs, log4go.FormatLogRecord("%L %M", rec))
+	}
+	if got := strings.Join(msgs, ""); got != "INFO from slog id=1\nINFO from log4go\n" {
+		t.Errorf("got %q", got)
+	}
+
+	// records of Interface are written to slog handler
+	var buf bytes.Buffer
+	var l Interface = NewSlogLogger(slog.NewTextHandler(&buf, &slog.HandlerOptions{AddSource: true}))
+	l.Debug("skipped")
+	l.Info("count %d", 3)
+	if err := l.Warn("warn"); err == nil || err.Error() != "warn" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := l.Error("code %d", 5); err == nil || err.Error() != "code 5" {
+		t.Errorf("unexpected error %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"level=INFO", `msg="count 3"`, "level=WARN", "msg=warn", `msg="code 5"`, "log_test.go:"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%q not found in %q", want, out)
+		}
+	}
+	if strings.Contains(out, "skipped") || strings.Contains(out, "slog.go") {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(): %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(logger log4go.Logger) {
+		setLogger(logger)
+	}(Logger)
+	setLogger(make(log4go.Logger))
+
+	access, err := Register("access", Options{
+		Level:       "DEBUG",
+		Format:      "%L %M",
+		LogDir:      dir,
+		When:        "H",
+		BackupCount: 24,
+	})
+	if err != nil {
+		t.Fatalf("Register(): %s", err)
+	}
+	audit, err := Register("audit", Options{Level: "WARNING", LogDir: dir, WithWf: true})
+	if err != nil {
+		t.Fatalf("Register(): %s", err)
+	}
+
+	errOpts := map[string]Options{
+		"access": {LogDir: dir},
+		"":       {LogDir: dir},
+		"level":  {Level: "VERBOSE", LogDir: dir},
+		"when":   {When: "Y", LogDir: dir},
+		"none":   {Level: "INFO"},
+	}
+	for name, opts := range errOpts {
+		if _, err := Register(name, opts); err == nil {
+			t.Errorf("%s: error expected", name)
+		}
+	}
+
+	if Get("access")["log"] != access["log"] || Get("audit")["log_wf"] != audit["log_wf"] {
+		t.Errorf("unexpected logger from Get()")
+	}
+	if _, ok := Get("debug")["log"]; ok {
+		t.Errorf("global Logger expected for unregistered name")
+	}
+	if got := strings.Join(Names(), ","); got != "access,audit" {
+		t.Errorf("got names %s, want access,audit", got)
+	}
+
+	Get("access").Debug("GET /")
+	Get("audit").Info("skipped")
+	Get("audit").Warn("denied")
+	if err := CloseWithTimeout(5 * time.Second); err != nil {
+		t.Errorf("CloseWithTimeout(): %s", err)
+	}
+	if len(Names()) != 0 {
+		t.Errorf("loggers should be unregistered after closed")
+	}
+
+	wants := map[string]string{
+		"access.log":    "DEBG GET /\n",
+		"audit.log":     "denied",
+		"audit.wf.log":  "denied",
+		"access.wf.log": "",
+	}
+	for file, want := range wants {
+		data, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if want == "" {
+			if err == nil {
+				t.Errorf("%s should not be created", file)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ioutil.ReadFile(): %s", err)
+		} else if !strings.Contains(string(data), want) || strings.Contains(string(data), "skipped") {
+			t.Errorf("%s: unexpected content %q", file, data)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// registry of named loggers, besides the global Logger
+/*
+Usage:
+    // the global Logger, as before
+    log.Init("test", "INFO", "./log", true, "midnight", 5)
+
+    // access log in ./log/access.log, rotated hourly, kept for 1 day
+    _, err := log.Register("access", log.Options{
+        Level:       "INFO",
+        Format:      "%M",
+        LogDir:      "./log",
+        When:        "H",
+        BackupCount: 24,
+    })
+
+    // audit log sent to remote log server
+    _, err = log.Register("audit", log.Options{
+        Network: "tcp",
+        SvrAddr: "10.0.0.1:514",
+    })
+
+    log.Get("access").Info("GET /index.html 200")
+
+    // named loggers are also closed
+    log.CloseWithTimeout(time.Second)
+
+Get() returns the global Logger for names not registered, so code using a
+named logger still works before it is registered.
+*/
+
+package log
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/baidu/go-lib/log/log4go"
+)
+
+// Options is options of named logger, see Register()
+type Options struct {
+	Level  string // "DEBUG", "TRACE", "INFO", "WARNING", "ERROR", "CRITICAL", default "INFO"
+	Format string // format of log files and remote server, default log4go.LogFormat
+
+	// log files, <name>.log (and <name>.wf.log if WithWf) in LogDir
+	LogDir         string        // no log file if empty
+	When           string        // "M", "H", "D" or "MIDNIGHT", default "MIDNIGHT"
+	BackupCount    int           // max number of backups kept, if > 0
+	EnableCompress bool          // whether to compress backups
+	MaxBackupSize  int64         // max total size of backups, if > 0
+	MaxBackupAge   time.Duration // max age of backups, if > 0
+	WithWf         bool          // whether to write warning and above to <name>.wf.log
+
+	// remote log server
+	Network string // "udp", "unixgram", "tcp" or "tls", see InitWithLogSvr()
+	SvrAddr string // address of remote log server, no remote log if empty
+
+	HasStdOut bool // whether to have stdout output
+}
+
+var (
+	registryLock sync.RWMutex
+	registry     = make(map[string]log4go.Logger) // name => named logger
+)
+
+// Register creates a named logger by opts, and registers it
+//
+// PARAMS:
+//   - name: name of logger, e.g., "access"
+//   - opts: options of logger
+func Register(name string, opts Options) (log4go.Logger, error) {
+	if len(opts.Level) > 0 {
+		if _, err := log4go.ParseLevel(opts.Level); err != nil {
+			return nil, err
+		}
+	}
+	if len(opts.When) == 0 {
+		opts.When = "MIDNIGHT"
+	}
+	if len(opts.LogDir) == 0 && len(opts.SvrAddr) == 0 && !opts.HasStdOut {
+		return nil, fmt.Errorf("no output for logger %s", name)
+	}
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+
+	logger, err := newLogger(name, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := RegisterLogger(name, logger); err != nil {
+		logger.Close()
+		return nil, err
+	}
+	return logger, nil
+}
+
+// RegisterLogger registers a logger created by the application (e.g., by
+// log4go.LoggerConfig.Build) with name
+func RegisterLogger(name string, logger log4go.Logger) error {
+	if logger == nil {
+		return errors.New("logger is nil")
+	}
+
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if err := checkNameLocked(name); err != nil {
+		return err
+	}
+	registry[name] = logger
+	return nil
+}
+
+// Get gets the named logger, or the global logger (see Current()) if it is
+// not registered
+func Get(name string) log4go.Logger {
+	registryLock.RLock()
+	logger, ok := registry[name]
+	registryLock.RUnlock()
+
+	if !ok {
+		return Current()
+	}
+	return logger
+}
+
+// Names gets names of registered loggers, in sorted order
+func Names() []string {
+	registryLock.RLock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	registryLock.RUnlock()
+
+	sort.Strings(names)
+	return names
+}
+
+// checkName checks whether name could be registered
+func checkName(name string) error {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	return checkNameLocked(name)
+}
+
+// checkNameLocked checks whether name could be registered, with lock held
+func checkNameLocked(name string) error {
+	if len(name) == 0 {
+		return errors.New("name of logger is empty")
+	}
+	if _, ok := registry[name]; ok {
+		return fmt.Errorf("logger %s is registered already", name)
+	}
+	return nil
+}
+
+// closeRegistry closes and unregisters all named loggers within the time
+func closeRegistry(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	registryLock.Lock()
+	loggers := registry
+	registry = make(map[string]log4go.Logger)
+	registryLock.Unlock()
+
+	var errs []error
+	for name, logger := range loggers {
+		if err := logger.CloseWithTimeout(time.Until(deadline)); err != nil {
+			errs = append(errs, fmt.Errorf("logger %s: %s", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
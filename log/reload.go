@@ -0,0 +1,145 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// reload of log configuration at runtime
+/*
+Usage:
+    // initialize log from configuration file (JSON, YAML, TOML or XML,
+    // see log4go.ReadConfigFile), instead of Init()
+    if err := log.Reload("conf/log.yaml"); err != nil {
+        return err
+    }
+
+    // after the file is changed (e.g., path of log file, rotation policy,
+    // address of remote log server), reload it
+    err := log.Reload("conf/log.yaml")
+
+    // or reload the file used last time, by web monitor
+    curl "http://127.0.0.1:8421/reload/log_config"
+
+A new Logger is created from the file, and replaces log.Logger. Writers
+not changed since the last Reload() are reused. Old writers of files which
+are also written by new writers are closed before the new writers are
+created (see log4go.LoggerConfig.BuildFrom). Other writers of the old Logger
+are flushed and closed in background, after records being dispatched to
+them are written (see log4go.Logger.Shutdown). Records logged to closed
+writers are dropped. Module levels (see log4go.Named) are
+replaced by those in the file. If the file is invalid, log.Logger and module
+levels are not changed. The filter added by EnableTail() is kept.
+
+Since log.Logger is replaced, it must not be read directly if Reload() may
+be called concurrently. Use log.Current() instead, and do not keep the
+returned logger.
+*/
+
+package log
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/baidu/go-lib/log/log4go"
+)
+
+// max time to flush and close old writers
+const RELOAD_CLOSE_TIMEOUT = 30 * time.Second
+
+var (
+	configPath string               // path of configuration file, see Reload()
+	lastConfig *log4go.LoggerConfig // configuration loaded by the last Reload()
+	reloading  sync.Mutex           // serializes Reload()
+	closing    sync.WaitGroup       // old loggers being closed
+)
+
+// Reload creates a new Logger from configuration file, and replaces Logger
+// with it. Unchanged writers are reused, and other writers of the old Logger
+// are flushed and closed. It could also be used to initialize log lib.
+//
+// PARAMS:
+//   - path: path of configuration file, see log4go.ReadConfigFile
+func Reload(path string) error {
+	reloading.Lock()
+	defer reloading.Unlock()
+
+	cfg, err := log4go.ReadConfigFile(path)
+	if err != nil {
+		return err
+	}
+	mutex.Lock()
+	oldCfg := lastConfig
+	mutex.Unlock()
+	newLogger, err := cfg.BuildFrom(Current(), oldCfg, RELOAD_CLOSE_TIMEOUT)
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	newLogger = withTailFilter(newLogger)
+	oldLogger := Current()
+	setLogger(newLogger)
+	log4go.SetModuleLevels(cfg.ModuleLevels())
+	configPath = path
+	lastConfig = cfg
+	initialized = true
+	mutex.Unlock()
+
+	if oldLogger != nil {
+		closing.Add(1)
+		go closeOldLogger(oldLogger, newLogger)
+	}
+	return nil
+}
+
+// ConfigPath returns path of configuration file used by the last Reload(),
+// or "" if Reload() is not used
+func ConfigPath() string {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	return configPath
+}
+
+// closeOldLogger flushes and closes writers of the old logger, except those
+// shared with the new logger or already closed. The old logger is not changed, since it may
+// still be in use. Errors are logged by the new logger.
+func closeOldLogger(oldLogger log4go.Logger, newLogger log4go.Logger) {
+	defer closing.Done()
+
+	retired := make(log4go.Logger, len(oldLogger))
+	for name, filt := range oldLogger {
+		if newLogger[name] != filt {
+			retired[name] = filt
+		}
+	}
+	if err := retired.Shutdown(RELOAD_CLOSE_TIMEOUT); err != nil {
+		newLogger.Warn("log.Reload(): close old writers: %s", err)
+	}
+}
+
+// waitForClosing waits until old loggers are closed, or timeout
+func waitForClosing(timeout time.Duration) error {
+	done := make(chan struct{})
+	go func() {
+		closing.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("old loggers not closed in %s", timeout)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// logging interface, and adapters between log and log/slog
+/*
+Usage:
+    // code depending on log.Interface could log by log4go or slog
+    func NewServer(logger log.Interface) *Server
+
+    srv := NewServer(log.Logger)
+    srv := NewServer(log.NewSlogLogger(slog.NewJSONHandler(os.Stderr, nil)))
+
+    // records of slog are written to files of log.Logger, and the handler
+    // follows log.Logger replaced by log.Reload()
+    slog.SetDefault(slog.New(log.SlogHandler()))
+    slog.Info("request done", "status", 200)
+*/
+
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/baidu/go-lib/log/log4go"
+)
+
+// Interface is a small logging interface, implemented by log4go.Logger,
+// *log4go.Entry and *SlogLogger. Arguments are the same as log4go.Logger.
+type Interface interface {
+	Debug(arg0 interface{}, args ...interface{})
+	Trace(arg0 interface{}, args ...interface{})
+	Info(arg0 interface{}, args ...interface{})
+	Warn(arg0 interface{}, args ...interface{}) error
+	Error(arg0 interface{}, args ...interface{}) error
+	Critical(arg0 interface{}, args ...interface{}) error
+}
+
+var (
+	_ Interface = log4go.Logger(nil)
+	_ Interface = (*log4go.Entry)(nil)
+	_ Interface = (*SlogLogger)(nil)
+)
+
+// SlogHandler creates a slog.Handler writing records to Logger. Logger
+// replaced by Reload() is followed.
+func SlogHandler() slog.Handler {
+	return log4go.NewSlogHandler(Current)
+}
+
+// SlogLogger implements Interface by slog.Handler
+type SlogLogger struct {
+	handler slog.Handler
+}
+
+// NewSlogLogger creates a logger writing records to handler
+//
+// PARAMS:
+//   - handler: handler of slog, e.g., slog.Default().Handler()
+func NewSlogLogger(handler slog.Handler) *SlogLogger {
+	return &SlogLogger{handler: handler}
+}
+
+// Handler returns handler of the logger
+func (l *SlogLogger) Handler() slog.Handler {
+	return l.handler
+}
+
+// Debug logs a message at the debug log level
+func (l *SlogLogger) Debug(arg0 interface{}, args ...interface{}) {
+	l.log(log4go.DEBUG, arg0, args...)
+}
+
+// Trace logs a message at the trace log level
+func (l *SlogLogger) Trace(arg0 interface{}, args ...interface{}) {
+	l.log(log4go.TRACE, arg0, args...)
+}
+
+// Info logs a message at the info log level
+func (l *SlogLogger) Info(arg0 interface{}, args ...interface{}) {
+	l.log(log4go.INFO, arg0, args...)
+}
+
+// Warn logs a message at the warning log level, and returns the message
+// as error
+func (l *SlogLogger) Warn(arg0 interface{}, args ...interface{}) error {
+	return errors.New(l.log(log4go.WARNING, arg0, args...))
+}
+
+// Error logs a message at the error log level, and returns the message
+// as error
+func (l *SlogLogger) Error(arg0 interface{}, args ...interface{}) error {
+	return errors.New(l.log(log4go.ERROR, arg0, args...))
+}
+
+// Critical logs a message at the critical log level, and returns the
+// message as error
+func (l *SlogLogger) Critical(arg0 interface{}, args ...interface{}) error {
+	return errors.New(l.log(log4go.CRITICAL, arg0, args...))
+}
+
+// log writes a record to handler, and returns the message. Message is
+// generated in the same way as log4go.Logger.
+func (l *SlogLogger) log(lvl log4go.LevelType, arg0 interface{}, args ...interface{}) string {
+	ctx := context.Background()
+	level := lvl.SlogLevel()
+	enabled := l.handler.Enabled(ctx, level)
+
+	// message is only needed for error at the warning level and higher
+	if !enabled && lvl < log4go.WARNING {
+		return ""
+	}
+
+	var msg string
+	switch first := arg0.(type) {
+	case string:
+		msg = first
+		if len(args) > 0 {
+			msg = fmt.Sprintf(first, args...)
+		}
+	case func() string:
+		msg = first()
+	default:
+		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
+	}
+	if !enabled {
+		return msg
+	}
+
+	// skip runtime.Callers, log and the exported method
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	if err := l.handler.Handle(ctx, r); err != nil {
+		fmt.Fprintf(os.Stderr, "log.SlogLogger: %s\n", err)
+	}
+	return msg
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// latest records of log kept in memory, for tailing log remotely
+/*
+Usage:
+    log.Init("test", "INFO", "./log", true, "midnight", 5)
+
+    // keep the latest 10000 records of INFO or above in memory
+    log.EnableTail(10000, "INFO")
+
+    // show the latest records by web monitor
+    curl "http://127.0.0.1:8421/monitor/log_tail?n=100&level=WARNING"
+
+The filter "tail" is added to log.Logger, and kept after Reload(). Records
+kept are redacted by redactors of all other filters (see log4go.Redactor),
+which are updated by Reload() and EnableTail(). Redactors set to filters of
+log.Logger directly afterwards are applied after the next EnableTail().
+*/
+
+package log
+
+import (
+	"errors"
+
+	"github.com/baidu/go-lib/log/log4go"
+)
+
+const (
+	TAIL_FILTER = "tail" // name of filter for tailing log
+)
+
+var tailFilter *log4go.Filter // filter for tailing log, see EnableTail()
+
+// EnableTail adds a filter keeping the latest records in memory to Logger.
+// If it is enabled already, the size is not changed, and only the level and
+// redactor are set.
+//
+// PARAMS:
+//   - size: max number of records kept
+//   - levelStr: "DEBUG", "TRACE", "INFO", "WARNING", "ERROR", "CRITICAL"
+func EnableTail(size int, levelStr string) error {
+	level, err := log4go.ParseLevel(levelStr)
+	if err != nil {
+		return err
+	}
+	if size <= 0 {
+		return errors.New("size of tail should be > 0")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	logger := Current()
+	if logger == nil {
+		return errors.New("log is not initialized")
+	}
+	if tailFilter != nil {
+		log4go.Logger{TAIL_FILTER: tailFilter}.SetLevel(TAIL_FILTER, level)
+	} else {
+		tailFilter = &log4go.Filter{Level: level, LogWriter: log4go.NewMemoryLogWriter(size)}
+	}
+
+	// Logger is replaced, since it may be in use by other goroutines
+	setLogger(withTailFilter(logger))
+	return nil
+}
+
+// TailWriter returns writer keeping the latest records, or nil if
+// EnableTail() is not invoked
+func TailWriter() *log4go.MemoryLogWriter {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if tailFilter == nil {
+		return nil
+	}
+	return tailFilter.LogWriter.(*log4go.MemoryLogWriter)
+}
+
+// withTailFilter returns a copy of logger with filter for tailing log
+// added, if it is enabled. Redactor of the filter is set to mask data masked
+// by any other filter of logger.
+func withTailFilter(logger log4go.Logger) log4go.Logger {
+	if tailFilter == nil {
+		return logger
+	}
+
+	newLogger := make(log4go.Logger, len(logger)+1)
+	for name, filt := range logger {
+		if name != TAIL_FILTER {
+			newLogger[name] = filt
+		}
+	}
+	redactor := newLogger.MergeRedactor()
+	newLogger[TAIL_FILTER] = tailFilter
+	newLogger.SetRedactor(TAIL_FILTER, redactor)
+	return newLogger
+}
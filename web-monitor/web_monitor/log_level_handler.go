@@ -0,0 +1,107 @@
+// Copyright (c) 2018 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// handlers for level of log
+/*
+Usage:
+    // show filters and levels of log.Logger
+    curl "http://127.0.0.1:8421/monitor/log_level"
+
+    // change level of filter "stdout" to DEBUG
+    curl "http://127.0.0.1:8421/reload/log_level?filter=stdout&level=DEBUG"
+
+    // change level of module "bfe.route" to DEBUG
+    curl "http://127.0.0.1:8421/reload/log_level?module=bfe.route&level=DEBUG"
+
+    // show state of log4go (e.g., records dropped, written by each writer),
+    // log4go.SetWithModuleState(true) should be invoked before
+    curl "http://127.0.0.1:8421/monitor/log_state"
+
+    // reload log.Logger from configuration file used by log.Reload()
+    curl "http://127.0.0.1:8421/reload/log_config"
+*/
+
+package web_monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+import (
+	"github.com/baidu/go-lib/log"
+	"github.com/baidu/go-lib/log/log4go"
+	"github.com/baidu/go-lib/web-monitor/web_params"
+)
+
+// logLevelMonitor shows filters of log.Logger and their levels
+func logLevelMonitor(params map[string][]string) ([]byte, error) {
+	levels := log.GetLevels()
+
+	format := GetFormatParam(params)
+	switch format {
+	case "json":
+		return json.Marshal(levels)
+	case "kv":
+		names := make([]string, 0, len(levels))
+		for name := range levels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var buf bytes.Buffer
+		for _, name := range names {
+			buf.WriteString(fmt.Sprintf("%s:%s\n", name, levels[name]))
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("invalid format:%s", format)
+	}
+}
+
+// logStateMonitor shows state of log4go
+var logStateMonitor = CreateStateDataHandler(log4go.GetModuleState)
+
+// logLevelReload changes level of a filter or a module of log.Logger
+func logLevelReload(params map[string][]string) error {
+	level, err := web_params.ParamsValueGet(params, "level")
+	if err != nil {
+		return fmt.Errorf("level: %s", err.Error())
+	}
+
+	if module, err := web_params.ParamsValueGet(params, "module"); err == nil {
+		return log.SetModuleLevel(module, level)
+	}
+
+	filter, err := web_params.ParamsValueGet(params, "filter")
+	if err != nil {
+		return fmt.Errorf("filter: %s", err.Error())
+	}
+
+	return log.SetLevel(filter, level)
+}
+
+// logConfigReload reloads log.Logger from configuration file, see log.Reload.
+// Path of the file is not given by params, only the file used by the last
+// log.Reload() is reloaded.
+func logConfigReload(params map[string][]string) error {
+	path := log.ConfigPath()
+	if len(path) == 0 {
+		return errors.New("log is not initialized by configuration file")
+	}
+	return log.Reload(path)
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2019 Baidu, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// handler for tailing and searching log
+/*
+Usage:
+    // log.EnableTail() should be invoked before, e.g.,
+    log.EnableTail(10000, "DEBUG")
+
+    // show the latest 100 records
+    curl "http://127.0.0.1:8421/monitor/log_tail"
+
+    // show the latest 20 records of WARNING or above, from package route,
+    // with "timeout" in message, in JSON lines
+    curl "http://127.0.0.1:8421/monitor/log_tail?n=20&level=WARNING&source=route.&match=timeout&format=json"
+
+    // show records in time range, time is in RFC3339 or unix seconds
+    curl "http://127.0.0.1:8421/monitor/log_tail?since=2019-05-01T10:00:00%2B08:00&until=1556677200"
+
+    // follow new records, by chunked response or server-sent events
+    curl -N "http://127.0.0.1:8421/monitor/log_tail?stream=chunked&level=ERROR"
+    curl -N "http://127.0.0.1:8421/monitor/log_tail?stream=sse"
+
+Params:
+    - n: max number of records shown, default LOG_TAIL_DEFAULT_NUM
+    - level: min level of records
+    - source: substring of source (func:line) of records
+    - match: substring of message of records
+    - since, until: time range of records
+    - format: "text" (log4go.LogFormat, default) or "json"
+    - stream: "chunked" or "sse" for following new records
+
+Since records may contain sensitive data, log_tail is only allowed from
+sources allowed for reload (see InitReloadACL).
+*/
+
+package web_monitor
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+import (
+	"github.com/baidu/go-lib/log"
+	"github.com/baidu/go-lib/log/log4go"
+	"github.com/baidu/go-lib/web-monitor/web_params"
+)
+
+const (
+	LOG_TAIL_DEFAULT_NUM = 100              // default number of records shown
+	LOG_TAIL_HEARTBEAT   = 15 * time.Second // interval of heartbeat for sse
+)
+
+// logTailParams is parameters of log_tail
+type logTailParams struct {
+	num    int
+	filter log4go.RecordFilter
+	format string // format of record, see log4go.FormatLogRecord
+	stream string // "", "chunked" or "sse"
+}
+
+// logTailMonitor shows the latest records of log.Logger, and follows new
+// records in stream mode
+func logTailMonitor(w http.ResponseWriter, r *http.Request) {
+	// check source address
+	if !isValidForReload(r.RemoteAddr) {
+		log.Current().Warn("MonitorServer:Blocked log_tail request from[%s]", r.RemoteAddr)
+		webOutput(w, nil, fmt.Errorf("log_tail is not allowed from [%s]", r.RemoteAddr))
+		return
+	}
+
+	writer := log.TailWriter()
+	if writer == nil {
+		webOutput(w, nil, fmt.Errorf("log tail is not enabled, see log.EnableTail()"))
+		return
+	}
+
+	p, err := parseLogTailParams(r.URL.Query())
+	if err != nil {
+		webOutput(w, nil, err)
+		return
+	}
+
+	if p.stream == "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, rec := range writer.Tail(p.num, &p.filter) {
+			fmt.Fprint(w, log4go.FormatLogRecord(p.format, rec))
+		}
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		webOutput(w, nil, fmt.Errorf("streaming is not supported"))
+		return
+	}
+	if p.stream == "sse" {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+
+	recs, ch, cancel := writer.TailAndSubscribe(p.num, &p.filter, 0)
+	defer cancel()
+
+	for _, rec := range recs {
+		writeTailRecord(w, p, rec)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(LOG_TAIL_HEARTBEAT)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case rec := <-ch:
+			if !p.filter.Match(rec) {
+				continue
+			}
+			writeTailRecord(w, p, rec)
+			flusher.Flush()
+		case <-heartbeat.C:
+			// detect broken connection, and keep proxies from closing it
+			if p.stream == "sse" {
+				fmt.Fprint(w, ": heartbeat\n\n")
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeTailRecord writes a record in the stream
+func writeTailRecord(w http.ResponseWriter, p *logTailParams, rec *log4go.LogRecord) {
+	line := log4go.FormatLogRecord(p.format, rec)
+	if p.stream != "sse" {
+		fmt.Fprint(w, line)
+		return
+	}
+
+	// each line of record is sent as a data field of the event
+	line = strings.TrimSuffix(line, "\n")
+	for _, data := range strings.Split(line, "\n") {
+		fmt.Fprintf(w, "data: %s\n", data)
+	}
+	fmt.Fprint(w, "\n")
+}
+
+// parseLogTailParams parses parameters of log_tail
+func parseLogTailParams(params map[string][]string) (*logTailParams, error) {
+	p := &logTailParams{
+		num:    LOG_TAIL_DEFAULT_NUM,
+		format: log4go.LogFormat,
+	}
+
+	if value, err := web_params.ParamsValueGet(params, "n"); err == nil {
+		num, err := strconv.Atoi(value)
+		if err != nil || num <= 0 {
+			return nil, fmt.Errorf("invalid n:%s", value)
+		}
+		p.num = num
+	}
+
+	if value, err := web_params.ParamsValueGet(params, "level"); err == nil {
+		level, err := log4go.ParseLevel(value)
+		if err != nil {
+			return nil, err
+		}
+		p.filter.Level = level
+	}
+
+	p.filter.Source, _ = web_params.ParamsValueGet(params, "source")
+	p.filter.Message, _ = web_params.ParamsValueGet(params, "match")
+
+	for key, t := range map[string]*time.Time{"since": &p.filter.Since, "until": &p.filter.Until} {
+		value, err := web_params.ParamsValueGet(params, key)
+		if err != nil {
+			continue
+		}
+		if *t, err = parseTailTime(value); err != nil {
+			return nil, fmt.Errorf("invalid %s:%s", key, value)
+		}
+	}
+
+	if value, err := web_params.ParamsValueGet(params, "format"); err == nil {
+		switch value {
+		case "text":
+		case "json":
+			p.format = log4go.FORMAT_JSON
+		default:
+			return nil, fmt.Errorf("invalid format:%s", value)
+		}
+	}
+
+	if value, err := web_params.ParamsValueGet(params, "stream"); err == nil {
+		switch value {
+		case "chunked", "sse":
+			p.stream = value
+		default:
+			return nil, fmt.Errorf("invalid stream:%s", value)
+		}
+	}
+
+	return p, nil
+}
+
+// parseTailTime parses time in RFC3339 or unix seconds
+func parseTailTime(value string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
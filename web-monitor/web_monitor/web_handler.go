@@ -67,8 +67,13 @@ func NewWebHandlers() *WebHandlers {
 
 	// handlers for monitor
 	wh.Handlers[WebHandleMonitor] = NewWebHandlerMap()
+	(*wh.Handlers[WebHandleMonitor])["log_level"] = logLevelMonitor
+	(*wh.Handlers[WebHandleMonitor])["log_state"] = logStateMonitor
+	(*wh.Handlers[WebHandleMonitor])["log_tail"] = logTailMonitor
 	// handlers for reload
 	wh.Handlers[WebHandleReload] = NewWebHandlerMap()
+	(*wh.Handlers[WebHandleReload])["log_level"] = logLevelReload
+	(*wh.Handlers[WebHandleReload])["log_config"] = logConfigReload
 	// handlers for pprof
 	wh.Handlers[WebHandlePprof] = pprofHandlers()
 
@@ -83,6 +88,7 @@ func (wh *WebHandlers) validateHandler(hType int, f interface{}) error {
 		case func() ([]byte, error):
 		case func(map[string][]string) ([]byte, error):
 		case func(url.Values) ([]byte, error):
+		case func(w http.ResponseWriter, r *http.Request): // e.g., for streaming
 		default:
 			err = fmt.Errorf("invalid monitor handler type %T", f)
 		}
@@ -107,8 +107,10 @@ func (srv *MonitorServer) HandlersSet(handlers *WebHandlers) {
 }
 
 func abnormalExit() {
-	/* to overcome bug in log, sleep for a while    */
-	time.Sleep(1 * time.Second)
+	/* make sure log is written before exit    */
+	if err := log.CloseWithTimeout(1 * time.Second); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
 	os.Exit(1)
 }
 
@@ -188,14 +190,14 @@ func webOutput(w http.ResponseWriter, buff []byte, err error) {
 	}
 }
 
-func (srv *MonitorServer) monitorHandler(command string,
-	params map[string][]string) (buff []byte, err error) {
+func (srv *MonitorServer) monitorHandler(command string, params map[string][]string,
+	w http.ResponseWriter, r *http.Request) (buff []byte, err error) {
 	var f interface{}
 
 	defer func() {
 		if perr := recover(); perr != nil {
 			err = fmt.Errorf("monitor panic:%v", perr)
-			log.Logger.Warn("MonitorServer:monitorHandler():%v\n%s",
+			log.Current().Warn("MonitorServer:monitorHandler():%v\n%s",
 				perr, gotrack.CurrentStackTrace(0))
 		}
 	}()
@@ -214,6 +216,9 @@ func (srv *MonitorServer) monitorHandler(command string,
 		buff, err = f.(func(map[string][]string) ([]byte, error))(params)
 	case func(url.Values) ([]byte, error):
 		buff, err = f.(func(url.Values) ([]byte, error))(params)
+	case func(w http.ResponseWriter, r *http.Request):
+		// response is written by handler
+		f.(func(w http.ResponseWriter, r *http.Request))(w, r)
 	}
 
 	return buff, err
@@ -227,7 +232,7 @@ func (srv *MonitorServer) reloadHandler(command string, params map[string][]stri
 	defer func() {
 		if perr := recover(); perr != nil {
 			err = fmt.Errorf("reload panic:%v", perr)
-			log.Logger.Warn("MonitorServer:reloadHandler():%v\n%s",
+			log.Current().Warn("MonitorServer:reloadHandler():%v\n%s",
 				perr, gotrack.CurrentStackTrace(0))
 		}
 	}()
@@ -235,7 +240,7 @@ func (srv *MonitorServer) reloadHandler(command string, params map[string][]stri
 	// check source address
 	if !isValidForReload(remoteAddr) {
 		err = fmt.Errorf("reload is not allowed from [%s]", remoteAddr)
-		log.Logger.Warn("MonitorServer:Blocked reload request from[%s], cmd=[%s]",
+		log.Current().Warn("MonitorServer:Blocked reload request from[%s], cmd=[%s]",
 			remoteAddr, command)
 		return buff, err
 	}
@@ -261,13 +266,13 @@ func (srv *MonitorServer) reloadHandler(command string, params map[string][]stri
 	}
 
 	if err != nil {
-		log.Logger.Error("MonitorServer:Reload through web, "+
+		log.Current().Error("MonitorServer:Reload through web, "+
 			"cmd=[%s], params=[%s], from[%s], err=[%s]",
 			command, remoteAddr, params, err.Error())
 		return buff, err
 	}
 
-	log.Logger.Info("MonitorServer:Reload through web, cmd=[%s], params=[%s] from[%s]",
+	log.Current().Info("MonitorServer:Reload through web, cmd=[%s], params=[%s] from[%s]",
 		command, params, remoteAddr)
 
 	if version != "" {
@@ -285,7 +290,7 @@ func (srv *MonitorServer) pprofHandler(command string, w http.ResponseWriter, r
 	defer func() {
 		if perr := recover(); perr != nil {
 			err = fmt.Errorf("monitor panic:%v", perr)
-			log.Logger.Warn("MonitorServer:pprofHandler():%v\n%s",
+			log.Current().Warn("MonitorServer:pprofHandler():%v\n%s",
 				perr, gotrack.CurrentStackTrace(0))
 		}
 	}()
@@ -340,7 +345,7 @@ func (srv *MonitorServer) webHandler(w http.ResponseWriter, r *http.Request) {
 	case 2:
 		switch commands[0] {
 		case "monitor":
-			buff, err = srv.monitorHandler(commands[1], params)
+			buff, err = srv.monitorHandler(commands[1], params, w, r)
 		case "reload":
 			buff, err = srv.reloadHandler(commands[1], params, r.RemoteAddr)
 		case "debug":
@@ -360,14 +365,14 @@ func (srv *MonitorServer) webHandler(w http.ResponseWriter, r *http.Request) {
 func (srv *MonitorServer) Start() {
 	err := srv.ListenAndServe()
 	if err != nil {
-		log.Logger.Error("MonitorServer.Start():err in http.ListenAndServe():%s", err.Error())
+		log.Current().Error("MonitorServer.Start():err in http.ListenAndServe():%s", err.Error())
 		abnormalExit()
 	}
 }
 
 // ListenAndServe start embeded web server
 func (srv *MonitorServer) ListenAndServe() error {
-	log.Logger.Info("Embeded web server start at port[%d]", srv.port)
+	log.Current().Info("Embeded web server start at port[%d]", srv.port)
 
 	http.HandleFunc("/", srv.webHandler)
 
@@ -15,9 +15,18 @@
 package web_monitor
 
 import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
+import (
+	"github.com/baidu/go-lib/log"
+	"github.com/baidu/go-lib/log/log4go"
+)
+
 func TestIsValidForReload(t *testing.T) {
 	if !isValidForReload("[::1]:8080") {
 		t.Error("err in valid for reload, [::1]:8080 should allow reload")
@@ -37,3 +46,91 @@ func TestInitReloadACL(t *testing.T) {
 		t.Fatal("len(RELOAD_SRC_ALLOWED) != 5")
 	}
 }
+
+func TestLogTailMonitor(t *testing.T) {
+	srv := NewMonitorServer("test", "1.0", 0)
+	get := func(url string) string {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", url, nil)
+		r.RemoteAddr = "127.0.0.1:8421"
+		srv.webHandler(w, r)
+		return w.Body.String()
+	}
+
+	// not allowed from sources not allowed for reload
+	w := httptest.NewRecorder()
+	srv.webHandler(w, httptest.NewRequest("GET", "/monitor/log_tail", nil))
+	if got := w.Body.String(); !strings.Contains(got, "not allowed") {
+		t.Errorf("unexpected response %q", got)
+	}
+	if got := get("/monitor/log_tail"); !strings.Contains(got, "not enabled") {
+		t.Errorf("unexpected response %q", got)
+	}
+
+	// records are redacted by redactors of other filters
+	log.Logger = make(log4go.Logger)
+	log.Logger.AddFilter("mem", log4go.DEBUG, log4go.NewMemoryLogWriter(10))
+	redactor, err := log4go.NewRedactorByNames("password")
+	if err != nil {
+		t.Fatalf("log4go.NewRedactorByNames(): %s", err)
+	}
+	log.Logger.SetRedactor("mem", redactor)
+	if err := log.EnableTail(100, "DEBUG"); err != nil {
+		t.Fatalf("log.EnableTail(): %s", err)
+	}
+	log.Logger.Info("info record")
+	log.Logger.Warn("warning record")
+	log.Logger.Error("error record")
+
+	got := get("/monitor/log_tail?level=WARNING&n=1&format=json")
+	if !strings.Contains(got, `"error record"`) || strings.Count(got, "\n") != 1 {
+		t.Errorf("unexpected response %q", got)
+	}
+	got = get("/monitor/log_tail?match=record&source=TestLogTailMonitor")
+	if strings.Count(got, "record\n") != 3 {
+		t.Errorf("unexpected response %q", got)
+	}
+	got = get("/monitor/log_tail?since=1&until=2030-01-01T00:00:00Z")
+	if strings.Count(got, "record\n") != 3 {
+		t.Errorf("unexpected response %q", got)
+	}
+	log.Logger.Debug("login password=123456")
+	got = get("/monitor/log_tail?match=login")
+	if !strings.Contains(got, "password="+log4go.REDACT_MASK) || strings.Contains(got, "123456") {
+		t.Errorf("unexpected response %q", got)
+	}
+	for _, params := range []string{"n=0", "level=VERBOSE", "since=yesterday", "format=xml", "stream=ws"} {
+		if got := get("/monitor/log_tail?" + params); !strings.Contains(got, "error") {
+			t.Errorf("%s: error expected, got %q", params, got)
+		}
+	}
+
+	// follow new records by server-sent events
+	ts := httptest.NewServer(http.HandlerFunc(srv.webHandler))
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "/monitor/log_tail?stream=sse&n=1&level=ERROR")
+	if err != nil {
+		t.Fatalf("http.Get(): %s", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("got content type %s", ct)
+	}
+
+	log.Logger.Warn("skipped record")
+	log.Logger.Error("new record")
+	reader := bufio.NewReader(resp.Body)
+	var events []string
+	for len(events) < 2 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString(): %s", err)
+		}
+		if strings.HasPrefix(line, "data: ") {
+			events = append(events, line)
+		}
+	}
+	if !strings.Contains(events[0], "error record") || !strings.Contains(events[1], "new record") {
+		t.Errorf("unexpected events %q", events)
+	}
+}